@@ -0,0 +1,86 @@
+package lobby
+
+// DefaultEventQueueSize is the event queue capacity used when AsyncEvents is set and
+// EventQueueSize is not.
+const DefaultEventQueueSize = 1024
+
+// emit runs an event callback for lobby. Normally it runs straight away, under the caller's
+// locks. With AsyncEvents it is queued for the event worker along with a snapshot of the
+// lobby, so the callback sees the lobby as it was when the event happened.
+func (m *LobbyManager) emit(lobby *Lobby, fn func(lobby *Lobby)) {
+	if !m.AsyncEvents {
+		fn(lobby)
+		return
+	}
+	snapshot := snapshotLobby(lobby)
+	m.enqueueEvent(func() { fn(snapshot) })
+}
+
+// emitPlayer is emit for callbacks that also take a player, who may already have left the lobby.
+func (m *LobbyManager) emitPlayer(lobby *Lobby, player *Player, fn func(lobby *Lobby, player *Player)) {
+	if !m.AsyncEvents {
+		fn(lobby, player)
+		return
+	}
+	snapshot := snapshotLobby(lobby)
+	p := *player
+	p.Metadata = copyMetadata(player.Metadata)
+	m.enqueueEvent(func() { fn(snapshot, &p) })
+}
+
+// enqueueEvent hands fn to the event worker, starting it on first use. Events run one at a
+// time in the order they were queued, which keeps each lobby's events in order. A full queue
+// blocks the caller until the worker catches up; after Shutdown, fn runs on the caller.
+func (m *LobbyManager) enqueueEvent(fn func()) {
+	m.eventsMu.RLock()
+	if m.eventQueue == nil && !m.eventsStopped {
+		m.eventsMu.RUnlock()
+		m.startEventWorker()
+		m.eventsMu.RLock()
+	}
+	if m.eventsStopped {
+		m.eventsMu.RUnlock()
+		fn()
+		return
+	}
+	m.eventQueue <- fn
+	m.eventsMu.RUnlock()
+}
+
+// startEventWorker creates the event queue and its worker goroutine unless they already exist.
+func (m *LobbyManager) startEventWorker() {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	if m.eventQueue != nil || m.eventsStopped {
+		return
+	}
+	size := m.EventQueueSize
+	if size <= 0 {
+		size = DefaultEventQueueSize
+	}
+	queue := make(chan func(), size)
+	done := make(chan struct{})
+	m.eventQueue = queue
+	m.eventsDone = done
+	go func() {
+		defer close(done)
+		for fn := range queue {
+			fn()
+		}
+	}()
+}
+
+// Shutdown delivers any queued events and stops the event worker started by AsyncEvents.
+// Events raised afterwards run synchronously. It is safe to call more than once, and does
+// nothing if no events were ever queued.
+func (m *LobbyManager) Shutdown() {
+	m.eventsMu.Lock()
+	queue, done := m.eventQueue, m.eventsDone
+	m.eventQueue = nil
+	m.eventsStopped = true
+	m.eventsMu.Unlock()
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
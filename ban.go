@@ -0,0 +1,103 @@
+package lobby
+
+import (
+	"sort"
+	"time"
+)
+
+// BanEntry records a ban: who was banned, why, when and by whom.
+type BanEntry struct {
+	PlayerID PlayerID  `json:"player_id"`
+	Username string    `json:"username"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedAt time.Time `json:"banned_at"`
+	BannedBy string    `json:"banned_by"`
+}
+
+// BanPlayer removes a player or spectator from the lobby and stops them joining or spectating
+// it again until UnbanPlayer lifts the ban. The owner and moderators may ban, with the same
+// limits as KickPlayer. The target is sent a removed_from_lobby message with RemovalBanned, and
+// a banned player leaves like a kicked one, firing OnPlayerLeave with ReasonPlayerBanned.
+func (m *LobbyManager) BanPlayer(lobbyID LobbyID, modID string, target PlayerID, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, modID) {
+		return ErrUnauthorized("ban_player")
+	}
+	player := findPlayer(lobby, target)
+	spectator := findSpectator(lobby, target)
+	if player == nil && spectator == nil {
+		return ErrPlayerNotInLobby(string(target), string(lobbyID))
+	}
+	if string(target) == modID {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Cannot ban yourself")
+	}
+	if string(target) == lobby.OwnerID || (lobby.Moderators[target] && lobby.OwnerID != modID) {
+		return ErrUnauthorized("ban_player")
+	}
+
+	entry := BanEntry{PlayerID: target, Reason: reason, BannedAt: time.Now(), BannedBy: modID}
+	if player != nil {
+		entry.Username = player.Username
+	} else {
+		entry.Username = spectator.Username
+	}
+	if lobby.bans == nil {
+		lobby.bans = make(map[PlayerID]BanEntry)
+	}
+	lobby.bans[target] = entry
+
+	m.notifyRemoved(lobby, target, RemovalBanned)
+	delete(lobby.retained, target)
+	delete(lobby.heldSeats, target)
+	if spectator != nil {
+		removeSpectator(lobby, target)
+		m.broadcastLobbyState(lobby, ReasonSpectatorLeft)
+		return nil
+	}
+	if err := m.leaveLobbyLocked(lobby, target, ReasonPlayerBanned); err != nil {
+		return err
+	}
+	m.removeIfAbandonedLocked(lobby)
+	return nil
+}
+
+// UnbanPlayer lifts a ban so the player may join the lobby again. The owner and moderators may
+// unban; unbanning a player who is not banned is not an error.
+func (m *LobbyManager) UnbanPlayer(lobbyID LobbyID, modID string, target PlayerID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, modID) {
+		return ErrUnauthorized("unban_player")
+	}
+	delete(lobby.bans, target)
+	return nil
+}
+
+// ListBans returns a copy of the lobby's bans, oldest first.
+func (m *LobbyManager) ListBans(lobbyID LobbyID) ([]BanEntry, error) {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
+	if !exists {
+		return nil, ErrLobbyNotFound(string(lobbyID))
+	}
+	defer unlock()
+	bans := make([]BanEntry, 0, len(lobby.bans))
+	for _, entry := range lobby.bans {
+		bans = append(bans, entry)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		if !bans[i].BannedAt.Equal(bans[j].BannedAt) {
+			return bans[i].BannedAt.Before(bans[j].BannedAt)
+		}
+		return bans[i].PlayerID < bans[j].PlayerID
+	})
+	return bans, nil
+}
@@ -0,0 +1,52 @@
+package lobby
+
+// TrimStrategy chooses which players TrimToCapacity removes first.
+type TrimStrategy int
+
+const (
+	// TrimLastJoined removes the most recently joined players.
+	TrimLastJoined TrimStrategy = iota
+	// TrimNotReady removes players who are not ready first, most recently joined first,
+	// then falls back to TrimLastJoined if the lobby is still over capacity.
+	TrimNotReady
+)
+
+// TrimToCapacity removes players from a lobby holding more than MaxPlayers, for example after a
+// persistent-store load. Each removed player is sent removed_from_lobby with RemovalOverCapacity
+// before being dropped. It returns the removed players' IDs in removal order.
+func (m *LobbyManager) TrimToCapacity(lobbyID LobbyID, strategy TrimStrategy) ([]PlayerID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return nil, ErrLobbyNotFound(string(lobbyID))
+	}
+	excess := len(lobby.Players) - lobby.MaxPlayers
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	var victims []PlayerID
+	chosen := make(map[PlayerID]bool, excess)
+	pick := func(skipReady bool) {
+		for i := len(lobby.Players) - 1; i >= 0 && len(victims) < excess; i-- {
+			p := lobby.Players[i]
+			if chosen[p.ID] || (skipReady && p.Ready) {
+				continue
+			}
+			chosen[p.ID] = true
+			victims = append(victims, p.ID)
+		}
+	}
+	if strategy == TrimNotReady {
+		pick(true)
+	}
+	pick(false)
+
+	for _, playerID := range victims {
+		m.notifyRemoved(lobby, playerID, RemovalOverCapacity)
+		m.leaveLobbyLocked(lobby, playerID, ReasonPlayerRemoved)
+	}
+	m.removeIfAbandonedLocked(lobby)
+	return victims, nil
+}
@@ -0,0 +1,131 @@
+package lobby
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxChatLength is used when LobbyManager.MaxChatLength is unset.
+const DefaultMaxChatLength = 500
+
+// DefaultChatRateWindow is used when LobbyManager.ChatRateLimit is set without a ChatRateWindow.
+const DefaultChatRateWindow = 10 * time.Second
+
+// DefaultMaxChatHistory is used when LobbyManager.MaxChatHistory is unset.
+const DefaultMaxChatHistory = 100
+
+// SendChatMessage broadcasts a chat message from a player to everyone in the lobby, spectators
+// included, and adds it to the lobby's chat history. The sender must be a player in the lobby,
+// and text must be non-empty and at most MaxChatLength characters. Players muted with
+// MutePlayer are refused with ErrorCodeUnauthorized, and players over ChatRateLimit with
+// ErrorCodeRateLimited.
+func (m *LobbyManager) SendChatMessage(lobbyID LobbyID, playerID PlayerID, text string) error {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	defer unlock()
+	sender := findPlayer(lobby, playerID)
+	if sender == nil {
+		return ErrPlayerNotInLobby(string(playerID), string(lobbyID))
+	}
+	if until, muted := mutedUntil(lobby, playerID); muted {
+		return ErrMuted(until)
+	}
+	maxLength := m.MaxChatLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxChatLength
+	}
+	if text == "" {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Chat message is empty")
+	}
+	if utf8.RuneCountInString(text) > maxLength {
+		return NewLobbyError(ErrorCodeInvalidRequest, fmt.Sprintf("Chat message exceeds %d characters", maxLength))
+	}
+	now := time.Now()
+	if err := m.recordChatSend(lobby, playerID, now); err != nil {
+		return err
+	}
+	msg := ChatMessageResponse{
+		Action:    "chat_message",
+		LobbyID:   string(lobby.ID),
+		UserID:    string(sender.ID),
+		Username:  sender.Username,
+		Text:      text,
+		Timestamp: now,
+	}
+	m.appendChatHistory(lobby, msg)
+	if !m.canBroadcast() {
+		return nil
+	}
+	for _, p := range lobby.Players {
+		m.deliver(string(p.ID), msg)
+	}
+	for _, s := range lobby.Spectators {
+		m.deliver(string(s.ID), msg)
+	}
+	return nil
+}
+
+// ChatHistory returns the lobby's most recent chat messages, oldest first, up to MaxChatHistory.
+func (m *LobbyManager) ChatHistory(lobbyID LobbyID) ([]ChatMessageResponse, error) {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
+	if !exists {
+		return nil, ErrLobbyNotFound(string(lobbyID))
+	}
+	defer unlock()
+	return append([]ChatMessageResponse(nil), lobby.chatHistory...), nil
+}
+
+// recordChatSend counts a chat message against the sender's ChatRateLimit, refusing it if the
+// limit is already reached. Send times older than the window are forgotten, for every player,
+// so the map only holds recent senders. Caller must hold the lobby's lock.
+func (m *LobbyManager) recordChatSend(lobby *Lobby, playerID PlayerID, now time.Time) error {
+	if m.ChatRateLimit <= 0 {
+		return nil
+	}
+	window := m.ChatRateWindow
+	if window <= 0 {
+		window = DefaultChatRateWindow
+	}
+	cutoff := now.Add(-window)
+	for id, sent := range lobby.chatSent {
+		recent := sent[:0]
+		for _, at := range sent {
+			if at.After(cutoff) {
+				recent = append(recent, at)
+			}
+		}
+		if len(recent) == 0 {
+			delete(lobby.chatSent, id)
+		} else {
+			lobby.chatSent[id] = recent
+		}
+	}
+	if len(lobby.chatSent[playerID]) >= m.ChatRateLimit {
+		return ErrRateLimited(m.ChatRateLimit, window)
+	}
+	if lobby.chatSent == nil {
+		lobby.chatSent = make(map[PlayerID][]time.Time)
+	}
+	lobby.chatSent[playerID] = append(lobby.chatSent[playerID], now)
+	return nil
+}
+
+// appendChatHistory adds msg to the lobby's chat history, dropping the oldest messages beyond
+// MaxChatHistory. Caller must hold the lobby's lock.
+func (m *LobbyManager) appendChatHistory(lobby *Lobby, msg ChatMessageResponse) {
+	limit := m.MaxChatHistory
+	if limit == 0 {
+		limit = DefaultMaxChatHistory
+	}
+	if limit < 0 {
+		return
+	}
+	lobby.chatHistory = append(lobby.chatHistory, msg)
+	if excess := len(lobby.chatHistory) - limit; excess > 0 {
+		// Copy rather than reslice so dropped messages don't pin the backing array
+		lobby.chatHistory = append(lobby.chatHistory[:0:0], lobby.chatHistory[excess:]...)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	lobby "github.com/jonosm/multiplayer-lobby"
 
@@ -81,11 +82,12 @@ func main() {
 	}
 
 	lobbyManager := lobby.NewLobbyManagerWithEvents(events)
+	lobbyManager.DisconnectGrace = 30 * time.Second
 
 	deps := &lobby.HandlerDeps{
 		SessionManager: sessionManager,
 		LobbyManager:   lobbyManager,
-		ConnToUserID:   make(map[interface{}]string),
+		ConnToUserID:   lobby.NewConnRegistry(0),
 	}
 
 	router := lobby.NewMessageRouter()
@@ -120,13 +122,17 @@ func main() {
 				log.Printf("Dispatch error: %v", err)
 			}
 
-			if newUserID, ok := deps.ConnToUserID[ws]; ok && userID == "" {
+			if newUserID, ok := deps.ConnToUserID.Get(ws); ok && userID == "" {
 				userID = newUserID
 				connMgr.Add(userID, ws)
 			}
 		}
 
+		deps.ConnToUserID.Remove(ws)
 		if userID != "" {
+			if lobbyID, ok := sessionManager.GetLobbyID(userID); ok && lobbyID != "" {
+				lobbyManager.DisconnectPlayer(lobby.LobbyID(lobbyID), lobby.PlayerID(userID))
+			}
 			connMgr.Remove(userID)
 			sessionManager.RemoveSession(userID)
 		}
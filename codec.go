@@ -0,0 +1,122 @@
+package lobby
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Compression names a payload compression scheme a client can negotiate.
+type Compression string
+
+const (
+	CompressionNone    Compression = ""
+	CompressionGzip    Compression = "gzip"
+	CompressionDeflate Compression = "deflate"
+)
+
+// RawConn is implemented by connections that can send pre-encoded payloads, e.g. as binary
+// WebSocket frames. compressed tells the transport whether data is compressed JSON.
+type RawConn interface {
+	Conn
+	WriteRaw(data []byte, compressed bool) error
+}
+
+// Codec encodes outgoing messages, compressing those at least Threshold bytes long when the
+// client negotiated compression. Smaller payloads are sent as plain JSON, where compression
+// costs more than it saves.
+type Codec struct {
+	Threshold int
+}
+
+// Negotiate picks the compression to use from the schemes a client accepts, preferring gzip.
+// A nil Codec disables compression.
+func (c *Codec) Negotiate(accepted []string) Compression {
+	if c == nil {
+		return CompressionNone
+	}
+	for _, preferred := range []Compression{CompressionGzip, CompressionDeflate} {
+		for _, name := range accepted {
+			if Compression(name) == preferred {
+				return preferred
+			}
+		}
+	}
+	return CompressionNone
+}
+
+// Encode marshals v to JSON and compresses it if compression is set and the JSON reaches
+// Threshold. It reports whether the returned bytes are compressed.
+func (c *Codec) Encode(v interface{}, compression Compression) ([]byte, bool, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	if compression == CompressionNone || len(data) < c.Threshold {
+		return data, false, nil
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return nil, false, fmt.Errorf("unsupported compression %q", compression)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// Decompress reverses Encode for a compressed payload, returning the JSON bytes.
+func Decompress(data []byte, compression Compression) ([]byte, error) {
+	var r io.ReadCloser
+	switch compression {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case CompressionDeflate:
+		r = flate.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WrapConn returns a Conn that sends messages through Encode when conn supports WriteRaw and
+// compression was negotiated, and conn itself otherwise.
+func (c *Codec) WrapConn(conn Conn, compression Compression) Conn {
+	raw, ok := conn.(RawConn)
+	if c == nil || !ok || compression == CompressionNone {
+		return conn
+	}
+	return &compressingConn{RawConn: raw, codec: c, compression: compression}
+}
+
+// compressingConn encodes every WriteJSON with its codec and sends it via WriteRaw.
+type compressingConn struct {
+	RawConn
+	codec       *Codec
+	compression Compression
+}
+
+func (c *compressingConn) WriteJSON(v interface{}) error {
+	data, compressed, err := c.codec.Encode(v, c.compression)
+	if err != nil {
+		return err
+	}
+	return c.WriteRaw(data, compressed)
+}
@@ -0,0 +1,41 @@
+package lobby
+
+import "time"
+
+// DefaultConnectionInfoInterval is used when LobbyManager.ConnectionInfoInterval is unset.
+const DefaultConnectionInfoInterval = 2 * time.Second
+
+// ConnectionInfo describes the quality of a player's connection, for ping badges.
+type ConnectionInfo struct {
+	PingMs int    `json:"ping_ms"`
+	Region string `json:"region,omitempty"`
+}
+
+// SetPlayerConnectionInfo records a player's connection quality, typically from heartbeat RTT
+// measured by the transport. The lobby is told at most once per ConnectionInfoInterval; updates
+// in between are stored and go out with the next broadcast.
+func (m *LobbyManager) SetPlayerConnectionInfo(lobbyID LobbyID, playerID PlayerID, info ConnectionInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	player := findPlayer(lobby, playerID)
+	if player == nil {
+		return ErrPlayerNotInLobby(string(playerID), string(lobbyID))
+	}
+	player.Connection = &info
+
+	interval := m.ConnectionInfoInterval
+	if interval <= 0 {
+		interval = DefaultConnectionInfoInterval
+	}
+	now := time.Now()
+	if now.Sub(lobby.lastConnectionBroadcast) < interval {
+		return nil
+	}
+	lobby.lastConnectionBroadcast = now
+	m.broadcastLobbyState(lobby, ReasonConnectionInfo)
+	return nil
+}
@@ -0,0 +1,89 @@
+package lobby
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ConnRegistry maps live connections to the user IDs they authenticated as. It is safe for
+// concurrent use. Transports must Remove a connection when it closes; MaxSize bounds the
+// damage when that is missed, e.g. after a panic.
+type ConnRegistry struct {
+	mu      sync.Mutex
+	entries map[Conn]*list.Element
+	order   *list.List // Oldest registration at the front
+
+	// MaxSize caps how many connections are tracked (default: 0, unlimited). Adding a
+	// connection beyond it evicts the least recently added one.
+	MaxSize int
+
+	// OnEvict, when set, is called with a connection dropped to honour MaxSize, e.g. to close it.
+	// It runs under the registry lock and must not call back into the registry.
+	OnEvict func(conn Conn, userID string)
+}
+
+type connEntry struct {
+	conn   Conn
+	userID string
+}
+
+// NewConnRegistry creates a registry holding at most maxSize connections, or any number for 0.
+func NewConnRegistry(maxSize int) *ConnRegistry {
+	return &ConnRegistry{
+		entries: make(map[Conn]*list.Element),
+		order:   list.New(),
+		MaxSize: maxSize,
+	}
+}
+
+// Add records that conn belongs to userID. Adding a connection again updates its user and
+// counts as its most recent registration.
+func (r *ConnRegistry) Add(conn Conn, userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if elem, exists := r.entries[conn]; exists {
+		elem.Value.(*connEntry).userID = userID
+		r.order.MoveToBack(elem)
+		return
+	}
+	r.entries[conn] = r.order.PushBack(&connEntry{conn: conn, userID: userID})
+	for r.MaxSize > 0 && len(r.entries) > r.MaxSize {
+		oldest := r.order.Front().Value.(*connEntry)
+		r.removeLocked(oldest.conn)
+		if r.OnEvict != nil {
+			r.OnEvict(oldest.conn, oldest.userID)
+		}
+	}
+}
+
+// Remove forgets a connection, typically when it closes.
+func (r *ConnRegistry) Remove(conn Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(conn)
+}
+
+func (r *ConnRegistry) removeLocked(conn Conn) {
+	if elem, exists := r.entries[conn]; exists {
+		r.order.Remove(elem)
+		delete(r.entries, conn)
+	}
+}
+
+// Get returns the user a connection belongs to, and whether it is registered.
+func (r *ConnRegistry) Get(conn Conn) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elem, exists := r.entries[conn]
+	if !exists {
+		return "", false
+	}
+	return elem.Value.(*connEntry).userID, true
+}
+
+// Count returns how many connections are registered.
+func (r *ConnRegistry) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
@@ -0,0 +1,151 @@
+package lobby
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultReadyCountdownTick is how often ready_countdown is broadcast while a countdown runs.
+const DefaultReadyCountdownTick = time.Second
+
+// ReadyCountdownResponse is broadcast to a lobby's players and spectators when a ready
+// countdown starts, on every tick while it runs, and once more if it is cancelled.
+type ReadyCountdownResponse struct {
+	Action    string    `json:"action"`
+	LobbyID   string    `json:"lobby_id"`
+	EndsAt    time.Time `json:"ends_at"`
+	Remaining int       `json:"remaining"` // Whole seconds left, rounded up
+	Cancelled bool      `json:"cancelled,omitempty"`
+}
+
+// readyCountdown is a running StartReadyCountdown. done is closed once its goroutine exits.
+type readyCountdown struct {
+	endsAt time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartReadyCountdown gives a waiting lobby's players duration to get ready, broadcasting
+// ready_countdown every ReadyCountdownTick so clients can show the timer. When it expires
+// onTimeout runs with a snapshot of the lobby, outside the manager lock, and decides what
+// happens next: typically StartGame, or KickPlayer for each player still unready.
+//
+// The lobby must have at least its minimum players and no countdown already running. The
+// countdown is cancelled, without calling onTimeout, if a leave drops the lobby below its
+// minimum, the lobby leaves the waiting state, it is deleted, or CancelReadyCountdown is called.
+func (m *LobbyManager) StartReadyCountdown(lobbyID LobbyID, duration time.Duration, onTimeout func(*Lobby)) error {
+	if duration <= 0 {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Countdown duration must be positive")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if lobby.State != LobbyWaiting {
+		return ErrLobbyNotWaiting(string(lobbyID))
+	}
+	if lobby.countdown != nil {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Ready countdown already running")
+	}
+	if len(lobby.Players) < m.minPlayers(lobby) {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Not enough players for a countdown")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	countdown := &readyCountdown{endsAt: time.Now().Add(duration), cancel: cancel, done: make(chan struct{})}
+	lobby.countdown = countdown
+	m.broadcastCountdown(lobby, countdown, false)
+	go m.runReadyCountdown(ctx, lobby, countdown, onTimeout)
+	return nil
+}
+
+// CancelReadyCountdown stops the lobby's ready countdown, if any, without calling its
+// onTimeout. It reports whether a countdown was running.
+func (m *LobbyManager) CancelReadyCountdown(lobbyID LobbyID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists || lobby.countdown == nil {
+		return false
+	}
+	m.cancelCountdownLocked(lobby)
+	return true
+}
+
+// runReadyCountdown ticks a countdown until it expires or its context is cancelled.
+func (m *LobbyManager) runReadyCountdown(ctx context.Context, lobby *Lobby, countdown *readyCountdown, onTimeout func(*Lobby)) {
+	defer close(countdown.done)
+	tick := m.ReadyCountdownTick
+	if tick <= 0 {
+		tick = DefaultReadyCountdownTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(countdown.endsAt))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			if lobby.countdown == countdown {
+				m.broadcastCountdown(lobby, countdown, false)
+			}
+			m.mu.Unlock()
+		case <-timer.C:
+			m.mu.Lock()
+			if lobby.countdown != countdown {
+				m.mu.Unlock()
+				return // Cancelled while the timer fired
+			}
+			lobby.countdown = nil
+			snapshot := snapshotLobby(lobby)
+			m.mu.Unlock()
+			countdown.cancel()
+			if onTimeout != nil {
+				onTimeout(snapshot)
+			}
+			return
+		}
+	}
+}
+
+// cancelCountdownLocked stops the lobby's countdown and tells clients. Caller must hold the
+// lobby's lock.
+func (m *LobbyManager) cancelCountdownLocked(lobby *Lobby) {
+	countdown := lobby.countdown
+	if countdown == nil {
+		return
+	}
+	lobby.countdown = nil
+	countdown.cancel()
+	m.broadcastCountdown(lobby, countdown, true)
+}
+
+// broadcastCountdown sends the countdown's remaining time to players and spectators.
+func (m *LobbyManager) broadcastCountdown(lobby *Lobby, countdown *readyCountdown, cancelled bool) {
+	if !m.canBroadcast() {
+		return
+	}
+	remaining := time.Until(countdown.endsAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	msg := ReadyCountdownResponse{
+		Action:    "ready_countdown",
+		LobbyID:   string(lobby.ID),
+		EndsAt:    countdown.endsAt,
+		Remaining: int((remaining + time.Second - 1) / time.Second),
+		Cancelled: cancelled,
+	}
+	for _, p := range lobby.Players {
+		m.deliver(string(p.ID), msg)
+	}
+	for _, s := range lobby.Spectators {
+		m.deliver(string(s.ID), msg)
+	}
+}
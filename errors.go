@@ -1,6 +1,9 @@
 package lobby
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // ErrorCode represents a specific error type
 type ErrorCode string
@@ -13,6 +16,8 @@ const (
 	ErrorCodeInvalidUsername ErrorCode = "INVALID_USERNAME"
 	ErrorCodeInvalidToken    ErrorCode = "INVALID_TOKEN"
 	ErrorCodeUnauthorized    ErrorCode = "UNAUTHORIZED"
+	ErrorCodeSessionExpired  ErrorCode = "SESSION_EXPIRED"
+	ErrorCodeTooManyAttempts ErrorCode = "TOO_MANY_ATTEMPTS"
 
 	// Lobby-related errors
 	ErrorCodeLobbyNotFound        ErrorCode = "LOBBY_NOT_FOUND"
@@ -22,16 +27,24 @@ const (
 	ErrorCodePlayerAlreadyInLobby ErrorCode = "PLAYER_ALREADY_IN_LOBBY"
 	ErrorCodeLobbyAlreadyExists   ErrorCode = "LOBBY_ALREADY_EXISTS"
 	ErrorCodeLobbyExists          ErrorCode = "LOBBY_EXISTS"
+	ErrorCodeSpectatorsFull       ErrorCode = "SPECTATORS_FULL"
+	ErrorCodeTeamFull             ErrorCode = "TEAM_FULL"
+	ErrorCodeLobbyLocked          ErrorCode = "LOBBY_LOCKED"
+	ErrorCodeNoMatchingLobby      ErrorCode = "NO_MATCHING_LOBBY"
+	ErrorCodeKickCooldown         ErrorCode = "KICK_COOLDOWN"
+	ErrorCodeBanned               ErrorCode = "BANNED"
 
 	// Game-related errors
 	ErrorCodeNotEnoughPlayers   ErrorCode = "NOT_ENOUGH_PLAYERS"
 	ErrorCodeNotAllPlayersReady ErrorCode = "NOT_ALL_PLAYERS_READY"
 	ErrorCodeCannotStartGame    ErrorCode = "CANNOT_START_GAME"
+	ErrorCodeStartBlocked       ErrorCode = "START_BLOCKED"
 
 	// Message-related errors
 	ErrorCodeInvalidMessage ErrorCode = "INVALID_MESSAGE"
 	ErrorCodeUnknownAction  ErrorCode = "UNKNOWN_ACTION"
 	ErrorCodeInvalidRequest ErrorCode = "INVALID_REQUEST"
+	ErrorCodeRateLimited    ErrorCode = "RATE_LIMITED"
 
 	// System errors
 	ErrorCodeInternalError      ErrorCode = "INTERNAL_ERROR"
@@ -63,6 +76,15 @@ func (e *LobbyError) ToErrorResponse() ErrorResponse {
 	}
 }
 
+// toErrorResponse converts err to an ErrorResponse, keeping the code of a *LobbyError
+// and reporting any other error as an internal error.
+func toErrorResponse(err error) ErrorResponse {
+	if lobbyErr, ok := err.(*LobbyError); ok {
+		return lobbyErr.ToErrorResponse()
+	}
+	return NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse()
+}
+
 // NewLobbyError creates a new structured error
 func NewLobbyError(code ErrorCode, message string) *LobbyError {
 	return &LobbyError{
@@ -96,23 +118,100 @@ func ErrUsernameTaken(username string) *LobbyError {
 func ErrInvalidToken(action string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeInvalidToken, "Invalid session token", fmt.Sprintf("Action: %s", action))
 }
+// ErrSessionExpired returns an error for reconnection attempts whose session no longer exists.
+func ErrSessionExpired(username string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeSessionExpired, "Session has expired, please register again", fmt.Sprintf("Username: %s", username))
+}
+// ErrTooManyAttempts returns an error for reconnection attempts made while locked out.
+func ErrTooManyAttempts(username string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeTooManyAttempts, "Too many failed attempts, try again later", fmt.Sprintf("Username: %s", username))
+}
 // ErrUnauthorized returns an error for unauthorized access.
 func ErrUnauthorized(action string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeUnauthorized, "Unauthorized access", fmt.Sprintf("Action: %s", action))
 }
+// ErrMuted returns an error for when a player muted in chat tries to send a message.
+func ErrMuted(until time.Time) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeUnauthorized, "Muted in chat", fmt.Sprintf("Muted until: %s", until.Format(time.RFC3339)))
+}
+// ErrRateLimited returns an error for when a player sends more chat messages than ChatRateLimit allows.
+func ErrRateLimited(limit int, window time.Duration) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeRateLimited, "Sending messages too fast", fmt.Sprintf("Limit: %d per %s", limit, window))
+}
 // ErrLobbyNotFound returns an error for when a lobby is not found.
 func ErrLobbyNotFound(lobbyID string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeLobbyNotFound, "Lobby not found", fmt.Sprintf("Lobby ID: %s", lobbyID))
 }
+// ErrLobbyNameNotFound returns an error for when no lobby has the given name.
+func ErrLobbyNameNotFound(name string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeLobbyNotFound, "Lobby not found", fmt.Sprintf("Lobby name: %s", name))
+}
+// ErrLobbyNameAmbiguous returns an error for when several lobbies share the given name.
+func ErrLobbyNameAmbiguous(name string, matches int) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeLobbyNotFound, "Lobby not found", fmt.Sprintf("Lobby name %s matches %d lobbies", name, matches))
+}
 // ErrLobbyFull returns an error for when a lobby is at capacity.
 func ErrLobbyFull(lobbyID string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeLobbyFull, "Lobby is full", fmt.Sprintf("Lobby ID: %s", lobbyID))
 }
+// ErrKickCooldown returns an error for when a kicked player tries to rejoin before KickCooldown has passed.
+func ErrKickCooldown(lobbyID string, until time.Time) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeKickCooldown, "Kicked from this lobby", fmt.Sprintf("Lobby ID: %s, can rejoin at: %s", lobbyID, until.Format(time.RFC3339)))
+}
+// ErrPlayerBanned returns an error for when a banned player tries to join or spectate a lobby.
+func ErrPlayerBanned(lobbyID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeBanned, "Banned from this lobby", fmt.Sprintf("Lobby ID: %s", lobbyID))
+}
+// ErrTeamsFull returns an error for when every team is full although MaxPlayers is not reached.
+func ErrTeamsFull(lobbyID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeTeamFull, "All teams are full", fmt.Sprintf("Lobby ID: %s", lobbyID))
+}
+// ErrTeamFull returns an error for when a player asks to join a team that has no room left.
+func ErrTeamFull(team int) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeTeamFull, "Team is full", fmt.Sprintf("Team: %d", team))
+}
+// ErrTooManyGames returns an error for when a start would exceed MaxConcurrentGames.
+func ErrTooManyGames(max int) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeServiceUnavailable, "Too many games in progress, try again later", fmt.Sprintf("Max concurrent games: %d", max))
+}
+// ErrRandomness returns an error for when the randomness source fails while generating an ID or token.
+func ErrRandomness(err error) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeInternalError, "Could not generate a random value", err.Error())
+}
+// ErrTooManySessions returns an error for when MaxSessions is reached and every session is active.
+func ErrTooManySessions(max int) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeServiceUnavailable, "Too many sessions, try again later", fmt.Sprintf("Max sessions: %d", max))
+}
+// ErrSpectatorsFull returns an error for when a lobby has no spectator places left.
+func ErrSpectatorsFull(lobbyID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeSpectatorsFull, "Lobby has no room for spectators", fmt.Sprintf("Lobby ID: %s", lobbyID))
+}
+// ErrReadyLocked returns an error for when the owner has frozen ready status in a lobby.
+func ErrReadyLocked(lobbyID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeLobbyLocked, "Ready status is locked", fmt.Sprintf("Lobby ID: %s", lobbyID))
+}
+// ErrNoMatchingLobby returns an error for when QuickJoin finds no open lobby to join.
+func ErrNoMatchingLobby() *LobbyError {
+	return NewLobbyError(ErrorCodeNoMatchingLobby, "No open lobby matches")
+}
+// ErrLobbyNotWaiting returns an error for when a lobby does not accept joins in its current state.
+func ErrLobbyNotWaiting(lobbyID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeLobbyNotWaiting, "Lobby is not accepting players", fmt.Sprintf("Lobby ID: %s", lobbyID))
+}
 // ErrPlayerNotInLobby returns an error for when a player is not in a lobby.
 func ErrPlayerNotInLobby(playerID, lobbyID string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodePlayerNotInLobby, "Player not in lobby",
 		fmt.Sprintf("Player ID: %s, Lobby ID: %s", playerID, lobbyID))
 }
+// ErrPlayerAlreadyInLobby returns an error for when a player cannot join any more lobbies.
+func ErrPlayerAlreadyInLobby(playerID string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodePlayerAlreadyInLobby, "Player is already in the maximum number of lobbies",
+		fmt.Sprintf("Player ID: %s", playerID))
+}
+// ErrLobbyAlreadyExists returns an error for when a lobby with the same ID or name already exists.
+func ErrLobbyAlreadyExists(name string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeLobbyAlreadyExists, "Lobby already exists", fmt.Sprintf("Lobby name: %s", name))
+}
 // ErrNotEnoughPlayers returns an error for insufficient players to start.
 func ErrNotEnoughPlayers(required, actual int) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeNotEnoughPlayers, "Not enough players to start game",
@@ -122,6 +221,10 @@ func ErrNotEnoughPlayers(required, actual int) *LobbyError {
 func ErrNotAllPlayersReady() *LobbyError {
 	return NewLobbyError(ErrorCodeNotAllPlayersReady, "All players must be ready to start the game")
 }
+// ErrStartBlocked returns an error for when an external check prevents the game from starting.
+func ErrStartBlocked(reason string) *LobbyError {
+	return NewLobbyErrorWithDetails(ErrorCodeStartBlocked, "Game start blocked by external check", reason)
+}
 // ErrInvalidMessage returns an error for invalid message format.
 func ErrInvalidMessage(action string) *LobbyError {
 	return NewLobbyErrorWithDetails(ErrorCodeInvalidMessage, "Invalid message format",
@@ -3,6 +3,15 @@ package lobby
 // Broadcaster sends a message to a user by their userID.
 type Broadcaster func(userID string, message interface{})
 
+// ReliableBroadcaster sends a message to a user and reports whether delivery failed.
+type ReliableBroadcaster func(userID string, message interface{}) error
+
+// DeliveryReceipt records the outcome of delivering a message to one user. Err is nil on success.
+type DeliveryReceipt struct {
+	UserID string
+	Err    error
+}
+
 // LobbyEvents holds callbacks for lobby-related events.
 type LobbyEvents struct {
 	OnPlayerJoin       func(lobby *Lobby, player *Player)
@@ -13,16 +22,125 @@ type LobbyEvents struct {
 	OnLobbyDeleted     func(lobby *Lobby)
 	OnLobbyStateChange func(lobby *Lobby)
 	Broadcaster        Broadcaster
-	LobbyStateBuilder  func(lobby *Lobby) interface{}
+	LobbyStateBuilder  func(lobby *Lobby) interface{} // Gets a snapshot. Default: ResponseBuilder.BuildLobbyStateResponse
 	CanStartGame       func(lobby *Lobby, userID string) bool
+
+	// ReliableBroadcaster, when set, is used instead of Broadcaster so delivery failures can be reported.
+	ReliableBroadcaster ReliableBroadcaster
+	// OnDeliveryReport receives per-user receipts for critical broadcasts such as game_started.
+	OnDeliveryReport func(lobby *Lobby, message interface{}, receipts []DeliveryReceipt)
+	// OnLobbyThreshold fires when a join raises a lobby's fill fraction to or past one of the
+	// manager's FillThresholds. Leaves never fire it.
+	OnLobbyThreshold func(lobby *Lobby, fraction float64)
+	// OwnerChangedBuilder, when set, replaces the default OwnerChangedResponse sent after an
+	// ownership transfer. The lobby already carries the new OwnerID.
+	OwnerChangedBuilder func(lobby *Lobby, previousOwnerID string) interface{}
+	// OnOwnerIdle fires when SweepIdleOwners finds an idle owner, just before they are removed.
+	OnOwnerIdle func(lobby *Lobby, owner *Player)
+	// OnLobbyCreate runs inside CreateLobby before the lobby is stored, e.g. to provision a voice
+	// channel or match ID. Returning an error aborts creation and is returned to the caller.
+	// Unlike OnLobbyStateChange it only fires for new lobbies and can veto them.
+	OnLobbyCreate func(lobby *Lobby) error
+	// Counters, when set, counts joins, leaves, readies, starts and deletions.
+	Counters *EventCounters
+	// OutgoingTransform, when set, rewrites every message just before it is delivered to a
+	// user, e.g. to inject a server region or redact fields. Use OutgoingTransformMiddleware to
+	// apply it to handler responses too.
+	OutgoingTransform func(userID string, message interface{}) interface{}
+	// OnPlayerKicked fires after KickPlayer removes a player, following OnPlayerLeave.
+	OnPlayerKicked func(lobby *Lobby, player *Player, kickedBy string)
+	// PlayerPrivateStateBuilder, when set, builds each player's private slice of a lobby_state
+	// broadcast (their hand, their role), sent to that player alone in the Private field.
+	// Spectators and handler replies get the shared state only, as do broadcasts whose
+	// LobbyStateBuilder returns something other than a LobbyStateResponse.
+	PlayerPrivateStateBuilder func(lobby *Lobby, player *Player) interface{}
+	// OnGameStart fires when a lobby enters LobbyInGame, whether from StartGame, auto-start or
+	// SetLobbyState, and OnGameEnd when SetLobbyState moves it to LobbyFinished. Both get a
+	// snapshot of the lobby and run after OnLobbyStateChange and before the lobby_state
+	// broadcast, so game_started reaches players after OnGameStart has returned.
+	OnGameStart func(lobby *Lobby)
+	OnGameEnd   func(lobby *Lobby)
 }
 
 // BroadcastToLobby sends a message to all players in the lobby using the registered Broadcaster.
 func (m *LobbyManager) BroadcastToLobby(l *Lobby, message interface{}) {
-	if m.Events == nil || m.Events.Broadcaster == nil {
+	if !m.canBroadcast() {
+		return
+	}
+	for _, player := range l.Players {
+		m.deliver(string(player.ID), message)
+	}
+}
+
+// BroadcastFiltered sends a message to every player in the lobby for which pred returns true.
+func (m *LobbyManager) BroadcastFiltered(l *Lobby, pred func(player *Player) bool, message interface{}) {
+	if !m.canBroadcast() {
 		return
 	}
 	for _, player := range l.Players {
-		m.Events.Broadcaster(string(player.ID), message)
+		if pred(player) {
+			m.deliver(string(player.ID), message)
+		}
+	}
+}
+
+// BroadcastToLobbyExcept sends a message to all players in the lobby except excludeID,
+// typically the player whose action triggered it.
+func (m *LobbyManager) BroadcastToLobbyExcept(l *Lobby, excludeID PlayerID, message interface{}) {
+	m.BroadcastFiltered(l, func(player *Player) bool {
+		return player.ID != excludeID
+	}, message)
+}
+
+// BroadcastToOwner sends a message to the lobby owner if they are in the lobby.
+func (m *LobbyManager) BroadcastToOwner(l *Lobby, message interface{}) {
+	m.BroadcastFiltered(l, func(player *Player) bool {
+		return string(player.ID) == l.OwnerID
+	}, message)
+}
+
+// canBroadcast reports whether any broadcaster is registered.
+func (m *LobbyManager) canBroadcast() bool {
+	return m.Events != nil && (m.Events.Broadcaster != nil || m.Events.ReliableBroadcaster != nil)
+}
+
+// deliver sends a message to one user, or queues it for the event worker under AsyncEvents,
+// in which case delivery errors are not seen.
+func (m *LobbyManager) deliver(userID string, message interface{}) error {
+	if m.AsyncEvents {
+		m.enqueueEvent(func() { m.deliverNow(userID, message) })
+		return nil
+	}
+	return m.deliverNow(userID, message)
+}
+
+// deliverNow sends a message to one user, preferring the ReliableBroadcaster when one is set.
+func (m *LobbyManager) deliverNow(userID string, message interface{}) error {
+	if m.Events.OutgoingTransform != nil {
+		message = m.Events.OutgoingTransform(userID, message)
+	}
+	if m.Events.ReliableBroadcaster != nil {
+		return m.Events.ReliableBroadcaster(userID, message)
+	}
+	m.Events.Broadcaster(userID, message)
+	return nil
+}
+
+// broadcastCritical sends a message to all players and reports per-user delivery via OnDeliveryReport.
+func (m *LobbyManager) broadcastCritical(l *Lobby, message interface{}) {
+	if !m.canBroadcast() {
+		return
 	}
+	// Deliver and report as one event so AsyncEvents still collects the receipts.
+	report := m.Events.OnDeliveryReport
+	m.emit(l, func(l *Lobby) {
+		receipts := make([]DeliveryReceipt, 0, len(l.Players))
+		for _, player := range l.Players {
+			err := m.deliverNow(string(player.ID), message)
+			receipts = append(receipts, DeliveryReceipt{UserID: string(player.ID), Err: err})
+		}
+		if report != nil {
+			report(l, message, receipts)
+		}
+	})
 }
@@ -0,0 +1,909 @@
+package lobby
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingBroadcaster captures broadcast messages per user.
+type recordingBroadcaster struct {
+	mu       sync.Mutex
+	messages map[string][]interface{}
+}
+
+func newRecordingBroadcaster() *recordingBroadcaster {
+	return &recordingBroadcaster{messages: make(map[string][]interface{})}
+}
+
+func (r *recordingBroadcaster) broadcast(userID string, message interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[userID] = append(r.messages[userID], message)
+}
+
+func (r *recordingBroadcaster) received(userID string) []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]interface{}(nil), r.messages[userID]...)
+}
+
+func (r *recordingBroadcaster) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = make(map[string][]interface{})
+}
+
+func TestBroadcastFilters(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	rec.reset()
+
+	manager.BroadcastToLobbyExcept(lobby, "player2", "readied")
+	if len(rec.received("player2")) != 0 {
+		t.Error("Excluded player should not receive the message")
+	}
+	if len(rec.received("player1")) != 1 || len(rec.received("player3")) != 1 {
+		t.Error("Other players should receive the message")
+	}
+
+	rec.reset()
+	manager.BroadcastToOwner(lobby, "owner only")
+	if len(rec.received("player1")) != 1 || len(rec.received("player2")) != 0 || len(rec.received("player3")) != 0 {
+		t.Error("Only the owner should receive the message")
+	}
+
+	rec.reset()
+	manager.BroadcastFiltered(lobby, func(p *Player) bool { return p.Username == "Carol" }, "filtered")
+	if len(rec.received("player3")) != 1 || len(rec.received("player1")) != 0 {
+		t.Error("Only players matching the predicate should receive the message")
+	}
+}
+
+func lastReason(t *testing.T, rec *recordingBroadcaster, userID string) string {
+	t.Helper()
+	msgs := rec.received(userID)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if resp, ok := msgs[i].(LobbyStateResponse); ok {
+			return resp.Reason
+		}
+	}
+	t.Fatalf("No lobby_state received by %s", userID)
+	return ""
+}
+
+func TestBroadcastReasons(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	events := &LobbyEvents{Broadcaster: rec.broadcast}
+	manager := NewLobbyManagerWithEvents(events)
+	builder := NewResponseBuilder(manager)
+	events.LobbyStateBuilder = func(l *Lobby) interface{} { return builder.BuildLobbyStateResponse(l) }
+
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	if reason := lastReason(t, rec, "player1"); reason != ReasonPlayerJoined {
+		t.Errorf("Expected %s, got %s", ReasonPlayerJoined, reason)
+	}
+
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+	if reason := lastReason(t, rec, "player1"); reason != ReasonPlayerReady {
+		t.Errorf("Expected %s, got %s", ReasonPlayerReady, reason)
+	}
+
+	manager.LeaveLobby(lobby.ID, "player2")
+	if reason := lastReason(t, rec, "player1"); reason != ReasonPlayerLeft {
+		t.Errorf("Expected %s, got %s", ReasonPlayerLeft, reason)
+	}
+
+	manager.StartGame(lobby.ID, "player1")
+	if reason := lastReason(t, rec, "player1"); reason != ReasonGameStarted {
+		t.Errorf("Expected %s, got %s", ReasonGameStarted, reason)
+	}
+}
+
+func TestLobbyThresholdEvents(t *testing.T) {
+	var crossed []float64
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnLobbyThreshold: func(l *Lobby, fraction float64) {
+			crossed = append(crossed, fraction)
+		},
+	})
+	manager.FillThresholds = []float64{0.5, 0.75}
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	if len(crossed) != 0 {
+		t.Fatalf("Expected no thresholds at 1/4, got %v", crossed)
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	if len(crossed) != 2 || crossed[0] != 0.5 || crossed[1] != 0.75 {
+		t.Fatalf("Expected thresholds [0.5 0.75], got %v", crossed)
+	}
+
+	// Leaving never fires; only crossing upward again does
+	manager.LeaveLobby(lobby.ID, "player3")
+	if len(crossed) != 2 {
+		t.Fatalf("Expected no threshold on leave, got %v", crossed)
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "player4", Username: "Dave"})
+	if len(crossed) != 3 || crossed[2] != 0.75 {
+		t.Errorf("Expected 0.75 to fire again on re-crossing, got %v", crossed)
+	}
+}
+
+func TestOwnerChangedBroadcast(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	manager.Events.LobbyStateBuilder = func(l *Lobby) interface{} {
+		return NewResponseBuilder(manager).BuildLobbyStateResponse(l)
+	}
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	rec.reset()
+
+	manager.LeaveLobby(lobby.ID, "player1")
+	received := rec.received("player2")
+	if len(received) != 2 {
+		t.Fatalf("Expected lobby state and owner_changed, got %#v", received)
+	}
+	state, ok := received[0].(LobbyStateResponse)
+	if !ok || len(state.Players) != 1 || !state.Players[0].CanStartGame || state.Players[0].Role != RoleOwner {
+		t.Errorf("Expected state to reflect the new owner's start permission, got %#v", received[0])
+	}
+	changed, ok := received[1].(OwnerChangedResponse)
+	if !ok || changed.NewOwnerID != "player2" || changed.PreviousOwnerID != "player1" {
+		t.Errorf("Expected owner_changed from player1 to player2, got %#v", received[1])
+	}
+
+	// A non-owner leaving does not announce an owner change
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	rec.reset()
+	manager.LeaveLobby(lobby.ID, "player3")
+	for _, msg := range rec.received("player2") {
+		if _, ok := msg.(OwnerChangedResponse); ok {
+			t.Error("Unexpected owner_changed when a non-owner leaves")
+		}
+	}
+}
+
+func TestRemovedFromLobbyReasons(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	lastRemoval := func(userID string) string {
+		t.Helper()
+		var reason string
+		for _, msg := range rec.received(userID) {
+			if removed, ok := msg.(RemovedFromLobbyResponse); ok {
+				reason = removed.Reason
+			}
+		}
+		return reason
+	}
+
+	// Shutdown: the server deletes the lobby
+	closing, _ := manager.CreateLobby("Closing", 4, true, nil, "player1")
+	manager.JoinLobby(closing.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.DeleteLobby(closing.ID)
+	if got := lastRemoval("player1"); got != RemovalShutdown {
+		t.Errorf("Expected %q on delete, got %q", RemovalShutdown, got)
+	}
+
+	// Idle: the idle-owner sweep drops a silent owner
+	rec.reset()
+	idle, _ := manager.CreateLobby("Idle", 4, true, nil, "player1")
+	manager.JoinLobby(idle.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(idle.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SweepIdleOwners(func(userID string) (time.Time, bool) {
+		return time.Now().Add(-time.Hour), true
+	}, time.Minute)
+	if got := lastRemoval("player1"); got != RemovalIdle {
+		t.Errorf("Expected %q from idle sweep, got %q", RemovalIdle, got)
+	}
+	if got := lastRemoval("player2"); got != "" {
+		t.Errorf("Remaining player should not be told they were removed, got %q", got)
+	}
+
+	// A voluntary leave sends no removal notice
+	rec.reset()
+	manager.LeaveLobby(idle.ID, "player2")
+	if got := lastRemoval("player2"); got != "" {
+		t.Errorf("Expected no removal notice on leave, got %q", got)
+	}
+}
+
+func TestLobbyRemovedBroadcast(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	var deleted []LobbyID
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster:    rec.broadcast,
+		OnLobbyDeleted: func(l *Lobby) { deleted = append(deleted, l.ID) },
+	})
+	manager.WatchLobbyList("browser")
+	removed := func(userID string) []string {
+		var ids []string
+		for _, msg := range rec.received(userID) {
+			if resp, ok := msg.(LobbyRemovedResponse); ok {
+				ids = append(ids, resp.LobbyID)
+			}
+		}
+		return ids
+	}
+
+	// Auto-delete when the last player leaves
+	empty, _ := manager.CreateLobby("Empty", 4, true, nil, "player1")
+	manager.JoinLobby(empty.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.LeaveLobby(empty.ID, "player1")
+
+	// Explicit deletion with a member still inside
+	closed, _ := manager.CreateLobby("Closed", 4, true, nil, "player2")
+	manager.JoinLobby(closed.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.DeleteLobby(closed.ID)
+
+	// Idle sweep removing a lone owner
+	swept, _ := manager.CreateLobby("Swept", 4, true, nil, "player3")
+	manager.JoinLobby(swept.ID, &Player{ID: "player3", Username: "Carol"})
+	manager.SweepIdleOwners(func(string) (time.Time, bool) { return time.Now().Add(-time.Hour), true }, time.Minute)
+
+	if got := removed("browser"); len(got) != 3 || got[0] != string(empty.ID) || got[1] != string(closed.ID) || got[2] != string(swept.ID) {
+		t.Errorf("Expected watcher to hear about every deletion, got %v", got)
+	}
+	if got := removed("player2"); len(got) != 1 || got[0] != string(closed.ID) {
+		t.Errorf("Expected lingering member to hear about deletion, got %v", got)
+	}
+	if len(deleted) != 3 {
+		t.Errorf("Expected OnLobbyDeleted on every path, got %v", deleted)
+	}
+
+	manager.UnwatchLobbyList("browser")
+	rec.reset()
+	other, _ := manager.CreateLobby("Other", 4, true, nil, "player1")
+	manager.DeleteLobby(other.ID)
+	if got := removed("browser"); len(got) != 0 {
+		t.Errorf("Expected no messages after unwatching, got %v", got)
+	}
+}
+
+func TestOnLobbyCreateHook(t *testing.T) {
+	provisioned := map[LobbyID]string{}
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnLobbyCreate: func(l *Lobby) error {
+			if l.Name == "No Voice" {
+				return NewLobbyError(ErrorCodeServiceUnavailable, "Voice service unavailable")
+			}
+			provisioned[l.ID] = "voice-" + l.Name
+			l.Metadata = map[string]interface{}{"voice_channel": provisioned[l.ID]}
+			return nil
+		},
+	})
+
+	lobby, err := manager.CreateLobby("Arena", 4, true, nil, "owner1")
+	if err != nil {
+		t.Fatalf("CreateLobby failed: %v", err)
+	}
+	if lobby.Metadata["voice_channel"] != "voice-Arena" {
+		t.Errorf("Expected hook to provision a voice channel, got %v", lobby.Metadata)
+	}
+
+	_, err = manager.CreateLobby("No Voice", 4, true, nil, "owner1")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeServiceUnavailable {
+		t.Fatalf("Expected hook error to abort creation, got %v", err)
+	}
+	if _, exists := manager.GetLobbyByID("No Voice"); exists {
+		t.Error("Aborted lobby should not be stored")
+	}
+	if _, taken := manager.lobbyNames["No Voice"]; taken {
+		t.Error("Aborted lobby should not reserve its name")
+	}
+}
+
+func TestEventCounters(t *testing.T) {
+	counters := &EventCounters{}
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Counters: counters})
+	lobby, _ := manager.CreateLobby("Test Lobby", 8, true, nil, "player0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id PlayerID) {
+			defer wg.Done()
+			manager.JoinLobby(lobby.ID, &Player{ID: id, Username: string(id)})
+			manager.SetPlayerReady(lobby.ID, id, true)
+		}(PlayerID(fmt.Sprintf("player%d", i)))
+	}
+	wg.Wait()
+	manager.StartGame(lobby.ID, "player0")
+	for i := 0; i < 4; i++ {
+		manager.LeaveLobby(lobby.ID, PlayerID(fmt.Sprintf("player%d", i)))
+	}
+
+	expected := map[string]int64{"joins": 4, "leaves": 4, "readies": 4, "starts": 1, "deletions": 1}
+	if got := counters.Snapshot(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestSetPlayerConnectionInfo_Throttled(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	manager.ConnectionInfoInterval = time.Hour
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	rec.reset()
+
+	if err := manager.SetPlayerConnectionInfo(lobby.ID, "player1", ConnectionInfo{PingMs: 40, Region: "eu-west"}); err != nil {
+		t.Fatalf("SetPlayerConnectionInfo failed: %v", err)
+	}
+	if err := manager.SetPlayerConnectionInfo(lobby.ID, "player1", ConnectionInfo{PingMs: 55, Region: "eu-west"}); err != nil {
+		t.Fatalf("SetPlayerConnectionInfo failed: %v", err)
+	}
+
+	msgs := rec.received("player1")
+	if len(msgs) != 1 {
+		t.Fatalf("Expected one throttled broadcast, got %d", len(msgs))
+	}
+	state := msgs[0].(LobbyStateResponse)
+	if state.Reason != ReasonConnectionInfo {
+		t.Errorf("Expected reason %s, got %s", ReasonConnectionInfo, state.Reason)
+	}
+	if conn := state.Players[0].Connection; conn == nil || conn.PingMs != 40 || conn.Region != "eu-west" {
+		t.Errorf("Expected connection info in state, got %#v", conn)
+	}
+
+	// The throttled update is kept and surfaces in the next state.
+	latest := NewResponseBuilder(manager).BuildLobbyStateResponse(lobby)
+	if conn := latest.Players[0].Connection; conn == nil || conn.PingMs != 55 {
+		t.Errorf("Expected latest ping 55, got %#v", conn)
+	}
+
+	if err := manager.SetPlayerConnectionInfo(lobby.ID, "ghost", ConnectionInfo{}); err == nil {
+		t.Error("Expected error for player not in lobby")
+	}
+}
+
+func TestOutgoingTransform_Broadcasts(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: rec.broadcast,
+		OutgoingTransform: func(userID string, message interface{}) interface{} {
+			return map[string]interface{}{"region": "eu-west", "to": userID, "message": message}
+		},
+	})
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	rec.reset()
+
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+
+	for _, id := range []string{"player1", "player2"} {
+		msgs := rec.received(id)
+		if len(msgs) != 1 {
+			t.Fatalf("Expected one message for %s, got %d", id, len(msgs))
+		}
+		wrapped, ok := msgs[0].(map[string]interface{})
+		if !ok || wrapped["region"] != "eu-west" || wrapped["to"] != id {
+			t.Fatalf("Expected injected fields for %s, got %#v", id, msgs[0])
+		}
+		if _, ok := wrapped["message"].(LobbyStateResponse); !ok {
+			t.Errorf("Expected original lobby_state wrapped, got %#v", wrapped["message"])
+		}
+	}
+}
+
+func TestDedupeBroadcasts(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	manager.DedupeBroadcasts = true
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	rec.reset()
+
+	metadata := map[string]interface{}{"mode": "ffa"}
+	manager.UpdateLobbyMetadata(lobby.ID, metadata)
+	manager.UpdateLobbyMetadata(lobby.ID, map[string]interface{}{"mode": "ffa"})
+	if got := len(rec.received("player1")); got != 1 {
+		t.Fatalf("Expected the no-op update not to rebroadcast, got %d broadcasts", got)
+	}
+
+	// A change of reason alone is a different payload
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	manager.SetPlayerReady(lobby.ID, "player1", false)
+	manager.UpdateLobbyMetadata(lobby.ID, metadata)
+	if got := len(rec.received("player1")); got != 4 {
+		t.Errorf("Expected real changes to broadcast, got %d broadcasts", got)
+	}
+}
+
+func TestKickPlayer(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	var left, kicked []PlayerID
+	var kickedBy string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster:   rec.broadcast,
+		OnPlayerLeave: func(l *Lobby, p *Player) { left = append(left, p.ID) },
+		OnPlayerKicked: func(l *Lobby, p *Player, by string) {
+			kicked = append(kicked, p.ID)
+			kickedBy = by
+		},
+	})
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	rec.reset()
+
+	err := manager.KickPlayer(lobby.ID, "player2", "player3")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUnauthorized {
+		t.Fatalf("Expected UNAUTHORIZED for a non-owner, got %v", err)
+	}
+	err = manager.KickPlayer(lobby.ID, "player1", "ghost")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodePlayerNotInLobby {
+		t.Fatalf("Expected PLAYER_NOT_IN_LOBBY, got %v", err)
+	}
+
+	if err := manager.KickPlayer(lobby.ID, "player1", "player3"); err != nil {
+		t.Fatalf("KickPlayer failed: %v", err)
+	}
+	if len(lobby.Players) != 2 || findPlayer(lobby, "player3") != nil {
+		t.Fatalf("Expected player3 removed, got %d players", len(lobby.Players))
+	}
+	if !reflect.DeepEqual(left, []PlayerID{"player3"}) || !reflect.DeepEqual(kicked, []PlayerID{"player3"}) || kickedBy != "player1" {
+		t.Errorf("Expected OnPlayerLeave and OnPlayerKicked for player3 by player1, got %v %v %q", left, kicked, kickedBy)
+	}
+
+	msgs := rec.received("player3")
+	if len(msgs) != 1 {
+		t.Fatalf("Expected only the kick notice for the target, got %#v", msgs)
+	}
+	if notice, ok := msgs[0].(RemovedFromLobbyResponse); !ok || notice.Reason != RemovalKicked {
+		t.Errorf("Expected removed_from_lobby with reason kicked, got %#v", msgs[0])
+	}
+	if got := lastReason(t, rec, "player2"); got != ReasonPlayerKicked {
+		t.Errorf("Expected remaining players told %s, got %s", ReasonPlayerKicked, got)
+	}
+}
+
+func TestKickPlayer_Cooldown(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.KickCooldown = time.Minute
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	if err := manager.KickPlayer(lobby.ID, "player1", "player2"); err != nil {
+		t.Fatalf("KickPlayer failed: %v", err)
+	}
+	err := manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeKickCooldown {
+		t.Fatalf("Expected KICK_COOLDOWN when rejoining at once, got %v", err)
+	}
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"}); err != nil {
+		t.Errorf("Other players should still be able to join: %v", err)
+	}
+
+	lobby.kickedAt["player2"] = time.Now().Add(-time.Minute) // The cooldown has passed
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"}); err != nil {
+		t.Fatalf("Expected rejoin after the cooldown to succeed, got %v", err)
+	}
+
+	manager.KickCooldown = 0
+	manager.KickPlayer(lobby.ID, "player1", "player3")
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"}); err != nil {
+		t.Errorf("Without KickCooldown a kicked player may rejoin at once, got %v", err)
+	}
+}
+
+func TestKickPlayer_Moderator(t *testing.T) {
+	var kickedBy string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnPlayerKicked: func(l *Lobby, p *Player, by string) { kickedBy = by },
+	})
+	lobby, _ := manager.CreateLobby("Test Lobby", 5, true, nil, "player1")
+	for _, p := range []*Player{
+		{ID: "player1", Username: "Alice"},
+		{ID: "player2", Username: "Bob"},
+		{ID: "player3", Username: "Carol"},
+		{ID: "player4", Username: "Dave"},
+	} {
+		manager.JoinLobby(lobby.ID, p)
+	}
+	manager.AddModerator(lobby.ID, "player1", "player2")
+	manager.AddModerator(lobby.ID, "player1", "player3")
+
+	for _, target := range []PlayerID{"player1", "player3"} {
+		err := manager.KickPlayer(lobby.ID, "player2", target)
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUnauthorized {
+			t.Errorf("Expected UNAUTHORIZED when a moderator kicks %s, got %v", target, err)
+		}
+	}
+	if err := manager.KickPlayer(lobby.ID, "player2", "player4"); err != nil {
+		t.Fatalf("Expected a moderator to kick a player, got %v", err)
+	}
+	if findPlayer(lobby, "player4") != nil || kickedBy != "player2" {
+		t.Errorf("Expected player4 kicked by player2, got kickedBy %q", kickedBy)
+	}
+	if err := manager.KickPlayer(lobby.ID, "player1", "player3"); err != nil {
+		t.Errorf("Expected the owner to kick a moderator, got %v", err)
+	}
+}
+
+func TestBanPlayer(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	lobby, _ := manager.CreateLobbyWithOptions("Test Lobby", 4, true, nil, "player1", LobbyOptions{MaxSpectators: 2})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	manager.JoinAsSpectator(lobby.ID, &Player{ID: "watcher", Username: "Wendy"})
+	manager.AddModerator(lobby.ID, "player1", "player2")
+
+	err := manager.BanPlayer(lobby.ID, "player3", "player2", "")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUnauthorized {
+		t.Fatalf("Expected UNAUTHORIZED for a non-moderator, got %v", err)
+	}
+	err = manager.BanPlayer(lobby.ID, "player2", "player1", "")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUnauthorized {
+		t.Fatalf("Expected UNAUTHORIZED when banning the owner, got %v", err)
+	}
+
+	before := time.Now()
+	rec.reset()
+	if err := manager.BanPlayer(lobby.ID, "player2", "player3", "spam"); err != nil {
+		t.Fatalf("BanPlayer failed: %v", err)
+	}
+	if err := manager.BanPlayer(lobby.ID, "player1", "watcher", "rude"); err != nil {
+		t.Fatalf("Banning a spectator failed: %v", err)
+	}
+	if findPlayer(lobby, "player3") != nil || findSpectator(lobby, "watcher") != nil {
+		t.Fatal("Expected banned players removed from the lobby")
+	}
+	msgs := rec.received("player3")
+	if len(msgs) != 1 || msgs[0].(RemovedFromLobbyResponse).Reason != RemovalBanned {
+		t.Errorf("Expected a removed_from_lobby with reason banned, got %#v", msgs)
+	}
+
+	bans, err := manager.ListBans(lobby.ID)
+	if err != nil || len(bans) != 2 {
+		t.Fatalf("Expected 2 bans, got %v, %v", bans, err)
+	}
+	first := bans[0]
+	if first.PlayerID != "player3" || first.Username != "Carol" || first.Reason != "spam" || first.BannedBy != "player2" || first.BannedAt.Before(before) {
+		t.Errorf("Unexpected ban entry %+v", first)
+	}
+	if bans[1].PlayerID != "watcher" || bans[1].Username != "Wendy" || bans[1].BannedBy != "player1" {
+		t.Errorf("Unexpected ban entry %+v", bans[1])
+	}
+	bans[0].Reason = "changed"
+	if again, _ := manager.ListBans(lobby.ID); again[0].Reason != "spam" {
+		t.Error("ListBans should return a copy")
+	}
+
+	err = manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeBanned {
+		t.Fatalf("Expected BANNED on rejoin, got %v", err)
+	}
+	err = manager.JoinAsSpectator(lobby.ID, &Player{ID: "watcher", Username: "Wendy"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeBanned {
+		t.Fatalf("Expected BANNED when spectating again, got %v", err)
+	}
+
+	rematch, err := manager.RematchLobby(lobby.ID, "player1")
+	if err != nil {
+		t.Fatalf("RematchLobby failed: %v", err)
+	}
+	if bans, _ := manager.ListBans(rematch.ID); len(bans) != 2 {
+		t.Errorf("Expected bans carried over to the rematch, got %v", bans)
+	}
+	if err := manager.UnbanPlayer(rematch.ID, "player1", "player3"); err != nil {
+		t.Fatalf("UnbanPlayer failed: %v", err)
+	}
+	if err := manager.JoinLobby(rematch.ID, &Player{ID: "player3", Username: "Carol"}); err != nil {
+		t.Errorf("Expected rejoin after unban, got %v", err)
+	}
+}
+
+func TestPlayerPrivateStateBuilder(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	hands := map[PlayerID]string{"player1": "ace", "player2": "king"}
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: rec.broadcast,
+		PlayerPrivateStateBuilder: func(l *Lobby, p *Player) interface{} {
+			return map[string]string{"hand": hands[p.ID]}
+		},
+	})
+	lobby, _ := manager.CreateLobbyWithOptions("Test Lobby", 4, true, nil, "player1", LobbyOptions{MaxSpectators: 1})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinAsSpectator(lobby.ID, &Player{ID: "watcher", Username: "Eve"})
+	rec.reset()
+
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	for playerID, hand := range hands {
+		msgs := rec.received(string(playerID))
+		state, ok := msgs[len(msgs)-1].(LobbyStateResponse)
+		if !ok {
+			t.Fatalf("Expected lobby_state for %s, got %#v", playerID, msgs)
+		}
+		private, _ := state.Private.(map[string]string)
+		if private["hand"] != hand {
+			t.Errorf("Expected %s to get hand %q, got %#v", playerID, hand, state.Private)
+		}
+		if len(state.Players) != 2 || state.Reason != ReasonPlayerReady {
+			t.Errorf("Expected shared state alongside private data for %s, got %#v", playerID, state)
+		}
+	}
+	msgs := rec.received("watcher")
+	if state, ok := msgs[len(msgs)-1].(LobbyStateResponse); !ok || state.Private != nil {
+		t.Errorf("Spectators should get the shared state only, got %#v", msgs[len(msgs)-1])
+	}
+
+	// With dedupe on, a change only visible in private state is still sent
+	manager.DedupeBroadcasts = true
+	manager.UpdateLobbyMetadata(lobby.ID, nil)
+	rec.reset()
+	hands["player2"] = "queen"
+	manager.UpdateLobbyMetadata(lobby.ID, nil)
+	if got := rec.received("player2"); len(got) != 1 {
+		t.Errorf("Expected a broadcast for a private-only change, got %v", got)
+	}
+}
+
+func TestBroadcastLobbyState_SnapshotIsRaceFree(t *testing.T) {
+	// Encode every broadcast on another goroutine, like a buffered websocket writer would
+	queue := make(chan interface{}, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for message := range queue {
+			json.Marshal(message)
+		}
+	}()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: func(userID string, message interface{}) { queue <- message },
+	})
+	lobby, _ := manager.CreateLobby("Busy Lobby", 8, true, map[string]interface{}{"round": 0}, "p0")
+	manager.JoinLobby(lobby.ID, &Player{ID: "p0"})
+	builder := NewResponseBuilder(manager)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(id PlayerID) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				manager.JoinLobby(lobby.ID, &Player{ID: id})
+				manager.SetPlayerReady(lobby.ID, id, true)
+				manager.UpdateLobbyMetadata(lobby.ID, map[string]interface{}{"round": j})
+				manager.SetPlayersMetadata(lobby.ID, "p0", map[PlayerID]map[string]interface{}{
+					"p0": {string(id): j},
+				})
+				manager.LeaveLobby(lobby.ID, id)
+			}
+		}(PlayerID(fmt.Sprintf("p%d", i)))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			json.Marshal(builder.BuildLobbyStateSnapshot(lobby))
+		}
+	}()
+	wg.Wait()
+	close(queue)
+	<-done
+}
+
+func TestStartReadyCountdown(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	manager.ReadyCountdownTick = 5 * time.Millisecond
+	lobby, _ := manager.CreateLobby("Countdown", 4, true, nil, "p1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "p1"})
+	if err := manager.StartReadyCountdown(lobby.ID, time.Second, nil); err == nil {
+		t.Fatal("Expected a countdown below the minimum players to be refused")
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "p2"})
+	running := func() *readyCountdown {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		return lobby.countdown
+	}
+
+	expired := make(chan *Lobby, 1)
+	if err := manager.StartReadyCountdown(lobby.ID, 30*time.Millisecond, func(l *Lobby) { expired <- l }); err != nil {
+		t.Fatalf("StartReadyCountdown failed: %v", err)
+	}
+	countdown := running()
+	select {
+	case snapshot := <-expired:
+		if len(snapshot.Players) != 2 {
+			t.Errorf("Expected onTimeout to get the lobby with 2 players, got %d", len(snapshot.Players))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Countdown never expired")
+	}
+	<-countdown.done
+	ticks := 0
+	for _, msg := range rec.received("p1") {
+		if resp, ok := msg.(ReadyCountdownResponse); ok && !resp.Cancelled {
+			ticks++
+		}
+	}
+	if ticks < 2 {
+		t.Errorf("Expected ready_countdown on start and on ticks, got %d", ticks)
+	}
+
+	// Dropping below the minimum cancels the countdown and stops its goroutine
+	rec.reset()
+	if err := manager.StartReadyCountdown(lobby.ID, time.Hour, func(*Lobby) { t.Error("Cancelled countdown must not time out") }); err != nil {
+		t.Fatalf("StartReadyCountdown failed: %v", err)
+	}
+	countdown = running()
+	manager.LeaveLobby(lobby.ID, "p2")
+	select {
+	case <-countdown.done:
+	case <-time.After(time.Second):
+		t.Fatal("Countdown goroutine did not exit after cancellation")
+	}
+	cancelled := false
+	for _, msg := range rec.received("p1") {
+		if resp, ok := msg.(ReadyCountdownResponse); ok && resp.Cancelled {
+			cancelled = true
+		}
+	}
+	if !cancelled {
+		t.Error("Expected a cancelled ready_countdown after the leave")
+	}
+	if manager.CancelReadyCountdown(lobby.ID) {
+		t.Error("Expected no countdown left to cancel")
+	}
+}
+
+func TestAsyncEvents_SlowBroadcasterDoesNotBlock(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	release := make(chan struct{})
+	var joinedMu sync.Mutex
+	var joined []string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: func(userID string, message interface{}) {
+			if userID == "stuck" {
+				<-release // A websocket write that never completes
+			}
+			rec.broadcast(userID, message)
+		},
+		OnPlayerJoin: func(lobby *Lobby, player *Player) {
+			joinedMu.Lock()
+			joined = append(joined, fmt.Sprintf("%s:%d", lobby.Name, len(lobby.Players)))
+			joinedMu.Unlock()
+		},
+	})
+	manager.AsyncEvents = true
+	slow, _ := manager.CreateLobby("slow", 4, true, nil, "stuck")
+	fast, _ := manager.CreateLobby("fast", 8, true, nil, "p0")
+	manager.JoinLobby(slow.ID, &Player{ID: "stuck", Username: "Stuck"})
+	manager.SetPlayerReady(slow.ID, "stuck", true)
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := PlayerID(fmt.Sprintf("p%d", i))
+				if err := manager.JoinLobby(fast.ID, &Player{ID: id, Username: string(id)}); err != nil {
+					t.Errorf("Join failed: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Joins should not wait for a blocked broadcaster")
+	}
+	if got, _ := manager.GetLobbySnapshot(fast.ID); len(got.Players) != 5 {
+		t.Fatalf("Expected 5 players in the fast lobby, got %d", len(got.Players))
+	}
+
+	close(release)
+	manager.Shutdown()
+
+	var reasons []string
+	for _, msg := range rec.received("stuck") {
+		if state, ok := msg.(LobbyStateResponse); ok {
+			reasons = append(reasons, state.Reason)
+		}
+	}
+	if want := []string{ReasonPlayerJoined, ReasonPlayerReady}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("Expected the slow lobby's broadcasts in order %v, got %v", want, reasons)
+	}
+	total := 0
+	for i := 0; i < 5; i++ {
+		total += len(rec.received(fmt.Sprintf("p%d", i)))
+	}
+	if total != 1+2+3+4+5 {
+		t.Errorf("Expected every queued fast lobby broadcast to be delivered by Shutdown, got %d", total)
+	}
+	joinedMu.Lock()
+	defer joinedMu.Unlock()
+	// Each callback sees the lobby as it was right after its own join, not the final lobby.
+	want := []string{"slow:1", "fast:1", "fast:2", "fast:3", "fast:4", "fast:5"}
+	if !reflect.DeepEqual(joined, want) {
+		t.Errorf("Expected OnPlayerJoin snapshots %v, got %v", want, joined)
+	}
+
+	// After Shutdown events are delivered inline again.
+	rec.reset()
+	manager.SetPlayerReady(fast.ID, "p0", true)
+	if len(rec.received("p1")) != 1 {
+		t.Error("Events raised after Shutdown should be delivered synchronously")
+	}
+}
+
+func TestGameLifecycleEvents(t *testing.T) {
+	var order []string
+	var started, ended []*Lobby
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnLobbyStateChange: func(lobby *Lobby) {
+			order = append(order, "state:"+lobbyStateString(lobby.State))
+		},
+		OnGameStart: func(lobby *Lobby) {
+			order = append(order, "start")
+			started = append(started, lobby)
+		},
+		OnGameEnd: func(lobby *Lobby) {
+			order = append(order, "end")
+			ended = append(ended, lobby)
+		},
+	})
+	lobby, _ := manager.CreateLobby("Game", 2, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+	if len(started) != 0 || len(ended) != 0 {
+		t.Fatal("Game events should not fire before the game starts")
+	}
+
+	order = nil
+	if err := manager.StartGame(lobby.ID, "player1"); err != nil {
+		t.Fatalf("StartGame failed: %v", err)
+	}
+	if want := []string{"state:in_game", "start"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+	if len(started) != 1 || started[0] == lobby || started[0].State != LobbyInGame || started[0].StartedAt.IsZero() {
+		t.Errorf("OnGameStart should fire once with an in-game snapshot, got %v", started)
+	}
+	manager.StartGame(lobby.ID, "player1")
+	manager.SetLobbyState(lobby.ID, LobbyInGame)
+	if len(started) != 1 {
+		t.Errorf("OnGameStart should not fire again for a lobby already in game, fired %d times", len(started))
+	}
+
+	order = nil
+	manager.SetLobbyState(lobby.ID, LobbyFinished)
+	manager.SetLobbyState(lobby.ID, LobbyFinished)
+	if want := []string{"state:finished", "end"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+	if len(ended) != 1 || ended[0] == lobby || ended[0].State != LobbyFinished {
+		t.Errorf("OnGameEnd should fire once with a finished snapshot, got %v", ended)
+	}
+	if len(started) != 1 {
+		t.Error("Finishing the game should not fire OnGameStart")
+	}
+}
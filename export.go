@@ -0,0 +1,110 @@
+package lobby
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// ImportMode controls how imported state is combined with existing state.
+type ImportMode int
+
+const (
+	// ImportReplace discards all existing state before importing.
+	ImportReplace ImportMode = iota
+	// ImportMerge keeps existing state, overwriting entries that share an ID with imported ones.
+	ImportMerge
+)
+
+// Export serializes all lobbies, including their players, state, metadata, and timestamps.
+func (m *LobbyManager) Export() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobbies := make([]*Lobby, 0, len(m.lobbies))
+	for _, l := range m.lobbies {
+		lobbies = append(lobbies, l)
+	}
+	return json.Marshal(lobbies)
+}
+
+// Import restores lobbies produced by Export.
+// No events fire and nothing is broadcast; the membership index is rebuilt from the imported players.
+// ImportReplace drops the existing lobbies first, stopping their countdowns and timers.
+func (m *LobbyManager) Import(data []byte, mode ImportMode) error {
+	var lobbies []*Lobby
+	if err := json.Unmarshal(data, &lobbies); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mode == ImportReplace {
+		for _, l := range m.lobbies {
+			m.dropLobbyLocked(l)
+		}
+		m.lobbies = make(map[LobbyID]*Lobby)
+		m.memberships = make(map[PlayerID]map[LobbyID]bool)
+		m.pendingJoins = make(map[string]*PendingJoin)
+		m.lobbyNames = make(map[string]LobbyID)
+		atomic.StoreInt64(&m.gamesInProgress, 0)
+	}
+	for _, l := range lobbies {
+		if existing, exists := m.lobbies[l.ID]; exists {
+			m.dropLobbyLocked(existing)
+		}
+		if l.Players == nil {
+			l.Players = []*Player{}
+		}
+		m.lobbies[l.ID] = l
+		m.lobbyNames[l.Name] = l.ID
+		if l.State == LobbyInGame {
+			// Imported games count towards MaxConcurrentGames but are never refused
+			atomic.AddInt64(&m.gamesInProgress, 1)
+		}
+		for _, p := range l.Players {
+			m.addMembership(p.ID, l.ID)
+		}
+	}
+	return nil
+}
+
+// Export serializes all sessions, including inactive ones awaiting reconnection.
+func (sm *SessionManager) Export() ([]byte, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sessions := make([]*UserSession, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		sessions = append(sessions, session)
+	}
+	return json.Marshal(sessions)
+}
+
+// Import restores sessions produced by Export and rebuilds the username index.
+// Session callbacks are not fired for imported sessions.
+func (sm *SessionManager) Import(data []byte, mode ImportMode) error {
+	var sessions []*UserSession
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if mode == ImportReplace {
+		for userID := range sm.sessions {
+			sm.deleteLocked(userID)
+		}
+		sm.sessions = make(map[string]*UserSession)
+		sm.usernameToIDs = make(map[string][]string)
+	}
+	for _, session := range sessions {
+		if existing, exists := sm.sessions[session.ID]; exists {
+			sm.unindexSessionLocked(existing.CanonicalUsername, existing.ID)
+		}
+		if session.CanonicalUsername == "" {
+			session.CanonicalUsername = sm.canonical(session.Username)
+		}
+		sm.sessions[session.ID] = session
+		sm.indexSessionLocked(session)
+		sm.saveLocked(session)
+	}
+	return nil
+}
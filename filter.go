@@ -0,0 +1,166 @@
+package lobby
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LobbyFilter narrows FindLobbies. The zero value matches every listed lobby; each set field
+// must match for a lobby to be returned.
+type LobbyFilter struct {
+	PublicOnly    bool                   // Only public lobbies
+	State         *LobbyState            // Only lobbies in this state
+	NotFull       bool                   // Only lobbies with a seat left, see RemainingCapacity
+	NameContains  string                 // Case-insensitive substring of the lobby name
+	MetadataMatch map[string]interface{} // Metadata values that must be present and equal (reflect.DeepEqual)
+}
+
+// GetLobbyByNameInsensitive finds the lobby whose name matches name ignoring case and
+// surrounding or repeated whitespace, so "  Friday  Night " finds "friday night". Without
+// RequireUniqueNames several lobbies can share a normalized name; the lookup then refuses to
+// guess and fails with ErrorCodeLobbyNotFound, as it does when nothing matches, with details
+// telling the two apart. Private lobbies match too: knowing the name is like knowing the ID.
+func (m *LobbyManager) GetLobbyByNameInsensitive(name string) (*Lobby, error) {
+	want := normalizeLobbyName(name)
+	if want == "" {
+		return nil, ErrLobbyNameNotFound(name)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var found *Lobby
+	matches := 0
+	for _, l := range m.lobbies {
+		if normalizeLobbyName(l.Name) == want {
+			found = l
+			matches++
+		}
+	}
+	switch matches {
+	case 0:
+		return nil, ErrLobbyNameNotFound(name)
+	case 1:
+		return found, nil
+	default:
+		return nil, ErrLobbyNameAmbiguous(name, matches)
+	}
+}
+
+// normalizeLobbyName lowercases name and collapses its whitespace for name lookups.
+func normalizeLobbyName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// FindLobbies returns the lobbies ListLobbies would list that match filter, as snapshots.
+func (m *LobbyManager) FindLobbies(filter LobbyFilter) []*Lobby {
+	if m.ReadReplica != nil {
+		return m.filterLobbies(m.listable(m.ReadReplica.ListLobbies()), filter)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobbies := make([]*Lobby, 0, len(m.lobbies))
+	for _, l := range m.lobbies {
+		lobbies = append(lobbies, l)
+	}
+	return snapshotLobbies(m.filterLobbies(m.listable(lobbies), filter))
+}
+
+// filterLobbies keeps the lobbies matching filter, reusing the slice. For lobbies owned by the
+// manager, rather than a ReadReplica, the caller must hold m.mu exclusively.
+func (m *LobbyManager) filterLobbies(lobbies []*Lobby, filter LobbyFilter) []*Lobby {
+	name := strings.ToLower(filter.NameContains)
+	matched := lobbies[:0]
+	for _, l := range lobbies {
+		if filter.PublicOnly && !l.Public {
+			continue
+		}
+		if filter.State != nil && l.State != *filter.State {
+			continue
+		}
+		if filter.NotFull && m.remainingCapacityLocked(l) == 0 {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(l.Name), name) {
+			continue
+		}
+		if !metadataMatches(l.Metadata, filter.MetadataMatch) {
+			continue
+		}
+		matched = append(matched, l)
+	}
+	return matched
+}
+
+// metadataMatches reports whether metadata holds every key in want with an equal value.
+func metadataMatches(metadata, want map[string]interface{}) bool {
+	for key, value := range want {
+		got, ok := metadata[key]
+		if !ok || !reflect.DeepEqual(got, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// lobbyFilter converts the wire filter, rejecting unknown states with ErrorCodeInvalidRequest.
+func (f *ListLobbiesFilter) lobbyFilter() (LobbyFilter, *LobbyError) {
+	filter := LobbyFilter{
+		PublicOnly:    f.PublicOnly,
+		NotFull:       f.NotFull,
+		NameContains:  f.NameContains,
+		MetadataMatch: f.Metadata,
+	}
+	if f.State != "" {
+		state, ok := parseLobbyState(f.State)
+		if !ok {
+			return LobbyFilter{}, NewLobbyError(ErrorCodeInvalidRequest, "Unknown lobby state "+f.State)
+		}
+		filter.State = &state
+	}
+	return filter, nil
+}
+
+// Page sizes used by ListLobbiesPaged and paged list_lobbies requests.
+const (
+	DefaultLobbyPageSize = 50  // Used when the limit is zero or negative
+	MaxLobbyPageSize     = 500 // Larger limits are clamped to this
+)
+
+// ListLobbiesPaged returns one page of the lobbies ListLobbies would list, ordered by creation
+// time then ID so pages stay stable between calls, along with the total across all pages. A
+// negative offset counts as 0, and limit falls back to DefaultLobbyPageSize when not positive
+// and is capped at MaxLobbyPageSize.
+func (m *LobbyManager) ListLobbiesPaged(offset, limit int) ([]*Lobby, int) {
+	page, total, _ := paginateLobbies(m.ListLobbies(), offset, limit)
+	return page, total
+}
+
+// paginateLobbies sorts lobbies into a stable order and cuts out one page, reporting the total
+// and whether more pages follow.
+func paginateLobbies(lobbies []*Lobby, offset, limit int) ([]*Lobby, int, bool) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = DefaultLobbyPageSize
+	}
+	if limit > MaxLobbyPageSize {
+		limit = MaxLobbyPageSize
+	}
+	sort.Slice(lobbies, func(i, j int) bool {
+		a, b := lobbies[i], lobbies[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	total := len(lobbies)
+	if offset >= total {
+		return []*Lobby{}, total, false
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return lobbies[offset:end], total, end < total
+}
@@ -0,0 +1,29 @@
+package lobby
+
+import "sync/atomic"
+
+// GamesInProgress returns how many lobbies are currently in-game, the count that
+// MaxConcurrentGames caps.
+func (m *LobbyManager) GamesInProgress() int {
+	return int(atomic.LoadInt64(&m.gamesInProgress))
+}
+
+// acquireGameSlot counts one more game in progress, reporting false without counting it when
+// MaxConcurrentGames is reached. Starts in different lobbies may run in parallel under the
+// read lock, so the check and increment are a single compare-and-swap.
+func (m *LobbyManager) acquireGameSlot() bool {
+	for {
+		current := atomic.LoadInt64(&m.gamesInProgress)
+		if m.MaxConcurrentGames > 0 && current >= int64(m.MaxConcurrentGames) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&m.gamesInProgress, current, current+1) {
+			return true
+		}
+	}
+}
+
+// releaseGameSlot counts one game fewer in progress.
+func (m *LobbyManager) releaseGameSlot() {
+	atomic.AddInt64(&m.gamesInProgress, -1)
+}
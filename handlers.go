@@ -1,15 +1,82 @@
 package lobby
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 )
 
 // HandlerDeps contains dependencies required by message handlers.
 type HandlerDeps struct {
 	SessionManager *SessionManager
 	LobbyManager   *LobbyManager
-	ConnToUserID   map[interface{}]string
+	ConnToUserID   *ConnRegistry // Connections registered by register_user; optional
+
+	// StrictJSON rejects request payloads with unknown fields (e.g. a typo'd "maxPlayers")
+	// with ErrorCodeInvalidRequest instead of silently ignoring them. Off by default.
+	StrictJSON bool
+
+	// Codec enables compression of large payloads for clients that negotiate it at
+	// register_user. Nil disables compression. Transports wrap their connection with
+	// Codec.WrapConn using the session's Compression.
+	Codec *Codec
+
+	// PlayerLimits bounds max_players in create_lobby before the request reaches the
+	// LobbyManager, so clients cannot ask for huge lobbies whatever the manager accepts.
+	// Nil leaves max_players unchecked.
+	PlayerLimits *PlayerLimits
+}
+
+// PlayerLimits is the server's allowed range for a lobby's max_players.
+type PlayerLimits struct {
+	Min int // Smallest allowed max_players; 0 for no lower bound
+	Max int // Largest allowed max_players; 0 for no upper bound
+
+	// Clamp moves an out-of-range max_players to the nearest bound instead of rejecting the
+	// request with ErrorCodeInvalidRequest.
+	Clamp bool
+}
+
+// apply checks maxPlayers against the limits, returning the value to use.
+func (l *PlayerLimits) apply(maxPlayers int) (int, *LobbyError) {
+	if l == nil {
+		return maxPlayers, nil
+	}
+	bound := maxPlayers
+	if l.Min > 0 && maxPlayers < l.Min {
+		bound = l.Min
+	} else if l.Max > 0 && maxPlayers > l.Max {
+		bound = l.Max
+	}
+	if bound == maxPlayers || l.Clamp {
+		return bound, nil
+	}
+	if bound == l.Min {
+		return 0, NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "max_players out of range", fmt.Sprintf("max_players must be at least %d", l.Min))
+	}
+	return 0, NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "max_players out of range", fmt.Sprintf("max_players must be at most %d", l.Max))
+}
+
+// decodeRequest unmarshals a request payload into v, honouring deps.StrictJSON.
+func decodeRequest(deps *HandlerDeps, data json.RawMessage, v interface{}, action string) *LobbyError {
+	if !deps.StrictJSON {
+		if err := json.Unmarshal(data, v); err != nil {
+			return ErrInvalidMessage(action)
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Unknown field in request", err.Error())
+		}
+		return ErrInvalidMessage(action)
+	}
+	return nil
 }
 
 // validateSessionToken validates a session token and returns the session if valid.
@@ -19,7 +86,7 @@ func validateSessionToken(deps *HandlerDeps, userID string, token string) (*User
 		return nil, ErrUserInactive(userID)
 	}
 
-	if session.Token != token {
+	if !tokensEqual(session.Token, token) {
 		return nil, ErrInvalidToken("authentication")
 	}
 
@@ -30,11 +97,16 @@ func validateSessionToken(deps *HandlerDeps, userID string, token string) (*User
 func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req RegisterUserRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("register_user").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "register_user"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		if req.Token != "" {
+			if deps.SessionManager.IsLockedOut(req.Username) {
+				log.Printf("Reconnection for %s rejected: locked out", req.Username)
+				return conn.WriteJSON(ErrTooManyAttempts(req.Username).ToErrorResponse())
+			}
+
 			var existingSession *UserSession
 			var valid bool
 
@@ -47,22 +119,26 @@ func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 				log.Printf("Valid reconnection for %s with token", req.Username)
 
 				if deps.ConnToUserID != nil {
-					deps.ConnToUserID[conn] = existingSession.ID
+					deps.ConnToUserID.Add(conn, existingSession.ID)
 				}
 
+				compression := deps.Codec.Negotiate(req.Compression)
+				deps.SessionManager.SetCompression(existingSession.ID, compression)
+
 				registerResponse := RegisterUserResponse{
-					Action:   "user_registered",
-					UserID:   existingSession.ID,
-					Username: existingSession.Username,
-					Token:    existingSession.Token,
+					Action:      "user_registered",
+					UserID:      existingSession.ID,
+					Username:    existingSession.Username,
+					Token:       existingSession.Token,
+					Compression: string(compression),
 				}
 
 				if existingSession.LobbyID != "" {
-					lobby, exists := deps.LobbyManager.GetLobbyByID(LobbyID(existingSession.LobbyID))
+					lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(existingSession.LobbyID))
 					if exists {
-						playerStillInLobby := false
+						playerStillInLobby := findSpectator(lobby, PlayerID(existingSession.ID)) != nil
 						for _, p := range lobby.Players {
-							if p.Username == req.Username {
+							if p.ID == PlayerID(existingSession.ID) {
 								playerStillInLobby = true
 								break
 							}
@@ -76,9 +152,10 @@ func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 								if err := conn.WriteJSON(registerResponse); err != nil {
 									return err
 								}
-								// Send lobby state response to trigger navigation back to lobby
+								// Send lobby state response to trigger navigation back to lobby,
+								// re-read so it includes the player who just rejoined
 								responseBuilder := NewResponseBuilder(deps.LobbyManager)
-								lobbyState := responseBuilder.BuildLobbyStateResponse(lobby)
+								lobbyState := responseBuilder.BuildLobbyStateSnapshot(lobby)
 								return conn.WriteJSON(lobbyState)
 							} else {
 								deps.SessionManager.ClearLobbyID(existingSession.ID)
@@ -99,6 +176,9 @@ func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 				}
 
 				return conn.WriteJSON(registerResponse)
+			} else if !deps.SessionManager.HasSession(req.Username) {
+				log.Printf("Expired session reconnection attempt by %s", req.Username)
+				return conn.WriteJSON(ErrSessionExpired(req.Username).ToErrorResponse())
 			} else {
 				log.Printf("Invalid token for reconnection attempt by %s", req.Username)
 				return conn.WriteJSON(ErrInvalidToken("register_user").ToErrorResponse())
@@ -112,16 +192,23 @@ func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 		}
 
 		// Create new session for new user
-		session := deps.SessionManager.CreateSession(req.Username)
+		session, err := deps.SessionManager.TryCreateSession(req.Username)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
 		if deps.ConnToUserID != nil {
-			deps.ConnToUserID[conn] = session.ID
+			deps.ConnToUserID.Add(conn, session.ID)
 		}
 
+		compression := deps.Codec.Negotiate(req.Compression)
+		deps.SessionManager.SetCompression(session.ID, compression)
+
 		response := RegisterUserResponse{
-			Action:   "user_registered",
-			UserID:   session.ID,
-			Username: session.Username,
-			Token:    session.Token,
+			Action:      "user_registered",
+			UserID:      session.ID,
+			Username:    session.Username,
+			Token:       session.Token,
+			Compression: string(compression),
 		}
 
 		return conn.WriteJSON(response)
@@ -132,8 +219,8 @@ func RegisterUserHandler(deps *HandlerDeps) MessageHandler {
 func CreateLobbyHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req CreateLobbyRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("create_lobby").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "create_lobby"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		session, err := validateSessionToken(deps, req.UserID, req.Token)
@@ -144,21 +231,33 @@ func CreateLobbyHandler(deps *HandlerDeps) MessageHandler {
 			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
 		}
 
-		createdLobby, err := deps.LobbyManager.CreateLobby(req.Name, req.MaxPlayers, req.Public, req.Metadata, session.ID)
+		maxPlayers, limitErr := deps.PlayerLimits.apply(req.MaxPlayers)
+		if limitErr != nil {
+			return conn.WriteJSON(limitErr.ToErrorResponse())
+		}
+		persist := req.PersistWhenEmpty || (req.DeleteOnEmpty != nil && !*req.DeleteOnEmpty)
+
+		createdLobby, err := deps.LobbyManager.CreateLobbyWithOptions(req.Name, maxPlayers, req.Public, req.Metadata, session.ID,
+			LobbyOptions{AutoStart: req.AutoStart, TeamCount: req.TeamCount, MaxPerTeam: req.MaxPerTeam, AutoReadyOnJoin: req.AutoReadyOnJoin, MaxSpectators: req.MaxSpectators,
+				PersistWhenEmpty: persist, AllowedActions: req.AllowedActions, Region: req.Region})
 		if err != nil {
-			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
+			return conn.WriteJSON(toErrorResponse(err))
 		}
 
 		player := &Player{ID: PlayerID(session.ID), Username: session.Username}
 		err = deps.LobbyManager.JoinLobby(createdLobby.ID, player)
 		if err != nil {
+			_ = deps.LobbyManager.DeleteLobby(createdLobby.ID)
+			if lobbyErr, ok := err.(*LobbyError); ok {
+				return conn.WriteJSON(lobbyErr.ToErrorResponse())
+			}
 			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, "failed to join creator to lobby: "+err.Error()).ToErrorResponse())
 		}
 
 		deps.SessionManager.SetLobbyID(session.ID, string(createdLobby.ID))
 
 		responseBuilder := NewResponseBuilder(deps.LobbyManager)
-		lobbyState := responseBuilder.BuildLobbyStateResponse(createdLobby)
+		lobbyState := responseBuilder.BuildLobbyStateSnapshot(createdLobby)
 		return conn.WriteJSON(lobbyState)
 	}
 }
@@ -167,8 +266,8 @@ func CreateLobbyHandler(deps *HandlerDeps) MessageHandler {
 func JoinLobbyHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req JoinLobbyRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("join_lobby").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "join_lobby"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		session, err := validateSessionToken(deps, req.UserID, req.Token)
@@ -179,21 +278,156 @@ func JoinLobbyHandler(deps *HandlerDeps) MessageHandler {
 			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
 		}
 
-		player := &Player{ID: PlayerID(session.ID), Username: session.Username}
-		err = deps.LobbyManager.JoinLobby(LobbyID(req.LobbyID), player)
+		return joinLobbyAndRespond(deps, conn, session, LobbyID(req.LobbyID))
+	}
+}
+
+// JoinLobbyByNameHandler handles the "join_lobby_by_name" action. The name is matched
+// ignoring case and whitespace; an unknown or ambiguous name fails with LOBBY_NOT_FOUND.
+func JoinLobbyByNameHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req JoinLobbyByNameRequest
+		if err := decodeRequest(deps, msg.Data, &req, "join_lobby_by_name"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
 		if err != nil {
-			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
+			return conn.WriteJSON(toErrorResponse(err))
 		}
 
-		deps.SessionManager.SetLobbyID(session.ID, req.LobbyID)
+		lobby, err := deps.LobbyManager.GetLobbyByNameInsensitive(req.Name)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		return joinLobbyAndRespond(deps, conn, session, lobby.ID)
+	}
+}
 
-		lobby, exists := deps.LobbyManager.GetLobbyByID(LobbyID(req.LobbyID))
-		if exists {
-			responseBuilder := NewResponseBuilder(deps.LobbyManager)
-			lobbyState := responseBuilder.BuildLobbyStateResponse(lobby)
+// joinLobbyAndRespond joins the session's player to a lobby, spectating instead when the
+// manager allows it and the lobby is full, and replies with the lobby's state.
+func joinLobbyAndRespond(deps *HandlerDeps, conn Conn, session *UserSession, lobbyID LobbyID) error {
+	player := &Player{ID: PlayerID(session.ID), Username: session.Username}
+	if deps.LobbyManager.SpectateWhenFull {
+		spectating, err := deps.LobbyManager.JoinOrSpectate(lobbyID, player)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		if spectating {
+			// Spectators are tracked like players so a disconnect frees their place
+			deps.SessionManager.SetLobbyID(session.ID, string(lobbyID))
+			lobby, exists := deps.LobbyManager.GetLobbySnapshot(lobbyID)
+			if !exists {
+				return nil
+			}
+			lobbyState := NewResponseBuilder(deps.LobbyManager).BuildLobbyStateResponse(lobby)
+			lobbyState.Spectating = true
 			return conn.WriteJSON(lobbyState)
 		}
-		return nil
+	} else if err := deps.LobbyManager.JoinLobby(lobbyID, player); err != nil {
+		return conn.WriteJSON(toErrorResponse(err))
+	}
+
+	deps.SessionManager.SetLobbyID(session.ID, string(lobbyID))
+
+	lobby, exists := deps.LobbyManager.GetLobbySnapshot(lobbyID)
+	if exists {
+		responseBuilder := NewResponseBuilder(deps.LobbyManager)
+		if lobby.State == LobbyInGame {
+			return conn.WriteJSON(responseBuilder.BuildInGameJoinResponse(lobby, player))
+		}
+		lobbyState := responseBuilder.BuildLobbyStateResponse(lobby)
+		return conn.WriteJSON(lobbyState)
+	}
+	return nil
+}
+
+// QuickJoinHandler handles the "quick_join" action, joining the player to the best open lobby
+// so a "Play Now" button works without browsing.
+func QuickJoinHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req QuickJoinRequest
+		if err := decodeRequest(deps, msg.Data, &req, "quick_join"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		player := &Player{ID: PlayerID(session.ID), Username: session.Username}
+		lobby, err := deps.LobbyManager.QuickJoin(player, QuickJoinCriteria{
+			Metadata:     req.Metadata,
+			CreateIfNone: req.CreateIfNone,
+			Name:         req.Name,
+			MaxPlayers:   req.MaxPlayers,
+		})
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		deps.SessionManager.SetLobbyID(session.ID, string(lobby.ID))
+
+		responseBuilder := NewResponseBuilder(deps.LobbyManager)
+		return conn.WriteJSON(responseBuilder.BuildLobbyStateSnapshot(lobby))
+	}
+}
+
+// RequestJoinHandler handles the "request_join" action, reserving a seat and returning a lobby preview.
+func RequestJoinHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req RequestJoinRequest
+		if err := decodeRequest(deps, msg.Data, &req, "request_join"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		player := &Player{ID: PlayerID(session.ID), Username: session.Username}
+		pending, err := deps.LobbyManager.RequestJoin(LobbyID(req.LobbyID), player)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(pending.LobbyID)
+		if !exists {
+			return conn.WriteJSON(ErrLobbyNotFound(req.LobbyID).ToErrorResponse())
+		}
+		return conn.WriteJSON(JoinPendingResponse{
+			Action:       "join_pending",
+			PendingToken: pending.Token,
+			ExpiresAt:    pending.ExpiresAt,
+			Lobby:        NewResponseBuilder(deps.LobbyManager).BuildLobbyInfoResponse(lobby),
+		})
+	}
+}
+
+// ConfirmJoinHandler handles the "confirm_join" action, completing a join started with request_join.
+func ConfirmJoinHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req ConfirmJoinRequest
+		if err := decodeRequest(deps, msg.Data, &req, "confirm_join"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, err := deps.LobbyManager.ConfirmJoin(req.PendingToken, PlayerID(session.ID))
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		deps.SessionManager.SetLobbyID(session.ID, string(lobby.ID))
+
+		responseBuilder := NewResponseBuilder(deps.LobbyManager)
+		return conn.WriteJSON(responseBuilder.BuildLobbyStateSnapshot(lobby))
 	}
 }
 
@@ -201,8 +435,8 @@ func JoinLobbyHandler(deps *HandlerDeps) MessageHandler {
 func LeaveLobbyHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req LeaveLobbyRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("leave_lobby").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "leave_lobby"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		session, err := validateSessionToken(deps, req.UserID, req.Token)
@@ -231,8 +465,8 @@ func LeaveLobbyHandler(deps *HandlerDeps) MessageHandler {
 func SetReadyHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req SetReadyRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("set_ready").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "set_ready"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		session, err := validateSessionToken(deps, req.UserID, req.Token)
@@ -245,10 +479,10 @@ func SetReadyHandler(deps *HandlerDeps) MessageHandler {
 
 		err = deps.LobbyManager.SetPlayerReady(LobbyID(req.LobbyID), PlayerID(session.ID), req.Ready)
 		if err != nil {
-			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
+			return conn.WriteJSON(toErrorResponse(err))
 		}
 
-		lobby, exists := deps.LobbyManager.GetLobbyByID(LobbyID(req.LobbyID))
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
 		if exists {
 			responseBuilder := NewResponseBuilder(deps.LobbyManager)
 			lobbyState := responseBuilder.BuildLobbyStateResponse(lobby)
@@ -258,11 +492,251 @@ func SetReadyHandler(deps *HandlerDeps) MessageHandler {
 	}
 }
 
+// SetTeamHandler handles the "set_team" action, moving the player to the requested team.
+func SetTeamHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req SetTeamRequest
+		if err := decodeRequest(deps, msg.Data, &req, "set_team"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		if err := deps.LobbyManager.SetPlayerTeam(LobbyID(req.LobbyID), PlayerID(session.ID), req.Team); err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
+		if exists {
+			return conn.WriteJSON(NewResponseBuilder(deps.LobbyManager).BuildLobbyStateResponse(lobby))
+		}
+		return nil
+	}
+}
+
+// RematchHandler handles the "rematch" action, moving the owner's lobby to a fresh one with
+// RematchLobby. Everyone moved has their session pointed at the new lobby.
+func RematchHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req RematchRequest
+		if err := decodeRequest(deps, msg.Data, &req, "rematch"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, err := deps.LobbyManager.RematchLobby(LobbyID(req.LobbyID), session.ID)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobbyState := NewResponseBuilder(deps.LobbyManager).BuildLobbyStateSnapshot(lobby)
+		for _, p := range lobbyState.Players {
+			deps.SessionManager.SetLobbyID(p.UserID, lobbyState.LobbyID)
+		}
+		for _, s := range lobbyState.Spectators {
+			deps.SessionManager.SetLobbyID(s.UserID, lobbyState.LobbyID)
+		}
+		return conn.WriteJSON(lobbyState)
+	}
+}
+
+// ReadyAndMaybeStartHandler handles the "ready_and_maybe_start" action. It sets the player's
+// ready status and, in an auto-start lobby, starts the game once validateGameStart passes.
+func ReadyAndMaybeStartHandler(deps *HandlerDeps, validateGameStart func(*Lobby, string) error) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req SetReadyRequest
+		if err := decodeRequest(deps, msg.Data, &req, "ready_and_maybe_start"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		_, err = deps.LobbyManager.SetPlayerReadyAndMaybeStart(LobbyID(req.LobbyID), PlayerID(session.ID), req.Ready, validateGameStart)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
+		if exists {
+			responseBuilder := NewResponseBuilder(deps.LobbyManager)
+			return conn.WriteJSON(responseBuilder.BuildLobbyStateResponse(lobby))
+		}
+		return nil
+	}
+}
+
+// SetPlayersMetadataHandler handles the "set_players_metadata" action, letting the owner assign
+// metadata such as teams or colors to several players in one all-or-nothing update.
+func SetPlayersMetadataHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req SetPlayersMetadataRequest
+		if err := decodeRequest(deps, msg.Data, &req, "set_players_metadata"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		updates := make(map[PlayerID]map[string]interface{}, len(req.Players))
+		for playerID, metadata := range req.Players {
+			updates[PlayerID(playerID)] = metadata
+		}
+		if err := deps.LobbyManager.SetPlayersMetadata(LobbyID(req.LobbyID), session.ID, updates); err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
+		if exists {
+			responseBuilder := NewResponseBuilder(deps.LobbyManager)
+			return conn.WriteJSON(responseBuilder.BuildLobbyStateResponse(lobby))
+		}
+		return nil
+	}
+}
+
+// KickPlayerHandler handles the "kick_player" action. Only the lobby owner and moderators may kick.
+func KickPlayerHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req KickPlayerRequest
+		if err := decodeRequest(deps, msg.Data, &req, "kick_player"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		if err := deps.LobbyManager.KickPlayer(LobbyID(req.LobbyID), session.ID, PlayerID(req.TargetID)); err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		if lobbyID, ok := deps.SessionManager.GetLobbyID(req.TargetID); ok && lobbyID == req.LobbyID {
+			deps.SessionManager.ClearLobbyID(req.TargetID)
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
+		if exists {
+			responseBuilder := NewResponseBuilder(deps.LobbyManager)
+			return conn.WriteJSON(responseBuilder.BuildLobbyStateResponse(lobby))
+		}
+		return nil
+	}
+}
+
+// ListBansHandler handles the "list_bans" action. Only the lobby owner and moderators may see
+// the ban list.
+func ListBansHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req ListBansRequest
+		if err := decodeRequest(deps, msg.Data, &req, "list_bans"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		lobby, exists := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
+		if !exists {
+			return conn.WriteJSON(ErrLobbyNotFound(req.LobbyID).ToErrorResponse())
+		}
+		if !canModerate(lobby, session.ID) {
+			return conn.WriteJSON(ErrUnauthorized("list_bans").ToErrorResponse())
+		}
+		bans, err := deps.LobbyManager.ListBans(lobby.ID)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		return conn.WriteJSON(BansResponse{Action: "bans", LobbyID: req.LobbyID, Bans: bans})
+	}
+}
+
+// ChatMessageHandler handles the "chat_message" action. The message reaches the sender through
+// the same broadcast as everyone else, so nothing is written back on success.
+func ChatMessageHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req ChatMessageRequest
+		if err := decodeRequest(deps, msg.Data, &req, "chat_message"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		if err := deps.LobbyManager.SendChatMessage(LobbyID(req.LobbyID), PlayerID(session.ID), req.Text); err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		return nil
+	}
+}
+
 // ListLobbiesHandler handles the "list_lobbies" action.
+// With "watch" set, the authenticated user is also subscribed to lobby_removed messages.
+// An optional "filter" narrows the list, see FindLobbies.
 func ListLobbiesHandler(deps *HandlerDeps) MessageHandler {
+	return listLobbiesHandler(deps, "list_lobbies", func(rb *ResponseBuilder, lobbies []*Lobby, total int, hasMore bool) interface{} {
+		return rb.buildLobbyList(lobbies, total, hasMore)
+	})
+}
+
+// ListLobbiesDetailedHandler handles the "list_lobbies_detailed" action. It takes the same
+// payload as list_lobbies but replies with a LobbySummary per lobby instead of bare IDs.
+func ListLobbiesDetailedHandler(deps *HandlerDeps) MessageHandler {
+	return listLobbiesHandler(deps, "list_lobbies_detailed", func(rb *ResponseBuilder, lobbies []*Lobby, total int, hasMore bool) interface{} {
+		return rb.buildLobbyListDetailed(lobbies, total, hasMore)
+	})
+}
+
+// listLobbiesHandler decodes a ListLobbiesRequest, subscribes watchers and replies with build's
+// response for the requested page of matching lobbies.
+func listLobbiesHandler(deps *HandlerDeps, action string, build func(rb *ResponseBuilder, lobbies []*Lobby, total int, hasMore bool) interface{}) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
+		var req ListLobbiesRequest
+		if len(msg.Data) > 0 {
+			if err := decodeRequest(deps, msg.Data, &req, action); err != nil {
+				return conn.WriteJSON(err.ToErrorResponse())
+			}
+		}
+		if req.Watch {
+			session, err := validateSessionToken(deps, req.UserID, req.Token)
+			if err != nil {
+				return conn.WriteJSON(toErrorResponse(err))
+			}
+			deps.LobbyManager.WatchLobbyList(session.ID)
+		}
+
+		var lobbies []*Lobby
+		if req.Filter != nil {
+			filter, err := req.Filter.lobbyFilter()
+			if err != nil {
+				return conn.WriteJSON(err.ToErrorResponse())
+			}
+			lobbies = deps.LobbyManager.FindLobbies(filter)
+		} else {
+			lobbies = deps.LobbyManager.ListLobbies()
+		}
+		total, hasMore := len(lobbies), false
+		if req.Offset != 0 || req.Limit != 0 {
+			lobbies, total, hasMore = paginateLobbies(lobbies, req.Offset, req.Limit)
+		}
+
 		responseBuilder := NewResponseBuilder(deps.LobbyManager)
-		return conn.WriteJSON(responseBuilder.BuildLobbyListResponse())
+		return conn.WriteJSON(build(responseBuilder, lobbies, total, hasMore))
 	}
 }
 
@@ -270,8 +744,8 @@ func ListLobbiesHandler(deps *HandlerDeps) MessageHandler {
 func StartGameHandler(deps *HandlerDeps, validateGameStart func(*Lobby, string) error) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req StartGameRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("start_game").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "start_game"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
 
 		session, err := validateSessionToken(deps, req.UserID, req.Token)
@@ -282,7 +756,7 @@ func StartGameHandler(deps *HandlerDeps, validateGameStart func(*Lobby, string)
 			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
 		}
 
-		l, ok := deps.LobbyManager.GetLobbyByID(LobbyID(req.LobbyID))
+		l, ok := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
 		if !ok {
 			return conn.WriteJSON(ErrLobbyNotFound(req.LobbyID).ToErrorResponse())
 		}
@@ -291,9 +765,15 @@ func StartGameHandler(deps *HandlerDeps, validateGameStart func(*Lobby, string)
 		}
 		err = deps.LobbyManager.StartGame(LobbyID(req.LobbyID), session.ID)
 		if err != nil {
-			return conn.WriteJSON(NewLobbyError(ErrorCodeInternalError, err.Error()).ToErrorResponse())
+			return conn.WriteJSON(toErrorResponse(err))
 		}
-		return nil
+
+		// Everyone gets game_started; the initiator also gets an ack answering their request
+		ack := GameStartAckResponse{Action: "game_start_ack", LobbyID: req.LobbyID, StartedAt: time.Now()}
+		if started, ok := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID)); ok && !started.StartedAt.IsZero() {
+			ack.StartedAt = started.StartedAt
+		}
+		return conn.WriteJSON(ack)
 	}
 }
 
@@ -301,10 +781,10 @@ func StartGameHandler(deps *HandlerDeps, validateGameStart func(*Lobby, string)
 func GetLobbyInfoHandler(deps *HandlerDeps, lobbyInfoResponseFromLobby func(*Lobby) LobbyInfoResponse) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req GetLobbyInfoRequest
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("get_lobby_info").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "get_lobby_info"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
-		l, ok := deps.LobbyManager.GetLobbyByID(LobbyID(req.LobbyID))
+		l, ok := deps.LobbyManager.GetLobbySnapshot(LobbyID(req.LobbyID))
 		if !ok {
 			return conn.WriteJSON(ErrLobbyNotFound(req.LobbyID).ToErrorResponse())
 		}
@@ -312,25 +792,65 @@ func GetLobbyInfoHandler(deps *HandlerDeps, lobbyInfoResponseFromLobby func(*Lob
 	}
 }
 
+// HeartbeatHandler handles the "heartbeat" action, refreshing the session's LastSeen so an
+// idle but connected client is not cleaned up, and answering with pong.
+func HeartbeatHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req HeartbeatRequest
+		if err := decodeRequest(deps, msg.Data, &req, "heartbeat"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		deps.SessionManager.Touch(session.ID)
+		return conn.WriteJSON(PongResponse{Action: "pong", ServerTime: time.Now()})
+	}
+}
+
+// RenameUserHandler handles the "rename_user" action. The session keeps its ID, token and
+// lobby seats; every lobby the user is in gets a lobby_state with the new name.
+func RenameUserHandler(deps *HandlerDeps) MessageHandler {
+	return func(conn Conn, msg IncomingMessage) error {
+		var req RenameUserRequest
+		if err := decodeRequest(deps, msg.Data, &req, "rename_user"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
+		}
+
+		session, err := validateSessionToken(deps, req.UserID, req.Token)
+		if err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+
+		if err := deps.SessionManager.RenameUser(session.ID, req.Username); err != nil {
+			return conn.WriteJSON(toErrorResponse(err))
+		}
+		deps.LobbyManager.RenamePlayer(PlayerID(session.ID), req.Username)
+		return conn.WriteJSON(UserRenamedResponse{Action: "user_renamed", UserID: session.ID, Username: req.Username})
+	}
+}
+
 // LogoutHandler handles the "logout" action.
 func LogoutHandler(deps *HandlerDeps) MessageHandler {
 	return func(conn Conn, msg IncomingMessage) error {
 		var req struct {
 			Action string `json:"action"`
 			UserID string `json:"user_id"`
+			Token  string `json:"token"`
 		}
-		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			return conn.WriteJSON(ErrInvalidMessage("logout").ToErrorResponse())
+		if err := decodeRequest(deps, msg.Data, &req, "logout"); err != nil {
+			return conn.WriteJSON(err.ToErrorResponse())
 		}
-		for _, lobby := range deps.LobbyManager.ListLobbies() {
-			for _, player := range lobby.Players {
-				if string(player.ID) == req.UserID {
-					_ = deps.LobbyManager.LeaveLobby(lobby.ID, player.ID)
-					break
-				}
+		for _, location := range deps.LobbyManager.AllPlayers() {
+			if string(location.PlayerID) == req.UserID {
+				_ = deps.LobbyManager.LeaveLobby(location.LobbyID, location.PlayerID)
 			}
 		}
 
+		deps.LobbyManager.UnwatchLobbyList(req.UserID)
 		deps.SessionManager.ClearLobbyID(req.UserID)
 		deps.SessionManager.RemoveSession(req.UserID)
 		return nil
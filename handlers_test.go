@@ -0,0 +1,1303 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockConn records every message written to it.
+type mockConn struct {
+	mu       sync.Mutex
+	messages []interface{}
+}
+
+func (c *mockConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, v)
+	return nil
+}
+
+func (c *mockConn) last() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.messages) == 0 {
+		return nil
+	}
+	return c.messages[len(c.messages)-1]
+}
+
+func newTestRouter() (*MessageRouter, *HandlerDeps) {
+	deps := &HandlerDeps{
+		SessionManager: NewSessionManager(),
+		LobbyManager:   NewLobbyManagerWithEvents(&LobbyEvents{}),
+		ConnToUserID:   NewConnRegistry(0),
+	}
+	router := NewMessageRouter()
+	router.SetupDefaultHandlersWithCustom(deps, &HandlerOptions{})
+	return router, deps
+}
+
+func dispatch(t *testing.T, router *MessageRouter, conn Conn, action string, data interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{"action": action, "data": data})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := router.Dispatch(conn, raw); err != nil {
+		t.Fatalf("Dispatch %s failed: %v", action, err)
+	}
+}
+
+func expectErrorCode(t *testing.T, msg interface{}, code ErrorCode) {
+	t.Helper()
+	resp, ok := msg.(ErrorResponse)
+	if !ok {
+		t.Fatalf("Expected error response %s, got %#v", code, msg)
+	}
+	if resp.Code != string(code) {
+		t.Fatalf("Expected error code %s, got %s (%s)", code, resp.Code, resp.Message)
+	}
+}
+
+func TestRegisterUserHandler_ReconnectAfterCleanup(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice"})
+	registered, ok := conn.last().(RegisterUserResponse)
+	if !ok {
+		t.Fatalf("Expected registration response, got %#v", conn.last())
+	}
+
+	// A wrong token for a live session is still an invalid token
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": "wrong"})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidToken)
+
+	deps.SessionManager.RemoveSession(registered.UserID)
+	deps.SessionManager.CleanupStaleSessions(0)
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": registered.Token})
+	expectErrorCode(t, conn.last(), ErrorCodeSessionExpired)
+
+	// The username is free to register again
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice"})
+	again, ok := conn.last().(RegisterUserResponse)
+	if !ok {
+		t.Fatalf("Expected re-registration to succeed, got %#v", conn.last())
+	}
+	if again.UserID == registered.UserID {
+		t.Error("Re-registration should create a new session")
+	}
+}
+
+func TestRegisterUserHandler_ReconnectRejoinsLobby(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Room", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := LobbyID(conn.last().(LobbyStateResponse).LobbyID)
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+
+	// Alice drops out of the lobby but her session still points at it
+	if err := deps.LobbyManager.LeaveLobby(lobbyID, PlayerID(alice.ID)); err != nil {
+		t.Fatalf("LeaveLobby failed: %v", err)
+	}
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": alice.Token})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok {
+		t.Fatalf("Expected lobby state after reconnecting, got %#v", conn.last())
+	}
+	found := false
+	for _, p := range state.Players {
+		if p.UserID == alice.ID {
+			found = true
+		}
+	}
+	if !found || len(state.Players) != 2 {
+		t.Errorf("Expected the lobby state to include the rejoined player, got %+v", state.Players)
+	}
+}
+
+func TestAuthMiddleware_RequireAuthToggle(t *testing.T) {
+	router, deps := newTestRouter()
+	router.Use(router.AuthMiddleware(deps))
+	conn := &mockConn{}
+
+	// Listing is public by default
+	dispatch(t, router, conn, ActionListLobbies, map[string]string{})
+	if _, ok := conn.last().(LobbyListResponse); !ok {
+		t.Fatalf("Expected lobby list, got %#v", conn.last())
+	}
+
+	router.RequireAuth[ActionListLobbies] = true
+	dispatch(t, router, conn, ActionListLobbies, map[string]string{})
+	expectErrorCode(t, conn.last(), ErrorCodeUserInactive)
+
+	session := deps.SessionManager.CreateSession("alice")
+	dispatch(t, router, conn, ActionListLobbies, map[string]string{"user_id": session.ID, "token": "wrong"})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidToken)
+
+	dispatch(t, router, conn, ActionListLobbies, map[string]string{"user_id": session.ID, "token": session.Token})
+	if _, ok := conn.last().(LobbyListResponse); !ok {
+		t.Fatalf("Expected lobby list with valid credentials, got %#v", conn.last())
+	}
+}
+
+func TestCreateLobbyHandler_NameValidator(t *testing.T) {
+	router, deps := newTestRouter()
+	deps.LobbyManager.LobbyNameValidator = func(name string) error {
+		if strings.Contains(strings.ToLower(name), "badword") {
+			return errors.New("name contains a banned word")
+		}
+		return nil
+	}
+	conn := &mockConn{}
+	session := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "My BadWord Lobby", "max_players": 4, "user_id": session.ID, "token": session.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+	if len(deps.LobbyManager.ListLobbies()) != 0 {
+		t.Fatal("Rejected lobby should not be created")
+	}
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Friendly Lobby", "max_players": 4, "user_id": session.ID, "token": session.Token,
+	})
+	if _, ok := conn.last().(LobbyStateResponse); !ok {
+		t.Fatalf("Expected lobby state for accepted name, got %#v", conn.last())
+	}
+}
+
+func TestRegisterUserHandler_Lockout(t *testing.T) {
+	router, deps := newTestRouter()
+	deps.SessionManager.MaxReconnectAttempts = 2
+	deps.SessionManager.ReconnectLockout = time.Minute
+	conn := &mockConn{}
+	session := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": "guess1"})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidToken)
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": "guess2"})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidToken)
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": session.Token})
+	expectErrorCode(t, conn.last(), ErrorCodeTooManyAttempts)
+}
+
+func TestReadyAndMaybeStartHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Quick Match", "max_players": 2, "auto_start": true, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+
+	// Not everyone is ready yet
+	dispatch(t, router, conn, ActionReadyAndMaybeStart, map[string]interface{}{
+		"lobby_id": lobbyID, "ready": true, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobby, _ := deps.LobbyManager.GetLobbyByID(LobbyID(lobbyID))
+	if lobby.State != LobbyWaiting {
+		t.Fatalf("Expected lobby to keep waiting, got state %d", lobby.State)
+	}
+
+	// The last player readying starts the game
+	dispatch(t, router, conn, ActionReadyAndMaybeStart, map[string]interface{}{
+		"lobby_id": lobbyID, "ready": true, "user_id": bob.ID, "token": bob.Token,
+	})
+	if lobby.State != LobbyInGame {
+		t.Fatalf("Expected last ready to start the game, got state %d", lobby.State)
+	}
+	started := false
+	for _, msg := range rec.received(alice.ID) {
+		if _, ok := msg.(GameStartedResponse); ok {
+			started = true
+		}
+	}
+	if !started {
+		t.Error("Expected game_started to be broadcast")
+	}
+}
+
+func TestSetPlayersMetadataHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Teams", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	lobby, _ := deps.LobbyManager.GetLobbyByID(LobbyID(lobbyID))
+
+	// A missing player rejects the whole update
+	dispatch(t, router, conn, ActionSetPlayersMetadata, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token,
+		"players": map[string]interface{}{
+			alice.ID: map[string]interface{}{"team": "red"},
+			"ghost":  map[string]interface{}{"team": "blue"},
+		},
+	})
+	expectErrorCode(t, conn.last(), ErrorCodePlayerNotInLobby)
+	if lobby.Players[0].Metadata != nil {
+		t.Fatalf("Expected no metadata applied, got %v", lobby.Players[0].Metadata)
+	}
+
+	// Only the owner may assign metadata
+	dispatch(t, router, conn, ActionSetPlayersMetadata, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+		"players": map[string]interface{}{bob.ID: map[string]interface{}{"team": "red"}},
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+
+	rec.reset()
+	dispatch(t, router, conn, ActionSetPlayersMetadata, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token,
+		"players": map[string]interface{}{
+			alice.ID: map[string]interface{}{"team": "red"},
+			bob.ID:   map[string]interface{}{"team": "blue"},
+		},
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || state.Players[0].Metadata["team"] != "red" || state.Players[1].Metadata["team"] != "blue" {
+		t.Fatalf("Expected both players' teams to be set, got %#v", conn.last())
+	}
+	if got := len(rec.received(bob.ID)); got != 1 {
+		t.Errorf("Expected a single broadcast, got %d", got)
+	}
+}
+
+func TestJoinLobbyHandler_InGame(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+	carol := deps.SessionManager.CreateSession("carol")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	if _, ok := conn.last().(LobbyStateResponse); !ok {
+		t.Fatalf("Expected lobby state when joining a waiting lobby, got %#v", conn.last())
+	}
+
+	deps.LobbyManager.StartGame(LobbyID(lobbyID), alice.ID)
+
+	// Mid-game joins are rejected unless enabled
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": carol.ID, "token": carol.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeLobbyNotWaiting)
+
+	deps.LobbyManager.AllowMidGameJoin = true
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": carol.ID, "token": carol.Token,
+	})
+	resp, ok := conn.last().(InGameJoinResponse)
+	if !ok {
+		t.Fatalf("Expected in-game join response, got %#v", conn.last())
+	}
+	if resp.PlayerID != carol.ID || len(resp.Players) != 3 || resp.State != "in_game" || resp.StartedAt.IsZero() {
+		t.Errorf("Unexpected in-game join response %#v", resp)
+	}
+}
+
+func TestStartGameHandler_ExternalStartCheck(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+	serverReady := false
+	deps.LobbyManager.ExternalStartCheck = func(ctx context.Context, l *Lobby) error {
+		if !serverReady {
+			return errors.New("match server not ready")
+		}
+		return nil
+	}
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	start := map[string]interface{}{"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token}
+
+	// Validation failures keep their own code
+	dispatch(t, router, conn, ActionStartGame, start)
+	expectErrorCode(t, conn.last(), ErrorCodeCannotStartGame)
+
+	deps.LobbyManager.SetPlayerReady(LobbyID(lobbyID), PlayerID(alice.ID), true)
+	deps.LobbyManager.SetPlayerReady(LobbyID(lobbyID), PlayerID(bob.ID), true)
+	dispatch(t, router, conn, ActionStartGame, start)
+	expectErrorCode(t, conn.last(), ErrorCodeStartBlocked)
+	if resp := conn.last().(ErrorResponse); resp.Details != "match server not ready" {
+		t.Errorf("Expected external reason in details, got %q", resp.Details)
+	}
+
+	serverReady = true
+	dispatch(t, router, conn, ActionStartGame, start)
+	if lobby, _ := deps.LobbyManager.GetLobbyByID(LobbyID(lobbyID)); lobby.State != LobbyInGame {
+		t.Errorf("Expected game to start once the external check passes, got state %d", lobby.State)
+	}
+}
+
+func TestStartGameHandler_Ack(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	deps.LobbyManager.SetPlayerReady(LobbyID(lobbyID), PlayerID(alice.ID), true)
+	deps.LobbyManager.SetPlayerReady(LobbyID(lobbyID), PlayerID(bob.ID), true)
+	rec.reset()
+
+	dispatch(t, router, conn, ActionStartGame, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token,
+	})
+	ack, ok := conn.last().(GameStartAckResponse)
+	if !ok || ack.Action != "game_start_ack" || ack.LobbyID != lobbyID || ack.StartedAt.IsZero() {
+		t.Fatalf("Expected a game_start_ack for the initiator, got %#v", conn.last())
+	}
+	for _, userID := range []string{alice.ID, bob.ID} {
+		var started *GameStartedResponse
+		for _, msg := range rec.received(userID) {
+			if resp, ok := msg.(GameStartedResponse); ok {
+				started = &resp
+			}
+		}
+		if started == nil {
+			t.Fatalf("Expected %s to receive the game_started broadcast", userID)
+		}
+		if !started.StartedAt.Equal(ack.StartedAt) {
+			t.Errorf("Expected the ack to carry the broadcast start time %v, got %v", started.StartedAt, ack.StartedAt)
+		}
+	}
+	for _, msg := range rec.received(bob.ID) {
+		if _, ok := msg.(GameStartAckResponse); ok {
+			t.Error("Only the initiator should receive the ack")
+		}
+	}
+}
+
+func TestSetReadyHandler_ErrorCodes(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+
+	dispatch(t, router, conn, ActionSetReady, map[string]interface{}{
+		"lobby_id": lobbyID, "ready": true, "user_id": bob.ID, "token": bob.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodePlayerNotInLobby)
+
+	dispatch(t, router, conn, ActionSetReady, map[string]interface{}{
+		"lobby_id": "Nowhere", "ready": true, "user_id": alice.ID, "token": alice.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeLobbyNotFound)
+
+	deps.LobbyManager.StartGame(LobbyID(lobbyID), alice.ID)
+	dispatch(t, router, conn, ActionSetReady, map[string]interface{}{
+		"lobby_id": lobbyID, "ready": true, "user_id": alice.ID, "token": alice.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeLobbyNotWaiting)
+}
+
+func TestLobbyStateBroadcast_MatchesHandlerResponse(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+
+	broadcasts := rec.received(alice.ID)
+	broadcast, ok := broadcasts[len(broadcasts)-1].(LobbyStateResponse)
+	if !ok {
+		t.Fatalf("Expected lobby_state broadcast without a configured builder, got %#v", broadcasts[len(broadcasts)-1])
+	}
+	response := conn.last().(LobbyStateResponse)
+	broadcast.Reason = ""
+	if !reflect.DeepEqual(broadcast, response) {
+		t.Errorf("Broadcast %#v differs from handler response %#v", broadcast, response)
+	}
+}
+
+func TestLobbyResponses_MinPlayers(t *testing.T) {
+	deps := &HandlerDeps{
+		SessionManager: NewSessionManager(),
+		LobbyManager:   NewLobbyManagerWithEvents(&LobbyEvents{}),
+		ConnToUserID:   NewConnRegistry(0),
+	}
+	router := NewMessageRouter()
+	router.SetupDefaultHandlersWithCustom(deps, &HandlerOptions{GameStartConfig: NewTournamentConfig()})
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 8, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	if state := conn.last().(LobbyStateResponse); state.MinPlayers != 4 {
+		t.Errorf("Expected min_players 4 from the tournament config, got %d", state.MinPlayers)
+	}
+	dispatch(t, router, conn, ActionGetLobbyInfo, map[string]interface{}{"lobby_id": lobbyID})
+	if info, ok := conn.last().(LobbyInfoResponse); !ok || info.MinPlayers != 4 {
+		t.Errorf("Expected lobby info with min_players 4, got %#v", conn.last())
+	}
+
+	// A per-lobby override wins over the config
+	lobby, _ := deps.LobbyManager.CreateLobbyWithOptions("Duel", 2, true, nil, alice.ID, LobbyOptions{MinPlayers: 2})
+	if got := NewResponseBuilder(deps.LobbyManager).BuildLobbyStateResponse(lobby).MinPlayers; got != 2 {
+		t.Errorf("Expected per-lobby min_players 2, got %d", got)
+	}
+}
+
+func TestStrictJSON_UnknownFields(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	payload := map[string]interface{}{
+		"name": "Arena", "max_players": 4, "pubic": true, "user_id": alice.ID, "token": alice.Token,
+	}
+
+	// Lenient by default: the typo is ignored
+	dispatch(t, router, conn, ActionCreateLobby, payload)
+	if _, ok := conn.last().(LobbyStateResponse); !ok {
+		t.Fatalf("Expected lenient decoding to accept the payload, got %#v", conn.last())
+	}
+
+	deps.StrictJSON = true
+	payload["name"] = "Arena 2"
+	dispatch(t, router, conn, ActionCreateLobby, payload)
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+	if resp := conn.last().(ErrorResponse); !strings.Contains(resp.Details, "pubic") {
+		t.Errorf("Expected the offending field in details, got %q", resp.Details)
+	}
+	if _, exists := deps.LobbyManager.GetLobbyByID("Arena 2"); exists {
+		t.Error("Rejected payload should not create a lobby")
+	}
+}
+
+// rawConn records payloads sent through WriteRaw alongside plain WriteJSON messages.
+type rawConn struct {
+	mockConn
+	raw        [][]byte
+	compressed []bool
+}
+
+func (c *rawConn) WriteRaw(data []byte, compressed bool) error {
+	c.raw = append(c.raw, data)
+	c.compressed = append(c.compressed, compressed)
+	return nil
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	codec := &Codec{Threshold: 64}
+	small := map[string]string{"action": "pong"}
+	large := LobbyStateResponse{Action: "lobby_state", LobbyID: "room", Reason: strings.Repeat("x", 256)}
+
+	for _, compression := range []Compression{CompressionGzip, CompressionDeflate} {
+		conn := &rawConn{}
+		wrapped := codec.WrapConn(conn, compression)
+		if err := wrapped.WriteJSON(small); err != nil {
+			t.Fatalf("%s: WriteJSON failed: %v", compression, err)
+		}
+		if err := wrapped.WriteJSON(large); err != nil {
+			t.Fatalf("%s: WriteJSON failed: %v", compression, err)
+		}
+		if len(conn.raw) != 2 || conn.compressed[0] || !conn.compressed[1] {
+			t.Fatalf("%s: expected only the large payload compressed, got %v", compression, conn.compressed)
+		}
+
+		plain, err := Decompress(conn.raw[1], compression)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", compression, err)
+		}
+		want, _ := json.Marshal(large)
+		if string(plain) != string(want) {
+			t.Errorf("%s: round trip mismatch:\n got %s\nwant %s", compression, plain, want)
+		}
+	}
+}
+
+func TestCodec_WrapConnWithoutCompression(t *testing.T) {
+	codec := &Codec{}
+	conn := &rawConn{}
+	if codec.WrapConn(conn, CompressionNone) != Conn(conn) {
+		t.Error("Expected conn unchanged when no compression was negotiated")
+	}
+	plain := &mockConn{}
+	if codec.WrapConn(plain, CompressionGzip) != Conn(plain) {
+		t.Error("Expected conn without WriteRaw unchanged")
+	}
+}
+
+func TestRegisterUserHandler_NegotiatesCompression(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	dispatch(t, router, conn, ActionRegisterUser, map[string]interface{}{"username": "alice", "compression": []string{"br", "deflate"}})
+	resp, ok := conn.last().(RegisterUserResponse)
+	if !ok || resp.Compression != "" {
+		t.Fatalf("Expected no compression without a codec, got %#v", conn.last())
+	}
+
+	deps.Codec = &Codec{}
+	dispatch(t, router, conn, ActionRegisterUser, map[string]interface{}{"username": "bob", "compression": []string{"br", "deflate"}})
+	resp = conn.last().(RegisterUserResponse)
+	if resp.Compression != string(CompressionDeflate) {
+		t.Fatalf("Expected deflate, got %q", resp.Compression)
+	}
+	session, _ := deps.SessionManager.GetSessionByID(resp.UserID)
+	if session.Compression != CompressionDeflate {
+		t.Errorf("Expected session compression deflate, got %q", session.Compression)
+	}
+}
+
+func TestOutgoingTransformMiddleware(t *testing.T) {
+	router, deps := newTestRouter()
+	deps.LobbyManager.Events.OutgoingTransform = func(userID string, message interface{}) interface{} {
+		return map[string]interface{}{"build": "1.2.3", "user_id": userID, "message": message}
+	}
+	router.Use(router.OutgoingTransformMiddleware(deps))
+
+	conn := &mockConn{}
+	dispatch(t, router, conn, ActionRegisterUser, map[string]interface{}{"username": "alice"})
+	reg, ok := conn.last().(RegisterUserResponse)
+	if !ok {
+		t.Fatalf("Expected register_user response untransformed, got %#v", conn.last())
+	}
+
+	dispatch(t, router, conn, ActionGetLobbyInfo, map[string]interface{}{"lobby_id": "missing", "user_id": reg.UserID, "token": reg.Token})
+	wrapped, ok := conn.last().(map[string]interface{})
+	if !ok || wrapped["build"] != "1.2.3" || wrapped["user_id"] != reg.UserID {
+		t.Fatalf("Expected injected fields, got %#v", conn.last())
+	}
+	expectErrorCode(t, wrapped["message"], ErrorCodeLobbyNotFound)
+}
+
+func TestErrorFieldsMiddleware(t *testing.T) {
+	router, _ := newTestRouter()
+	router.Use(router.ErrorFieldsMiddleware(ErrorFieldNames{Code: "error_code", Message: "error_message"}))
+
+	conn := &mockConn{}
+	dispatch(t, router, conn, ActionGetLobbyInfo, map[string]interface{}{"lobby_id": "missing"})
+	data, err := json.Marshal(conn.last())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	want := map[string]interface{}{
+		"action":        "error",
+		"error_code":    string(ErrorCodeLobbyNotFound),
+		"error_message": "Lobby not found",
+		"details":       "Lobby ID: missing",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %s", want, data)
+	}
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]interface{}{"username": "alice"})
+	if _, ok := conn.last().(RegisterUserResponse); !ok {
+		t.Errorf("Expected other responses untouched, got %#v", conn.last())
+	}
+}
+
+func TestJoinLobbyHandler_SpectateWhenFull(t *testing.T) {
+	router, deps := newTestRouter()
+	deps.LobbyManager.SpectateWhenFull = true
+	lobby, _ := deps.LobbyManager.CreateLobbyWithOptions("Arena", 1, true, nil, "owner", LobbyOptions{MaxSpectators: 1})
+	deps.LobbyManager.JoinLobby(lobby.ID, &Player{ID: "owner", Username: "Owner"})
+
+	join := func(username string) *mockConn {
+		conn := &mockConn{}
+		dispatch(t, router, conn, ActionRegisterUser, map[string]interface{}{"username": username})
+		reg := conn.last().(RegisterUserResponse)
+		dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{"lobby_id": string(lobby.ID), "user_id": reg.UserID, "token": reg.Token})
+		return conn
+	}
+
+	state, ok := join("alice").last().(LobbyStateResponse)
+	if !ok || !state.Spectating {
+		t.Fatalf("Expected a spectating lobby_state, got %#v", state)
+	}
+	if len(state.Players) != 1 || len(state.Spectators) != 1 || state.Spectators[0].Role != RoleSpectator {
+		t.Errorf("Expected one player and one spectator, got %d and %#v", len(state.Players), state.Spectators)
+	}
+
+	expectErrorCode(t, join("bob").last(), ErrorCodeSpectatorsFull)
+
+	// Reconnecting keeps a spectator spectating rather than seating them
+	alice := deps.SessionManager.GetSessionsByUsername("alice")[0]
+	conn := &mockConn{}
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice", "token": alice.Token})
+	if state, ok := conn.last().(LobbyStateResponse); !ok || len(state.Players) != 1 || len(state.Spectators) != 1 {
+		t.Fatalf("Expected the reconnected spectator to stay a spectator, got %#v", conn.last())
+	}
+
+	// What a transport does when alice's socket closes
+	lobbyID, _ := deps.SessionManager.GetLobbyID(alice.ID)
+	if lobbyID != string(lobby.ID) {
+		t.Fatalf("Expected the spectator's session to record the lobby, got %q", lobbyID)
+	}
+	deps.LobbyManager.DisconnectPlayer(LobbyID(lobbyID), PlayerID(alice.ID))
+	if state, ok := join("carol").last().(LobbyStateResponse); !ok || !state.Spectating {
+		t.Errorf("Expected the disconnected spectator's place to be free, got %#v", state)
+	}
+}
+
+func TestKickPlayerHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+
+	dispatch(t, router, conn, ActionKickPlayer, map[string]interface{}{
+		"lobby_id": lobbyID, "target_id": alice.ID, "user_id": bob.ID, "token": bob.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+
+	dispatch(t, router, conn, ActionKickPlayer, map[string]interface{}{
+		"lobby_id": lobbyID, "target_id": bob.ID, "user_id": alice.ID, "token": alice.Token,
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || len(state.Players) != 1 {
+		t.Fatalf("Expected lobby state without the kicked player, got %#v", conn.last())
+	}
+	if lobbyID, _ := deps.SessionManager.GetLobbyID(bob.ID); lobbyID != "" {
+		t.Errorf("Expected kicked player's session lobby cleared, got %q", lobbyID)
+	}
+}
+
+func TestListBansHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+	carol := deps.SessionManager.CreateSession("carol")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	for _, s := range []*UserSession{bob, carol} {
+		dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+			"lobby_id": lobbyID, "user_id": s.ID, "token": s.Token,
+		})
+	}
+	if err := deps.LobbyManager.BanPlayer(LobbyID(lobbyID), alice.ID, PlayerID(carol.ID), "spam"); err != nil {
+		t.Fatalf("BanPlayer failed: %v", err)
+	}
+
+	dispatch(t, router, conn, ActionListBans, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+
+	deps.LobbyManager.AddModerator(LobbyID(lobbyID), alice.ID, PlayerID(bob.ID))
+	dispatch(t, router, conn, ActionListBans, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	resp, ok := conn.last().(BansResponse)
+	if !ok || resp.LobbyID != lobbyID || len(resp.Bans) != 1 {
+		t.Fatalf("Expected a bans reply with one ban, got %#v", conn.last())
+	}
+	if ban := resp.Bans[0]; ban.PlayerID != PlayerID(carol.ID) || ban.Username != "carol" || ban.Reason != "spam" || ban.BannedBy != alice.ID {
+		t.Errorf("Unexpected ban entry %+v", ban)
+	}
+}
+
+func TestChatMessageHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	deps.LobbyManager.MaxChatLength = 10
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+	eve := deps.SessionManager.CreateSession("eve")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	rec.reset()
+
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token, "text": "gl hf",
+	})
+	for _, userID := range []string{alice.ID, bob.ID} {
+		msgs := rec.received(userID)
+		if len(msgs) != 1 {
+			t.Fatalf("Expected one chat message for %s, got %v", userID, msgs)
+		}
+		chat, ok := msgs[0].(ChatMessageResponse)
+		if !ok || chat.Text != "gl hf" || chat.UserID != alice.ID || chat.Username != "alice" || chat.Timestamp.IsZero() {
+			t.Errorf("Unexpected chat message for %s: %#v", userID, msgs[0])
+		}
+	}
+
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token, "text": "far too long",
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": eve.ID, "token": eve.Token, "text": "hi",
+	})
+	expectErrorCode(t, conn.last(), ErrorCodePlayerNotInLobby)
+
+	if err := deps.LobbyManager.MutePlayer(LobbyID(lobbyID), alice.ID, PlayerID(bob.ID), time.Minute); err != nil {
+		t.Fatalf("MutePlayer failed: %v", err)
+	}
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token, "text": "hi",
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+
+	if got := rec.received(bob.ID); len(got) != 1 {
+		t.Errorf("Rejected messages should not be broadcast, bob got %v", got)
+	}
+}
+
+func TestListLobbiesDetailedHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+
+	dispatch(t, router, conn, ActionListLobbiesDetailed, map[string]string{})
+	resp, ok := conn.last().(LobbyListDetailedResponse)
+	if !ok || len(resp.Lobbies) != 1 {
+		t.Fatalf("Expected a detailed list with one lobby, got %#v", conn.last())
+	}
+	if summary := resp.Lobbies[0]; summary.LobbyID != lobbyID || summary.Name != "Arena" || summary.PlayerCount != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+}
+
+func TestListLobbiesHandler_Filter(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	deps.LobbyManager.CreateLobby("Public", 4, true, nil, "p1")
+	deps.LobbyManager.CreateLobby("Hidden", 4, false, nil, "p2")
+
+	dispatch(t, router, conn, ActionListLobbies, map[string]interface{}{
+		"filter": map[string]interface{}{"public_only": true, "state": "waiting"},
+	})
+	resp, ok := conn.last().(LobbyListResponse)
+	if !ok || len(resp.Lobbies) != 1 {
+		t.Fatalf("Expected one public lobby, got %#v", conn.last())
+	}
+
+	dispatch(t, router, conn, ActionListLobbies, map[string]interface{}{
+		"filter": map[string]interface{}{"name_contains": "nobody"},
+	})
+	if resp := conn.last().(LobbyListResponse); len(resp.Lobbies) != 0 {
+		t.Errorf("Expected no matches, got %v", resp.Lobbies)
+	}
+
+	dispatch(t, router, conn, ActionListLobbies, map[string]interface{}{
+		"filter": map[string]interface{}{"state": "paused"},
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+}
+
+func TestListLobbiesHandler_Paged(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	for i := 0; i < 3; i++ {
+		deps.LobbyManager.CreateLobby(fmt.Sprintf("Lobby %d", i), 4, true, nil, "owner")
+	}
+
+	dispatch(t, router, conn, ActionListLobbies, map[string]interface{}{"offset": 0, "limit": 2})
+	resp, ok := conn.last().(LobbyListResponse)
+	if !ok || len(resp.Lobbies) != 2 || resp.Total != 3 || !resp.HasMore {
+		t.Fatalf("Expected the first page of 2 with more to come, got %#v", conn.last())
+	}
+
+	dispatch(t, router, conn, ActionListLobbiesDetailed, map[string]interface{}{"offset": 2, "limit": 2})
+	detailed, ok := conn.last().(LobbyListDetailedResponse)
+	if !ok || len(detailed.Lobbies) != 1 || detailed.Total != 3 || detailed.HasMore {
+		t.Fatalf("Expected the last page of 1, got %#v", conn.last())
+	}
+}
+
+func TestSetTeamHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Teams", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+		"team_count": 2, "max_per_team": 2,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+
+	dispatch(t, router, conn, ActionSetTeam, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token, "team": 2,
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || state.TeamCount != 2 || len(state.Players) != 1 || state.Players[0].Team != 2 {
+		t.Fatalf("Expected lobby state with alice on team 2, got %#v", conn.last())
+	}
+
+	dispatch(t, router, conn, ActionSetTeam, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token, "team": 5,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+}
+
+func TestCreateLobbyHandler_PersistWhenEmpty(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	for _, persist := range []bool{true, false} {
+		dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+			"name": fmt.Sprintf("Room %v", persist), "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+			"persist_when_empty": persist,
+		})
+		lobbyID := conn.last().(LobbyStateResponse).LobbyID
+		dispatch(t, router, conn, ActionLeaveLobby, map[string]interface{}{
+			"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token,
+		})
+		if _, exists := deps.LobbyManager.GetLobbyByID(LobbyID(lobbyID)); exists != persist {
+			t.Errorf("persist_when_empty %v: expected lobby to exist %v after the last player left", persist, persist)
+		}
+	}
+}
+
+func TestCreateLobbyHandler_DeleteOnEmpty(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	for _, tc := range []struct {
+		deleteOnEmpty interface{}
+		keep          bool
+	}{{nil, false}, {true, false}, {false, true}} {
+		data := map[string]interface{}{
+			"name": fmt.Sprintf("Room %v", tc.deleteOnEmpty), "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+		}
+		if tc.deleteOnEmpty != nil {
+			data["delete_on_empty"] = tc.deleteOnEmpty
+		}
+		dispatch(t, router, conn, ActionCreateLobby, data)
+		lobbyID := conn.last().(LobbyStateResponse).LobbyID
+		dispatch(t, router, conn, ActionLeaveLobby, map[string]interface{}{
+			"lobby_id": lobbyID, "user_id": alice.ID, "token": alice.Token,
+		})
+		if _, exists := deps.LobbyManager.GetLobbyByID(LobbyID(lobbyID)); exists != tc.keep {
+			t.Errorf("delete_on_empty %v: expected lobby to exist %v after the last player left", tc.deleteOnEmpty, tc.keep)
+		}
+	}
+}
+
+func TestRematchHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Finals", "max_players": 2, "user_id": alice.ID, "token": alice.Token,
+	})
+	oldID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": oldID, "user_id": bob.ID, "token": bob.Token,
+	})
+
+	dispatch(t, router, conn, ActionRematch, map[string]interface{}{
+		"lobby_id": oldID, "user_id": bob.ID, "token": bob.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+
+	dispatch(t, router, conn, ActionRematch, map[string]interface{}{
+		"lobby_id": oldID, "user_id": alice.ID, "token": alice.Token,
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || state.LobbyID == oldID || len(state.Players) != 2 {
+		t.Fatalf("Expected the new lobby with both players, got %#v", conn.last())
+	}
+	for _, id := range []string{alice.ID, bob.ID} {
+		if lobbyID, _ := deps.SessionManager.GetLobbyID(id); lobbyID != state.LobbyID {
+			t.Errorf("Expected session %s to follow to the new lobby, got %q", id, lobbyID)
+		}
+	}
+}
+
+func TestCreateLobbyHandler_PlayerLimits(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	create := func(maxPlayers int) {
+		dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+			"name": "Room", "max_players": maxPlayers, "user_id": alice.ID, "token": alice.Token,
+		})
+	}
+
+	deps.PlayerLimits = &PlayerLimits{Min: 2, Max: 16}
+	for _, maxPlayers := range []int{1, 1000000} {
+		create(maxPlayers)
+		expectErrorCode(t, conn.last(), ErrorCodeInvalidRequest)
+	}
+	create(16)
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok {
+		t.Fatalf("Expected max_players at the bound to be accepted, got %#v", conn.last())
+	}
+	deps.LobbyManager.LeaveLobby(LobbyID(state.LobbyID), PlayerID(alice.ID))
+
+	deps.PlayerLimits.Clamp = true
+	create(1000000)
+	state, ok = conn.last().(LobbyStateResponse)
+	if !ok {
+		t.Fatalf("Expected the request to be clamped, got %#v", conn.last())
+	}
+	if lobby, _ := deps.LobbyManager.GetLobbyByID(LobbyID(state.LobbyID)); lobby.MaxPlayers != 16 {
+		t.Errorf("Expected max_players clamped to 16, got %d", lobby.MaxPlayers)
+	}
+}
+
+func TestHeartbeatHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionHeartbeat, map[string]interface{}{"user_id": alice.ID, "token": "wrong"})
+	expectErrorCode(t, conn.last(), ErrorCodeInvalidToken)
+
+	dispatch(t, router, conn, ActionHeartbeat, map[string]interface{}{"user_id": alice.ID, "token": alice.Token})
+	if pong, ok := conn.last().(PongResponse); !ok || pong.Action != "pong" {
+		t.Fatalf("Expected pong, got %#v", conn.last())
+	}
+}
+
+func TestQuickJoinHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+
+	dispatch(t, router, conn, ActionQuickJoin, map[string]interface{}{
+		"user_id": alice.ID, "token": alice.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeNoMatchingLobby)
+
+	dispatch(t, router, conn, ActionQuickJoin, map[string]interface{}{
+		"user_id": alice.ID, "token": alice.Token, "create_if_none": true, "name": "Play Now",
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || len(state.Players) != 1 {
+		t.Fatalf("Expected lobby state for the created lobby, got %#v", conn.last())
+	}
+	if lobbyID, _ := deps.SessionManager.GetLobbyID(alice.ID); lobbyID != state.LobbyID {
+		t.Errorf("Expected session lobby %s, got %q", state.LobbyID, lobbyID)
+	}
+}
+
+func TestJoinLobbyByNameHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Friday Night", "max_players": 4, "public": true, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+
+	dispatch(t, router, conn, ActionJoinLobbyByName, map[string]interface{}{
+		"name": " friday  NIGHT ", "user_id": bob.ID, "token": bob.Token,
+	})
+	state, ok := conn.last().(LobbyStateResponse)
+	if !ok || state.LobbyID != lobbyID || len(state.Players) != 2 {
+		t.Fatalf("Expected bob to join %s by name, got %#v", lobbyID, conn.last())
+	}
+	if current, _ := deps.SessionManager.GetLobbyID(bob.ID); current != lobbyID {
+		t.Errorf("Expected session lobby %s, got %q", lobbyID, current)
+	}
+
+	dispatch(t, router, conn, ActionJoinLobbyByName, map[string]interface{}{
+		"name": "Saturday", "user_id": bob.ID, "token": bob.Token,
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeLobbyNotFound)
+}
+
+// blockingConn is a Conn whose writes block until release is closed.
+type blockingConn struct {
+	release chan struct{}
+}
+
+func (c *blockingConn) WriteJSON(v interface{}) error {
+	<-c.release
+	return nil
+}
+
+func TestTimeoutConn(t *testing.T) {
+	stalled := &blockingConn{release: make(chan struct{})}
+	conn := NewTimeoutConn(stalled, 20*time.Millisecond)
+
+	start := time.Now()
+	if err := conn.WriteJSON("hello"); err != ErrWriteTimeout {
+		t.Fatalf("Expected ErrWriteTimeout from a stalled client, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Write should give up after the timeout, took %v", elapsed)
+	}
+
+	// While the first write is stuck, later ones fail at once
+	start = time.Now()
+	if err := conn.WriteJSON("again"); err != ErrWriteTimeout {
+		t.Errorf("Expected ErrWriteTimeout while a write is stuck, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 20*time.Millisecond {
+		t.Errorf("Expected a stuck connection to fail fast, took %v", elapsed)
+	}
+
+	close(stalled.release)
+	deadline := time.Now().Add(time.Second)
+	err := conn.WriteJSON("recovered")
+	for err == ErrWriteTimeout && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		err = conn.WriteJSON("recovered")
+	}
+	if err != nil {
+		t.Errorf("Expected writes to resume once the stuck write returns, got %v", err)
+	}
+
+	fast := &mockConn{}
+	if err := NewTimeoutConn(fast, time.Second).WriteJSON("hi"); err != nil || fast.last() != "hi" {
+		t.Errorf("Expected a prompt write to go through, got %v", err)
+	}
+}
+
+func TestRenameUserHandler(t *testing.T) {
+	router, deps := newTestRouter()
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Arena", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+	})
+	lobbyID := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionJoinLobby, map[string]interface{}{
+		"lobby_id": lobbyID, "user_id": bob.ID, "token": bob.Token,
+	})
+	rec.reset()
+
+	dispatch(t, router, conn, ActionRenameUser, map[string]interface{}{
+		"user_id": alice.ID, "token": alice.Token, "username": "bob",
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUsernameTaken)
+
+	dispatch(t, router, conn, ActionRenameUser, map[string]interface{}{
+		"user_id": alice.ID, "token": alice.Token, "username": "Alicia",
+	})
+	if resp, ok := conn.last().(UserRenamedResponse); !ok || resp.Username != "Alicia" || resp.UserID != alice.ID {
+		t.Fatalf("Expected user_renamed for Alicia, got %#v", conn.last())
+	}
+	msgs := rec.received(bob.ID)
+	if len(msgs) != 1 {
+		t.Fatalf("Expected bob to get one lobby_state, got %v", msgs)
+	}
+	state := msgs[0].(LobbyStateResponse)
+	if state.Reason != ReasonPlayerRenamed {
+		t.Errorf("Expected reason %s, got %s", ReasonPlayerRenamed, state.Reason)
+	}
+	for _, p := range state.Players {
+		if p.UserID == alice.ID && p.Username != "Alicia" {
+			t.Errorf("Expected the lobby to show the new name, got %q", p.Username)
+		}
+	}
+}
+
+func TestConnRegistry_ConcurrentAddRemove(t *testing.T) {
+	registry := NewConnRegistry(0)
+	conns := make([]*mockConn, 50)
+	for i := range conns {
+		conns[i] = &mockConn{}
+	}
+
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *mockConn) {
+			defer wg.Done()
+			registry.Add(conn, strings.Repeat("u", i+1))
+			if _, ok := registry.Get(conn); !ok {
+				t.Errorf("Expected connection %d to be registered", i)
+			}
+			if i%2 == 0 {
+				registry.Remove(conn)
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+
+	if got := registry.Count(); got != 25 {
+		t.Errorf("Expected 25 connections left, got %d", got)
+	}
+	if userID, ok := registry.Get(conns[1]); !ok || userID != "uu" {
+		t.Errorf("Expected conns[1] to map to uu, got %q (ok=%v)", userID, ok)
+	}
+}
+
+func TestConnRegistry_MaxSizeEvictsOldest(t *testing.T) {
+	registry := NewConnRegistry(2)
+	var evicted []string
+	registry.OnEvict = func(conn Conn, userID string) { evicted = append(evicted, userID) }
+	first, second, third := &mockConn{}, &mockConn{}, &mockConn{}
+
+	registry.Add(first, "alice")
+	registry.Add(second, "bob")
+	registry.Add(first, "alice") // Re-registering refreshes first
+	registry.Add(third, "carol")
+
+	if registry.Count() != 2 {
+		t.Fatalf("Expected 2 connections, got %d", registry.Count())
+	}
+	if _, ok := registry.Get(second); ok {
+		t.Error("Expected the least recently added connection to be evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "bob" {
+		t.Errorf("Expected OnEvict for bob, got %v", evicted)
+	}
+}
+
+func TestRegisterUserHandler_RegistryFreedOnDisconnect(t *testing.T) {
+	router, deps := newTestRouter()
+	conn := &mockConn{}
+
+	dispatch(t, router, conn, ActionRegisterUser, map[string]string{"username": "alice"})
+	registered := conn.last().(RegisterUserResponse)
+	if userID, ok := deps.ConnToUserID.Get(conn); !ok || userID != registered.UserID {
+		t.Fatalf("Expected connection registered to %s, got %q", registered.UserID, userID)
+	}
+
+	// What a transport does when the socket closes
+	deps.ConnToUserID.Remove(conn)
+	if deps.ConnToUserID.Count() != 0 {
+		t.Errorf("Expected no connections after disconnect, got %d", deps.ConnToUserID.Count())
+	}
+}
+
+func TestLobbyActionsMiddleware(t *testing.T) {
+	router, deps := newTestRouter()
+	router.Use(router.LobbyActionsMiddleware(deps))
+	rec := newRecordingBroadcaster()
+	deps.LobbyManager.Events.Broadcaster = rec.broadcast
+	conn := &mockConn{}
+	alice := deps.SessionManager.CreateSession("alice")
+	bob := deps.SessionManager.CreateSession("bob")
+
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Ranked", "max_players": 4, "user_id": alice.ID, "token": alice.Token,
+		"allowed_actions": map[string]bool{"chat_message": false},
+	})
+	ranked := conn.last().(LobbyStateResponse).LobbyID
+	dispatch(t, router, conn, ActionCreateLobby, map[string]interface{}{
+		"name": "Casual", "max_players": 4, "user_id": bob.ID, "token": bob.Token,
+	})
+	casual := conn.last().(LobbyStateResponse).LobbyID
+	rec.reset()
+
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": ranked, "user_id": alice.ID, "token": alice.Token, "text": "hi",
+	})
+	expectErrorCode(t, conn.last(), ErrorCodeUnauthorized)
+	if got := rec.received(alice.ID); len(got) != 0 {
+		t.Errorf("Forbidden chat should not be broadcast, got %v", got)
+	}
+
+	dispatch(t, router, conn, ActionChatMessage, map[string]interface{}{
+		"lobby_id": casual, "user_id": bob.ID, "token": bob.Token, "text": "hi",
+	})
+	if got := rec.received(bob.ID); len(got) != 1 {
+		t.Errorf("Expected chat in the casual lobby to be broadcast, got %v", got)
+	}
+
+	// Other actions in the ranked lobby are unaffected
+	dispatch(t, router, conn, ActionSetReady, map[string]interface{}{
+		"lobby_id": ranked, "user_id": alice.ID, "token": alice.Token, "ready": true,
+	})
+	if _, ok := conn.last().(ErrorResponse); ok {
+		t.Errorf("Expected set_ready to be allowed, got %#v", conn.last())
+	}
+}
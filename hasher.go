@@ -0,0 +1,98 @@
+package lobby
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPBKDF2Iterations is the PBKDF2Hasher iteration count used when Iterations is not set.
+const DefaultPBKDF2Iterations = 600000
+
+// Hasher hashes secrets such as lobby passwords so only the hash needs to be kept. Set
+// LobbyManager.Hasher to change the algorithm or its cost, e.g. with a bcrypt adapter.
+type Hasher interface {
+	Hash(plain string) (string, error)
+	Verify(hash, plain string) bool
+}
+
+// PBKDF2Hasher is the default Hasher, using PBKDF2-SHA256 from the standard library so the
+// package needs no extra dependencies. Iterations is the work factor (default:
+// DefaultPBKDF2Iterations).
+type PBKDF2Hasher struct {
+	Iterations int
+}
+
+// Hash returns a hash of plain in the form "pbkdf2-sha256$iterations$salt$key", with a fresh
+// random salt.
+func (h PBKDF2Hasher) Hash(plain string) (string, error) {
+	iterations := h.Iterations
+	if iterations <= 0 {
+		iterations = DefaultPBKDF2Iterations
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, plain, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", iterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// Verify reports whether plain matches a hash made by Hash, whatever iteration count it was
+// made with. Malformed hashes never match.
+func (h PBKDF2Hasher) Verify(hash, plain string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, plain, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// hasher returns the configured Hasher, defaulting to PBKDF2Hasher.
+func (m *LobbyManager) hasher() Hasher {
+	if m.Hasher == nil {
+		return PBKDF2Hasher{}
+	}
+	return m.Hasher
+}
+
+// hashPassword hashes a password for storage. Lobby passwords are not supported yet; this is
+// where setting one will hash it.
+func (m *LobbyManager) hashPassword(plain string) (string, error) {
+	return m.hasher().Hash(plain)
+}
+
+// checkPassword reports whether plain matches a hash made by hashPassword. An empty hash means
+// no password is set, so anything matches.
+func (m *LobbyManager) checkPassword(hash, plain string) bool {
+	if hash == "" {
+		return true
+	}
+	return m.hasher().Verify(hash, plain)
+}
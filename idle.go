@@ -0,0 +1,119 @@
+package lobby
+
+import (
+	"context"
+	"time"
+)
+
+// SweepIdleOwners removes every owner not seen for longer than threshold from their lobby, as if
+// they had disconnected: ownership migrates per OwnerSelector, or the lobby closes if the owner
+// was alone in it. lastSeen reports when a user was last active; owners it does not know are
+// left alone. It returns the lobbies whose owner was removed.
+//
+// lastSeen is called without the manager's lock held, since SessionManager hooks may call back
+// into the manager while holding the session lock. Lobbies are rechecked afterwards, so an
+// owner who changed or left in the meantime is not removed.
+func (m *LobbyManager) SweepIdleOwners(lastSeen func(userID string) (time.Time, bool), threshold time.Duration) []LobbyID {
+	m.mu.Lock()
+	owners := make(map[LobbyID]string, len(m.lobbies))
+	for id, lobby := range m.lobbies {
+		if findPlayer(lobby, PlayerID(lobby.OwnerID)) != nil {
+			owners[id] = lobby.OwnerID
+		}
+	}
+	m.mu.Unlock()
+
+	cutoff := time.Now().Add(-threshold)
+	idle := make(map[LobbyID]string)
+	for id, ownerID := range owners {
+		if seen, ok := lastSeen(ownerID); ok && seen.Before(cutoff) {
+			idle[id] = ownerID
+		}
+	}
+	if len(idle) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var swept []LobbyID
+	for id, ownerID := range idle {
+		lobby, exists := m.lobbies[id]
+		if !exists || lobby.OwnerID != ownerID {
+			continue
+		}
+		owner := findPlayer(lobby, PlayerID(ownerID))
+		if owner == nil {
+			continue
+		}
+		if m.Events != nil && m.Events.OnOwnerIdle != nil {
+			m.emitPlayer(lobby, owner, m.Events.OnOwnerIdle)
+		}
+		m.notifyRemoved(lobby, owner.ID, RemovalIdle)
+		m.disconnectLocked(lobby, owner.ID, ReasonOwnerIdle)
+		m.removeIfAbandonedLocked(lobby)
+		swept = append(swept, id)
+	}
+	return swept
+}
+
+// StartIdleOwnerSweep runs SweepIdleOwners against the sessions' LastSeen every interval until
+// ctx is done. The returned channel is closed once the sweep loop has stopped.
+func (m *LobbyManager) StartIdleOwnerSweep(ctx context.Context, sessions *SessionManager, interval, threshold time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.SweepIdleOwners(sessions.LastSeen, threshold)
+			}
+		}
+	}()
+	return done
+}
+
+// ReapIdleLobbies deletes every waiting lobby whose LastActivity is older than maxIdle. Remaining
+// players get a removed_from_lobby message and OnLobbyDeleted fires as for DeleteLobby. Lobbies
+// in game and those with PersistWhenEmpty are never reaped. It returns the deleted lobbies.
+func (m *LobbyManager) ReapIdleLobbies(maxIdle time.Duration) []LobbyID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := time.Now().Add(-maxIdle)
+	var reaped []LobbyID
+	for id, lobby := range m.lobbies {
+		if lobby.State != LobbyWaiting || lobby.PersistWhenEmpty || !lobby.LastActivity.Before(cutoff) {
+			continue
+		}
+		for _, p := range lobby.Players {
+			m.notifyRemoved(lobby, p.ID, RemovalExpired)
+		}
+		m.removeLobbyLocked(lobby)
+		reaped = append(reaped, id)
+	}
+	return reaped
+}
+
+// StartReaper runs ReapIdleLobbies every interval until ctx is done. The returned channel is
+// closed once the reaper has stopped.
+func (m *LobbyManager) StartReaper(ctx context.Context, maxIdle, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.ReapIdleLobbies(maxIdle)
+			}
+		}
+	}()
+	return done
+}
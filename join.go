@@ -0,0 +1,105 @@
+package lobby
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultJoinConfirmTimeout is used when LobbyManager.JoinConfirmTimeout is unset.
+const DefaultJoinConfirmTimeout = 30 * time.Second
+
+// PendingJoin is a seat reserved by RequestJoin until it is confirmed or expires.
+type PendingJoin struct {
+	Token     string
+	LobbyID   LobbyID
+	Player    *Player
+	ExpiresAt time.Time
+}
+
+// RequestJoin reserves a seat in the lobby for the player without joining them yet, so they can
+// review the lobby before committing. The reservation counts toward capacity until ConfirmJoin
+// is called with its token or JoinConfirmTimeout elapses.
+func (m *LobbyManager) RequestJoin(lobbyID LobbyID, player *Player) (PendingJoin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return PendingJoin{}, ErrLobbyNotFound(string(lobbyID))
+	}
+	if err := m.checkCanJoin(lobby, player); err != nil {
+		return PendingJoin{}, err
+	}
+	m.cancelPendingJoins(lobby, player.ID)
+
+	timeout := m.JoinConfirmTimeout
+	if timeout <= 0 {
+		timeout = DefaultJoinConfirmTimeout
+	}
+	pending := &PendingJoin{
+		Token:     newPendingJoinToken(),
+		LobbyID:   lobbyID,
+		Player:    player,
+		ExpiresAt: time.Now().Add(timeout),
+	}
+	if lobby.pendingJoins == nil {
+		lobby.pendingJoins = make(map[string]*PendingJoin)
+	}
+	lobby.pendingJoins[pending.Token] = pending
+	m.pendingJoins[pending.Token] = pending
+	return *pending, nil
+}
+
+// ConfirmJoin completes a join started by RequestJoin. Only the player who requested the
+// join may confirm it, and expired requests are rejected.
+func (m *LobbyManager) ConfirmJoin(token string, playerID PlayerID) (*Lobby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, exists := m.pendingJoins[token]
+	if !exists {
+		return nil, NewLobbyError(ErrorCodeInvalidRequest, "Join request not found or expired")
+	}
+	if pending.Player.ID != playerID {
+		return nil, ErrUnauthorized("confirm_join")
+	}
+	lobby, exists := m.lobbies[pending.LobbyID]
+	if !exists {
+		delete(m.pendingJoins, token)
+		return nil, ErrLobbyNotFound(string(pending.LobbyID))
+	}
+	m.occupiedSeats(lobby) // Releases the reservation if it has expired
+	if _, live := lobby.pendingJoins[token]; !live {
+		return nil, NewLobbyError(ErrorCodeInvalidRequest, "Join request not found or expired")
+	}
+	if err := m.checkCanJoin(lobby, pending.Player); err != nil {
+		return nil, err
+	}
+	if err := m.joinLobbyLocked(lobby, pending.Player); err != nil {
+		return nil, err
+	}
+	return lobby, nil
+}
+
+// cancelPendingJoins drops any reservations the player holds in the lobby. Caller must hold the lobby's lock.
+func (m *LobbyManager) cancelPendingJoins(lobby *Lobby, playerID PlayerID) {
+	for token, pending := range lobby.pendingJoins {
+		if pending.Player.ID == playerID {
+			delete(lobby.pendingJoins, token)
+			m.forgetPendingJoin(token)
+		}
+	}
+}
+
+// forgetPendingJoin removes a reservation from the manager-wide index.
+func (m *LobbyManager) forgetPendingJoin(token string) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	delete(m.pendingJoins, token)
+}
+
+// newPendingJoinToken creates a random token identifying a join reservation.
+func newPendingJoinToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
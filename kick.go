@@ -0,0 +1,66 @@
+package lobby
+
+import "time"
+
+// KickPlayer removes a player from the lobby at the request of the owner or a moderator; only
+// the owner may kick a moderator, and nobody may kick the owner. The target is sent a
+// removed_from_lobby message with RemovalKicked before being removed, then OnPlayerLeave and
+// OnPlayerKicked fire and the lobby is told with ReasonPlayerKicked. With KickCooldown set,
+// the target cannot rejoin the lobby until it has passed.
+func (m *LobbyManager) KickPlayer(lobbyID LobbyID, requesterID string, targetID PlayerID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, requesterID) {
+		return ErrUnauthorized("kick_player")
+	}
+	target := findPlayer(lobby, targetID)
+	if target == nil {
+		return ErrPlayerNotInLobby(string(targetID), string(lobbyID))
+	}
+	if string(targetID) == requesterID {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Cannot kick yourself")
+	}
+	if string(targetID) == lobby.OwnerID || (lobby.Moderators[targetID] && lobby.OwnerID != requesterID) {
+		return ErrUnauthorized("kick_player")
+	}
+	if m.KickCooldown > 0 {
+		now := time.Now()
+		for id, at := range lobby.kickedAt {
+			if !now.Before(at.Add(m.KickCooldown)) {
+				delete(lobby.kickedAt, id)
+			}
+		}
+		if lobby.kickedAt == nil {
+			lobby.kickedAt = make(map[PlayerID]time.Time)
+		}
+		lobby.kickedAt[targetID] = now
+	}
+	m.notifyRemoved(lobby, targetID, RemovalKicked)
+	delete(lobby.retained, targetID)
+	if err := m.leaveLobbyLocked(lobby, targetID, ReasonPlayerKicked); err != nil {
+		return err
+	}
+	if m.Events != nil && m.Events.OnPlayerKicked != nil {
+		onKicked := m.Events.OnPlayerKicked
+		m.emitPlayer(lobby, target, func(lobby *Lobby, player *Player) {
+			onKicked(lobby, player, requesterID)
+		})
+	}
+	m.removeIfAbandonedLocked(lobby)
+	return nil
+}
+
+// kickCooldownUntil reports when a player kicked from the lobby may rejoin, if KickCooldown
+// has not yet passed. Caller must hold the lobby's lock.
+func (m *LobbyManager) kickCooldownUntil(lobby *Lobby, playerID PlayerID) (time.Time, bool) {
+	at, kicked := lobby.kickedAt[playerID]
+	if !kicked || m.KickCooldown <= 0 {
+		return time.Time{}, false
+	}
+	until := at.Add(m.KickCooldown)
+	return until, time.Now().Before(until)
+}
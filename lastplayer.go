@@ -0,0 +1,49 @@
+package lobby
+
+import "time"
+
+// lastPlayerHold keeps a lobby whose last player disconnected, see LobbyManager.LastPlayerGrace.
+type lastPlayerHold struct {
+	playerID PlayerID
+	until    time.Time
+	timer    *time.Timer
+}
+
+// holdForLastPlayerLocked keeps a lobby that a disconnect just emptied for LastPlayerGrace,
+// holding the player's seat for as long, and deletes it afterwards unless they came back.
+// Caller must hold the lobby's lock.
+func (m *LobbyManager) holdForLastPlayerLocked(lobby *Lobby, playerID PlayerID) {
+	if m.LastPlayerGrace <= 0 || len(lobby.Players) > 0 || lobby.PersistWhenEmpty {
+		return
+	}
+	if lobby.lastPlayerHold != nil {
+		lobby.lastPlayerHold.timer.Stop()
+	}
+	until := time.Now().Add(m.LastPlayerGrace)
+	if lobby.heldSeats == nil {
+		lobby.heldSeats = make(map[PlayerID]time.Time)
+	}
+	if until.After(lobby.heldSeats[playerID]) {
+		lobby.heldSeats[playerID] = until
+	}
+	hold := &lastPlayerHold{playerID: playerID, until: until}
+	hold.timer = time.AfterFunc(m.LastPlayerGrace, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.lobbies[lobby.ID] != lobby || lobby.lastPlayerHold != hold {
+			return // Reclaimed, held again by a later disconnect, or already deleted
+		}
+		lobby.lastPlayerHold = nil
+		m.removeIfAbandonedLocked(lobby)
+	})
+	lobby.lastPlayerHold = hold
+}
+
+// releaseLastPlayerHold ends the hold once the player it was kept for rejoins. Caller must hold
+// the lobby's lock.
+func releaseLastPlayerHold(lobby *Lobby, playerID PlayerID) {
+	if hold := lobby.lastPlayerHold; hold != nil && hold.playerID == playerID {
+		hold.timer.Stop()
+		lobby.lastPlayerHold = nil
+	}
+}
@@ -1,6 +1,9 @@
 package lobby
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 // LobbyID uniquely identifies a lobby.
 type LobbyID string
@@ -19,6 +22,8 @@ const (
 
 // Lobby represents a multiplayer lobby.
 type Lobby struct {
+	mu sync.Mutex // Guards player-level mutations, see LobbyManager
+
 	ID         LobbyID
 	Name       string
 	MaxPlayers int
@@ -28,4 +33,76 @@ type Lobby struct {
 	State      LobbyState
 	Metadata   map[string]interface{}
 	OwnerID    string
+	Moderators map[PlayerID]bool // Players who can moderate without owning the lobby
+	AutoStart  bool              // Start as soon as a ready change makes the start validator pass
+
+	PersistWhenEmpty bool      // Keep the lobby when its last player leaves instead of deleting it
+	StartedAt        time.Time // When the current game started; zero until then
+	LastActivity     time.Time // Last join, leave, ready or state change; see ReapIdleLobbies
+	ReadyLocked      bool      // Ready status is frozen, see LockReadyState
+	TeamCount        int       // Number of teams players are split into on join (0: no teams)
+	MaxPerTeam       int       // Players allowed on each team (0: no per-team limit)
+	MinPlayers       int       // Players needed to start, overriding the GameStartConfig (0: use config)
+	AutoReadyOnJoin  bool      // Mark joining players ready immediately, for instant matches with AutoStart
+	Spectators       []*Player // Observers who receive lobby updates without taking a seat
+	MaxSpectators    int       // Spectator places; 0 means the lobby cannot be spectated
+	SpectatorRatio   float64   // Spectators allowed per seated player on top of MaxSpectators (0: no ratio cap)
+	Region           string    // Where the lobby's game is hosted, for FindNearestLobbies
+
+	// AllowedActions switches router actions on or off for requests against this lobby, see
+	// LobbyActionsMiddleware. Actions mapped to false are forbidden; unlisted ones are allowed.
+	AllowedActions map[string]bool
+
+	heldSeats    map[PlayerID]time.Time       // Seats held for disconnected players, keyed to their expiry
+	pendingJoins map[string]*PendingJoin      // Seats reserved by RequestJoin, keyed by token
+	retained     map[PlayerID]*retainedPlayer // State kept for disconnected players, keyed by session
+	countdown    *readyCountdown              // Running ready countdown, see StartReadyCountdown
+	mutedInChat  map[PlayerID]time.Time       // Chat mutes keyed to their expiry, see MutePlayer
+	kickedAt     map[PlayerID]time.Time       // When players were kicked, for KickCooldown
+	bans         map[PlayerID]BanEntry        // Banned players, see BanPlayer
+	chatHistory  []ChatMessageResponse        // Recent chat, oldest first, up to MaxChatHistory
+	chatSent     map[PlayerID][]time.Time     // Recent chat send times per player, for ChatRateLimit
+
+	lastPlayerHold *lastPlayerHold // Keeps the lobby after its last player disconnected, see LastPlayerGrace
+
+	lastConnectionBroadcast time.Time // When connection info was last broadcast, for throttling
+	lastBroadcastHash       [32]byte  // SHA-256 of the last lobby_state sent, for DedupeBroadcasts
+}
+
+// retainedPlayer is the lobby-scoped state kept for a disconnected player until ExpiresAt.
+type retainedPlayer struct {
+	Ready     bool
+	Metadata  map[string]interface{}
+	Moderator bool
+	ExpiresAt time.Time
+}
+
+// LobbyOptions holds optional per-lobby settings for CreateLobbyWithOptions.
+type LobbyOptions struct {
+	// AutoStart starts the game from SetPlayerReadyAndMaybeStart once the start validator passes.
+	AutoStart bool
+	// AutoReadyOnJoin marks joining players ready. With AutoStart, a join that satisfies the
+	// manager's GameStartConfig starts the game.
+	AutoReadyOnJoin bool
+	// MaxSpectators is how many players may watch through JoinAsSpectator.
+	MaxSpectators int
+	// SpectatorRatio additionally caps spectators relative to seated players, e.g. 2 allows
+	// two spectators per player. It is checked as spectators join; when players leave,
+	// spectators over the ratio stay but no new ones are let in.
+	SpectatorRatio float64
+	// PersistWhenEmpty keeps the lobby around after its last player leaves, e.g. for clan rooms.
+	// create_lobby sets it from persist_when_empty, or from delete_on_empty set to false.
+	PersistWhenEmpty bool
+	// TeamCount splits joining players across this many teams, see assignSeat.
+	TeamCount int
+	// MaxPerTeam caps each team. Joins are limited by both MaxPlayers and TeamCount*MaxPerTeam;
+	// MaxPlayers is checked first, so a join rejected by both reports ErrorCodeLobbyFull.
+	MaxPerTeam int
+	// MinPlayers overrides GameStartConfig.MinPlayers for this lobby when positive.
+	MinPlayers int
+	// AllowedActions forbids the actions mapped to false in this lobby, e.g. no chat_message in
+	// ranked lobbies. See Lobby.AllowedActions.
+	AllowedActions map[string]bool
+	// Region is where the lobby's game is hosted, e.g. "eu-west", see FindNearestLobbies.
+	Region string
 }
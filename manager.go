@@ -1,8 +1,15 @@
 package lobby
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"sync"
 	"time"
 )
@@ -32,16 +39,16 @@ func ConfigurableGameStartValidator(config *GameStartConfig) func(*Lobby, string
 			return errors.New("lobby is not in waiting state")
 		}
 
-		if len(l.Players) < config.MinPlayers {
-			return fmt.Errorf("need at least %d players to start the game", config.MinPlayers)
+		minPlayers := config.MinPlayers
+		if l.MinPlayers > 0 {
+			minPlayers = l.MinPlayers
+		}
+		if len(l.Players) < minPlayers {
+			return fmt.Errorf("need at least %d players to start the game", minPlayers)
 		}
 
-		if config.RequireAllReady {
-			for _, p := range l.Players {
-				if !p.Ready {
-					return errors.New("all players must be ready to start the game")
-				}
-			}
+		if config.RequireAllReady && !allPlayersReady(l.Players) {
+			return errors.New("all players must be ready to start the game")
 		}
 
 		if config.RequireOwnerOnly && l.OwnerID != username {
@@ -92,111 +99,704 @@ func NewCasualConfig() *GameStartConfig {
 	}
 }
 
+// OwnerlessPolicy decides who may act as owner of an ownerless lobby: one created without an
+// owner, or whose owner is no longer a member.
+type OwnerlessPolicy int
+
+const (
+	OwnerlessNobody      OwnerlessPolicy = iota // Owner-only actions fail (default)
+	OwnerlessSystemOwner                        // Only LobbyManager.SystemOwnerID acts as owner
+	OwnerlessAnyMember                          // Any member of the lobby acts as owner
+)
+
 // LobbyManager manages lobbies and players in a thread-safe way.
+//
+// Locking: JoinLobby, LeaveLobby, DisconnectPlayer, SetPlayerReady, SetPlayerTeam, StartGame,
+// SendChatMessage and ChatHistory read-lock mu and then lock the target Lobby's mu (see
+// lockLobby), so they run in parallel across lobbies. Every other operation takes mu
+// exclusively, which excludes those and so needs no lobby lock. Either way the lobby's lock is
+// held, which is what helpers documented with "Caller must hold the lobby's lock" need; those
+// that add or remove lobbies need mu exclusively. Locks are always acquired in the order mu,
+// Lobby.mu, indexMu; indexMu guards the cross-lobby memberships and pendingJoins indexes while
+// only mu's read lock is held. Event callbacks run
+// under these locks, so they may be called concurrently for different lobbies and must not
+// call back into the manager, unless AsyncEvents moves them onto a worker.
 type LobbyManager struct {
-	mu      sync.Mutex
-	lobbies map[LobbyID]*Lobby
-	Events  *LobbyEvents // Optional event hooks
+	mu           sync.RWMutex
+	indexMu      sync.Mutex
+	lobbies      map[LobbyID]*Lobby
+	memberships  map[PlayerID]map[LobbyID]bool // Lobbies each player currently belongs to
+	pendingJoins map[string]*PendingJoin       // Unconfirmed join requests by token
+	lobbyNames   map[string]LobbyID            // Lobby ID by name, for RequireUniqueNames
+	listWatchers map[string]bool               // Users told about removed lobbies, see WatchLobbyList
+	Events       *LobbyEvents                  // Optional event hooks
+
+	// DisconnectGrace is how long a disconnected player's seat is held for them (default: 0, no hold).
+	DisconnectGrace time.Duration
+
+	// LastPlayerGrace keeps a lobby whose last player disconnected, rather than left, for this
+	// long so they can reclaim it, with their seat and ownership, by rejoining. The lobby is
+	// deleted once the grace ends if it is still empty (default: 0, deleted at once).
+	LastPlayerGrace time.Duration
+
+	// LobbyNameValidator, when set, vets lobby names on creation (e.g. profanity filters).
+	// A returned error rejects the lobby with ErrorCodeInvalidRequest.
+	LobbyNameValidator func(name string) error
+
+	// OwnerSelector picks the new owner when the owner leaves or disconnects. It receives the
+	// lobby with the leaving player already removed. Returning nil, or a player who is not in
+	// the lobby, falls back to the default of the longest-tenured remaining player.
+	OwnerSelector func(lobby *Lobby, leaving *Player) *Player
+
+	// JoinConfirmTimeout is how long a RequestJoin reservation waits for ConfirmJoin (default: 30s).
+	JoinConfirmTimeout time.Duration
+
+	// MaxLobbiesPerPlayer caps how many lobbies one player can be a member of at once.
+	// Zero or a negative value means the default of 1.
+	MaxLobbiesPerPlayer int
+
+	// RequireUniqueNames rejects CreateLobby with ErrorCodeLobbyAlreadyExists when another
+	// lobby already uses the same name. Lobby IDs are random, so names may repeat without it.
+	RequireUniqueNames bool
+
+	// Rand is the randomness source for lobby IDs and ShuffleTeams (default: crypto/rand.Reader).
+	// Tests can pass a seeded math/rand.Rand for repeatable results.
+	Rand io.Reader
+
+	// RetainStateFor is how long a player's lobby-scoped state (ready flag, metadata, moderator
+	// role) is kept after a LeaveDisconnect so rejoining restores it (default: 0, not retained).
+	RetainStateFor time.Duration
+
+	// MaxMetadataDepth and MaxMetadataElements bound how deeply lobby metadata may nest and
+	// how many values it may hold in total (default: 0, unlimited). Violations are rejected
+	// with ErrorCodeInvalidRequest on create and update.
+	MaxMetadataDepth    int
+	MaxMetadataElements int
+
+	// Validation caps lobby name length, metadata size and tag count on create and update.
+	Validation LobbyValidationConfig
+
+	// ReadReplica, when set, serves GetLobbyByID and ListLobbies while every write still goes
+	// to the manager's own state. Replica reads may be stale; see ReadOnlyLobbyRepository.
+	ReadReplica ReadOnlyLobbyRepository
+
+	// AllowMidGameJoin lets players join lobbies that are already in-game. When false (the
+	// default) such joins fail with ErrorCodeLobbyNotWaiting.
+	AllowMidGameJoin bool
+
+	// ExternalStartCheck, when set, runs inside StartGame after the built-in checks so outside
+	// systems (matchmaking, anti-cheat) can veto the start. Its error reaches the client with
+	// ErrorCodeStartBlocked. It runs under the manager lock, so it should respect ctx deadlines.
+	ExternalStartCheck func(ctx context.Context, lobby *Lobby) error
+
+	// GameStartConfig is the start configuration in effect, used to report MinPlayers to
+	// clients. SetupDefaultHandlersWithCustom fills it from HandlerOptions when unset;
+	// nil means DefaultGameStartConfig.
+	GameStartConfig *GameStartConfig
+
+	// FillThresholds are the fill fractions (e.g. 0.5, 0.8) at which OnLobbyThreshold fires.
+	FillThresholds []float64
+
+	// OwnerlessPolicy and SystemOwnerID decide who may start an ownerless lobby. Under
+	// OwnerlessSystemOwner, SystemOwnerID is the identity (e.g. an admin account) treated as
+	// the owner; it need not be a member.
+	OwnerlessPolicy OwnerlessPolicy
+	SystemOwnerID   string
+
+	// ConnectionInfoInterval is the minimum time between lobby broadcasts caused by
+	// SetPlayerConnectionInfo (default: 2s).
+	ConnectionInfoInterval time.Duration
+
+	// SpectateWhenFull makes join_lobby fall back to spectating when the lobby is full,
+	// see JoinOrSpectate.
+	SpectateWhenFull bool
+
+	// DedupeBroadcasts skips a lobby_state broadcast whose encoded payload, reason included,
+	// is identical to the lobby's previous one, e.g. after a no-op update.
+	DedupeBroadcasts bool
+
+	// MinListingAge and MinListingPlayers hide lobbies from ListLobbies until they are at least
+	// this old and hold at least this many players, so half-created lobbies don't flicker in
+	// the lobby browser. Lookups by ID are unaffected.
+	MinListingAge     time.Duration
+	MinListingPlayers int
+
+	// MaxChatLength caps chat_message text, in characters (default: DefaultMaxChatLength).
+	MaxChatLength int
+
+	// ChatRateLimit caps how many chat messages a player may send per ChatRateWindow (default:
+	// 0, no limit). Messages over the limit are refused with ErrorCodeRateLimited.
+	ChatRateLimit  int
+	ChatRateWindow time.Duration // default: DefaultChatRateWindow
+
+	// MaxChatHistory is how many chat messages each lobby keeps for ChatHistory, dropping the
+	// oldest first (default: DefaultMaxChatHistory; negative keeps none).
+	MaxChatHistory int
+
+	// MaxConcurrentGames caps how many lobbies may be in-game at once, to bound the load on
+	// game servers (default: 0, unlimited). Starts beyond it fail with
+	// ErrorCodeServiceUnavailable until a running game ends.
+	MaxConcurrentGames int
+
+	// ReadyCountdownTick is how often a running StartReadyCountdown broadcasts
+	// ready_countdown (default: DefaultReadyCountdownTick).
+	ReadyCountdownTick time.Duration
+
+	// KickCooldown keeps a kicked player from rejoining the lobby they were kicked from until
+	// it has passed (default: 0, they may rejoin at once).
+	KickCooldown time.Duration
+
+	// RematchSpectators makes RematchLobby move spectators to the new lobby along with the
+	// players (default: false, spectators are left behind and told the lobby was removed).
+	RematchSpectators bool
+
+	// RegionDistance orders FindNearestLobbies: lower is nearer, and a negative distance
+	// leaves the lobby out. By default a lobby's own region is nearest, then regions one
+	// RegionAdjacency step away, then two, and so on; unconnected regions are left out.
+	RegionDistance  func(from, to string) int
+	RegionAdjacency map[string][]string // Neighbouring regions, e.g. "eu-west": {"eu-central"}; links work both ways
+
+	// Hasher hashes passwords before they are stored (default: PBKDF2Hasher with
+	// DefaultPBKDF2Iterations).
+	Hasher Hasher
+
+	// AsyncEvents runs event callbacks and broadcasts on a worker goroutine instead of under the
+	// manager's locks, so a slow Broadcaster cannot stall other lobby operations. Callbacks get a
+	// snapshot of the lobby rather than the live one, and messages reach clients after the call
+	// that raised them returns. OnLobbyCreate, which can veto, and the state builders still run
+	// inline. Callbacks may call back into the manager, but one that fills the queue will block
+	// the worker on itself. Call Shutdown to flush the queue when the manager is done.
+	AsyncEvents    bool
+	EventQueueSize int // Events that can wait for the worker (default: DefaultEventQueueSize)
+
+	eventsMu        sync.RWMutex
+	eventQueue      chan func()   // Pending AsyncEvents work, see enqueueEvent
+	eventsDone      chan struct{} // Closed when the event worker exits
+	eventsStopped   bool          // Set by Shutdown
+	gamesInProgress int64         // In-game lobbies, kept up to date by transitionState; see GamesInProgress
 }
 
 // NewLobbyManager creates a LobbyManager with no event hooks.
 func NewLobbyManager() *LobbyManager {
 	return &LobbyManager{
-		lobbies: make(map[LobbyID]*Lobby),
+		lobbies:      make(map[LobbyID]*Lobby),
+		memberships:  make(map[PlayerID]map[LobbyID]bool),
+		pendingJoins: make(map[string]*PendingJoin),
+		lobbyNames:   make(map[string]LobbyID),
+		listWatchers: make(map[string]bool),
 	}
 }
 
 // NewLobbyManagerWithEvents creates a LobbyManager with event hooks.
 func NewLobbyManagerWithEvents(events *LobbyEvents) *LobbyManager {
 	return &LobbyManager{
-		lobbies: make(map[LobbyID]*Lobby),
-		Events:  events,
+		lobbies:      make(map[LobbyID]*Lobby),
+		memberships:  make(map[PlayerID]map[LobbyID]bool),
+		pendingJoins: make(map[string]*PendingJoin),
+		lobbyNames:   make(map[string]LobbyID),
+		listWatchers: make(map[string]bool),
+		Events:       events,
+	}
+}
+
+// GenerateLobbyID creates a random, opaque lobby ID. It fails only if the randomness source does.
+func (m *LobbyManager) GenerateLobbyID() (LobbyID, error) {
+	bytes := make([]byte, 8)
+	if _, err := io.ReadFull(m.randSource(), bytes); err != nil {
+		return "", err
+	}
+	return LobbyID(hex.EncodeToString(bytes)), nil
+}
+
+// randSource returns the configured randomness source, defaulting to crypto/rand.
+func (m *LobbyManager) randSource() io.Reader {
+	if m.Rand == nil {
+		return rand.Reader
+	}
+	return m.Rand
+}
+
+// minPlayers returns the number of players a lobby needs to start: its own MinPlayers if set,
+// otherwise the manager's GameStartConfig.
+func (m *LobbyManager) minPlayers(lobby *Lobby) int {
+	if lobby.MinPlayers > 0 {
+		return lobby.MinPlayers
+	}
+	if m.GameStartConfig != nil {
+		return m.GameStartConfig.MinPlayers
+	}
+	return DefaultGameStartConfig.MinPlayers
+}
+
+// maxLobbiesPerPlayer returns the effective per-player membership cap.
+func (m *LobbyManager) maxLobbiesPerPlayer() int {
+	if m.MaxLobbiesPerPlayer <= 0 {
+		return 1
+	}
+	return m.MaxLobbiesPerPlayer
+}
+
+// lockLobby read-locks m.mu, looks up a lobby and locks it for an operation that touches only
+// that lobby. When the lobby exists the caller must call unlock when done.
+func (m *LobbyManager) lockLobby(lobbyID LobbyID) (lobby *Lobby, unlock func(), exists bool) {
+	m.mu.RLock()
+	lobby, exists = m.lobbies[lobbyID]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, nil, false
+	}
+	lobby.mu.Lock()
+	return lobby, func() {
+		lobby.mu.Unlock()
+		m.mu.RUnlock()
+	}, true
+}
+
+// addMembership records that a player belongs to a lobby. Caller must hold the lobby's lock.
+func (m *LobbyManager) addMembership(playerID PlayerID, lobbyID LobbyID) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	lobbies, ok := m.memberships[playerID]
+	if !ok {
+		lobbies = make(map[LobbyID]bool)
+		m.memberships[playerID] = lobbies
+	}
+	lobbies[lobbyID] = true
+}
+
+// tryAddMembership records a membership unless the player is already at the per-player cap,
+// checking and adding atomically so concurrent joins to different lobbies cannot overshoot it.
+func (m *LobbyManager) tryAddMembership(playerID PlayerID, lobbyID LobbyID) bool {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	lobbies := m.memberships[playerID]
+	if !lobbies[lobbyID] && len(lobbies) >= m.maxLobbiesPerPlayer() {
+		return false
+	}
+	if lobbies == nil {
+		lobbies = make(map[LobbyID]bool)
+		m.memberships[playerID] = lobbies
+	}
+	lobbies[lobbyID] = true
+	return true
+}
+
+// membershipCount returns how many lobbies a player belongs to.
+func (m *LobbyManager) membershipCount(playerID PlayerID) int {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	return len(m.memberships[playerID])
+}
+
+// removeMembership forgets that a player belongs to a lobby. Caller must hold the lobby's lock.
+func (m *LobbyManager) removeMembership(playerID PlayerID, lobbyID LobbyID) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	lobbies, ok := m.memberships[playerID]
+	if !ok {
+		return
+	}
+	delete(lobbies, lobbyID)
+	if len(lobbies) == 0 {
+		delete(m.memberships, playerID)
 	}
 }
 
 // CreateLobby creates a new lobby with the given parameters.
-// Returns an error if a lobby with the same ID already exists.
+// The lobby gets a random ID from GenerateLobbyID; its name is kept separately in Lobby.Name.
+// Returns an error if the ID collides with an existing lobby or LobbyNameValidator rejects the name.
+// With RequireUniqueNames the name check and the insert happen under the same lock, so of
+// several concurrent creates with one name exactly one succeeds.
 func (m *LobbyManager) CreateLobby(name string, maxPlayers int, public bool, metadata map[string]interface{}, ownerID string) (*Lobby, error) {
+	return m.CreateLobbyWithOptions(name, maxPlayers, public, metadata, ownerID, LobbyOptions{})
+}
+
+// CreateLobbyWithOptions creates a new lobby like CreateLobby, applying the given per-lobby options.
+func (m *LobbyManager) CreateLobbyWithOptions(name string, maxPlayers int, public bool, metadata map[string]interface{}, ownerID string, opts LobbyOptions) (*Lobby, error) {
+	if err := m.validateLobbyInput(name, metadata); err != nil {
+		return nil, err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	id := LobbyID(name) // For now, use name as ID; can be replaced with UUID
+	return m.createLobbyLocked(name, maxPlayers, public, metadata, ownerID, opts)
+}
+
+// createLobbyLocked creates and stores a lobby from input that already passed
+// validateLobbyInput. Caller must hold m.mu exclusively.
+func (m *LobbyManager) createLobbyLocked(name string, maxPlayers int, public bool, metadata map[string]interface{}, ownerID string, opts LobbyOptions) (*Lobby, error) {
+	id, err := m.GenerateLobbyID()
+	if err != nil {
+		return nil, ErrRandomness(err)
+	}
 	if _, exists := m.lobbies[id]; exists {
-		return nil, errors.New("lobby already exists")
+		return nil, ErrLobbyAlreadyExists(string(id))
 	}
+	if _, taken := m.lobbyNames[name]; taken && m.RequireUniqueNames {
+		return nil, ErrLobbyAlreadyExists(name)
+	}
+	now := time.Now()
 	lobby := &Lobby{
 		ID:         id,
 		Name:       name,
 		MaxPlayers: maxPlayers,
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
 		Public:     public,
 		Players:    []*Player{},
 		State:      LobbyWaiting,
 		Metadata:   metadata,
 		OwnerID:    ownerID,
+		AutoStart:  opts.AutoStart,
+
+		PersistWhenEmpty: opts.PersistWhenEmpty,
+		LastActivity:     now,
+		TeamCount:        opts.TeamCount,
+		MaxPerTeam:       opts.MaxPerTeam,
+		MinPlayers:       opts.MinPlayers,
+		AutoReadyOnJoin:  opts.AutoReadyOnJoin,
+		MaxSpectators:    opts.MaxSpectators,
+		SpectatorRatio:   opts.SpectatorRatio,
+		Region:           opts.Region,
+		AllowedActions:   opts.AllowedActions,
+	}
+	if m.Events != nil && m.Events.OnLobbyCreate != nil {
+		if err := m.Events.OnLobbyCreate(lobby); err != nil {
+			return nil, err
+		}
 	}
 	m.lobbies[id] = lobby
+	m.lobbyNames[name] = id
 	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
-		m.Events.OnLobbyStateChange(lobby)
+		m.emit(lobby, m.Events.OnLobbyStateChange)
 	}
-	m.broadcastLobbyState(lobby)
+	m.broadcastLobbyState(lobby, ReasonLobbyCreated)
 	return lobby, nil
 }
 
 // JoinLobby adds a player to the lobby if there is space and triggers events.
+// Seats held for disconnected players count toward capacity, except for the player who holds them.
 // Returns an error if the lobby does not exist, is full, or the player is already in the lobby.
+// Joining fails with ErrorCodePlayerAlreadyInLobby if the player is already a member of
+// MaxLobbiesPerPlayer lobbies.
 func (m *LobbyManager) JoinLobby(lobbyID LobbyID, player *Player) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	lobby, exists := m.lobbies[lobbyID]
+	lobby, unlock, exists := m.lockLobby(lobbyID)
 	if !exists {
 		return errors.New("lobby does not exist")
 	}
-	if len(lobby.Players) >= lobby.MaxPlayers {
-		return errors.New("lobby is full")
+	defer unlock()
+	if err := m.checkCanJoin(lobby, player); err != nil {
+		return err
+	}
+	return m.joinLobbyLocked(lobby, player)
+}
+
+// checkCanJoin verifies a player may take a seat in the lobby. Seats held or reserved for
+// the player themselves do not count against them. Caller must hold the lobby's lock.
+func (m *LobbyManager) checkCanJoin(lobby *Lobby, player *Player) error {
+	if lobby.State == LobbyInGame && !m.AllowMidGameJoin {
+		return ErrLobbyNotWaiting(string(lobby.ID))
+	}
+	if _, banned := lobby.bans[player.ID]; banned {
+		return ErrPlayerBanned(string(lobby.ID))
+	}
+	if until, cooling := m.kickCooldownUntil(lobby, player.ID); cooling {
+		return ErrKickCooldown(string(lobby.ID), until)
+	}
+	occupied := m.occupiedSeats(lobby)
+	if _, held := lobby.heldSeats[player.ID]; held {
+		occupied-- // A returning player reclaims their own held seat
+	}
+	for _, pending := range lobby.pendingJoins {
+		if pending.Player.ID == player.ID {
+			occupied-- // As does a player confirming their own join request
+		}
+	}
+	if occupied >= lobby.MaxPlayers {
+		return ErrLobbyFull(string(lobby.ID))
+	}
+	if capacity, ok := teamCapacity(lobby); ok && occupied >= capacity {
+		return ErrTeamsFull(string(lobby.ID))
 	}
 	for _, p := range lobby.Players {
 		if p.ID == player.ID {
 			return errors.New("player already in lobby")
 		}
 	}
+	if findSpectator(lobby, player.ID) != nil {
+		return ErrPlayerAlreadyInLobby(string(player.ID)) // Spectators leave before taking a seat
+	}
+	if m.membershipCount(player.ID) >= m.maxLobbiesPerPlayer() {
+		return ErrPlayerAlreadyInLobby(string(player.ID))
+	}
+	return nil
+}
+
+// joinLobbyLocked seats a player who passed checkCanJoin, firing events and broadcasting. It
+// records the membership first, failing with ErrorCodePlayerAlreadyInLobby before touching the
+// lobby if a concurrent join elsewhere took the player to MaxLobbiesPerPlayer. Caller must hold
+// the lobby's lock.
+func (m *LobbyManager) joinLobbyLocked(lobby *Lobby, player *Player) error {
+	if !m.tryAddMembership(player.ID, lobby.ID) {
+		return ErrPlayerAlreadyInLobby(string(player.ID))
+	}
+	delete(lobby.heldSeats, player.ID)
+	releaseLastPlayerHold(lobby, player.ID)
+	m.cancelPendingJoins(lobby, player.ID)
+	m.restoreRetainedState(lobby, player)
+	if lobby.AutoReadyOnJoin && !player.Ready {
+		player.Ready = true
+		m.count(countReadies)
+	}
+	assignSeat(lobby, player)
 	lobby.Players = append(lobby.Players, player)
+	lobby.LastActivity = time.Now()
+	m.count(countJoins)
 	if m.Events != nil {
 		if m.Events.OnPlayerJoin != nil {
-			m.Events.OnPlayerJoin(lobby, player)
+			m.emitPlayer(lobby, player, m.Events.OnPlayerJoin)
 		}
 		if len(lobby.Players) == lobby.MaxPlayers && m.Events.OnLobbyFull != nil {
-			m.Events.OnLobbyFull(lobby)
+			m.emit(lobby, m.Events.OnLobbyFull)
 		}
+		m.fireFillThresholds(lobby)
 		if m.Events.OnLobbyStateChange != nil {
-			m.Events.OnLobbyStateChange(lobby)
+			m.emit(lobby, m.Events.OnLobbyStateChange)
 		}
 	}
-	m.broadcastLobbyState(lobby)
+	m.broadcastLobbyState(lobby, ReasonPlayerJoined)
+	if lobby.AutoReadyOnJoin {
+		m.maybeAutoStartLocked(lobby, player.Username, ConfigurableGameStartValidator(m.GameStartConfig))
+	}
 	return nil
 }
 
-// DeleteLobby removes a lobby from the manager.
-// Returns an error if the lobby does not exist.
+// fireFillThresholds fires OnLobbyThreshold for each threshold crossed by the player who just joined.
+func (m *LobbyManager) fireFillThresholds(lobby *Lobby) {
+	if m.Events.OnLobbyThreshold == nil || lobby.MaxPlayers <= 0 {
+		return
+	}
+	before := float64(len(lobby.Players)-1) / float64(lobby.MaxPlayers)
+	after := float64(len(lobby.Players)) / float64(lobby.MaxPlayers)
+	onThreshold := m.Events.OnLobbyThreshold
+	for _, threshold := range m.FillThresholds {
+		if before < threshold && after >= threshold {
+			m.emit(lobby, func(lobby *Lobby) { onThreshold(lobby, threshold) })
+		}
+	}
+}
+
+// DeleteLobby removes a lobby from the manager, telling remaining players with a
+// removed_from_lobby message and firing OnLobbyDeleted. Returns an error if the lobby does not exist.
 func (m *LobbyManager) DeleteLobby(lobbyID LobbyID) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.lobbies[lobbyID]; !exists {
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
 		return errors.New("lobby does not exist")
 	}
-	delete(m.lobbies, lobbyID)
+	for _, p := range lobby.Players {
+		m.notifyRemoved(lobby, p.ID, RemovalShutdown)
+	}
+	m.removeLobbyLocked(lobby)
 	return nil
 }
 
+// removeLobbyLocked deletes a lobby for good: it fires OnLobbyDeleted and sends lobby_removed
+// to any remaining members and to list watchers. Every deletion path goes through here.
+// Caller must hold m.mu exclusively.
+func (m *LobbyManager) removeLobbyLocked(lobby *Lobby) {
+	m.count(countDeletions)
+	if m.Events != nil && m.Events.OnLobbyDeleted != nil {
+		m.emit(lobby, m.Events.OnLobbyDeleted)
+	}
+	if m.canBroadcast() {
+		msg := LobbyRemovedResponse{Action: "lobby_removed", LobbyID: string(lobby.ID)}
+		for _, p := range lobby.Players {
+			if !m.listWatchers[string(p.ID)] {
+				m.deliver(string(p.ID), msg)
+			}
+		}
+		for _, s := range lobby.Spectators {
+			if !m.listWatchers[string(s.ID)] {
+				m.deliver(string(s.ID), msg)
+			}
+		}
+		for userID := range m.listWatchers {
+			m.deliver(userID, msg)
+		}
+	}
+	m.dropLobbyLocked(lobby)
+}
+
+// WatchLobbyList subscribes a user, typically one browsing the lobby list, to lobby_removed
+// messages for every lobby that is deleted.
+func (m *LobbyManager) WatchLobbyList(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listWatchers == nil {
+		m.listWatchers = make(map[string]bool)
+	}
+	m.listWatchers[userID] = true
+}
+
+// UnwatchLobbyList stops sending lobby_removed messages to a user.
+func (m *LobbyManager) UnwatchLobbyList(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.listWatchers, userID)
+}
+
+// notifyRemoved tells a player why they are being removed from a lobby. Call it before the
+// player is removed so the message is their last one from that lobby.
+func (m *LobbyManager) notifyRemoved(lobby *Lobby, playerID PlayerID, reason string) {
+	if !m.canBroadcast() {
+		return
+	}
+	m.deliver(string(playerID), RemovedFromLobbyResponse{
+		Action:  "removed_from_lobby",
+		LobbyID: string(lobby.ID),
+		Reason:  reason,
+	})
+}
+
+// dropLobbyLocked removes a lobby and everything indexed against it. Caller must hold m.mu
+// exclusively.
+func (m *LobbyManager) dropLobbyLocked(lobby *Lobby) {
+	if lobby.State == LobbyInGame {
+		m.releaseGameSlot()
+	}
+	if lobby.countdown != nil {
+		lobby.countdown.cancel()
+		lobby.countdown = nil
+	}
+	if lobby.lastPlayerHold != nil {
+		lobby.lastPlayerHold.timer.Stop()
+		lobby.lastPlayerHold = nil
+	}
+	for _, p := range lobby.Players {
+		m.removeMembership(p.ID, lobby.ID)
+	}
+	for token := range lobby.pendingJoins {
+		delete(m.pendingJoins, token)
+	}
+	if m.lobbyNames[lobby.Name] == lobby.ID {
+		delete(m.lobbyNames, lobby.Name)
+	}
+	delete(m.lobbies, lobby.ID)
+}
+
+// LeaveReason tells LeaveLobbyWithReason why a player is leaving.
+type LeaveReason int
+
+const (
+	// LeaveVoluntary discards the player's lobby-scoped state immediately.
+	LeaveVoluntary LeaveReason = iota
+	// LeaveDisconnect holds the player's seat for DisconnectGrace and retains their
+	// lobby-scoped state for RetainStateFor so a rejoin restores it.
+	LeaveDisconnect
+)
+
 // LeaveLobby removes a player from the lobby and triggers events.
 // Returns an error if the lobby or player does not exist.
-// If the lobby becomes empty after the player leaves, it will be automatically deleted.
+// If the lobby becomes empty after the player leaves, it will be automatically deleted
+// unless it was created with PersistWhenEmpty.
 func (m *LobbyManager) LeaveLobby(lobbyID LobbyID, playerID PlayerID) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	lobby, exists := m.lobbies[lobbyID]
+	return m.LeaveLobbyWithReason(lobbyID, playerID, LeaveVoluntary)
+}
+
+// DisconnectPlayer removes a player whose connection dropped. If DisconnectGrace is set,
+// their seat stays held for that long so the lobby cannot fill up before they reconnect;
+// the hold is released automatically once the grace expires.
+// Without a grace period this behaves like LeaveLobby.
+func (m *LobbyManager) DisconnectPlayer(lobbyID LobbyID, playerID PlayerID) error {
+	return m.LeaveLobbyWithReason(lobbyID, playerID, LeaveDisconnect)
+}
+
+// LeaveLobbyWithReason removes a player from the lobby. A voluntary leave discards any state
+// kept for the player; a disconnect holds their seat and retains their state as configured.
+func (m *LobbyManager) LeaveLobbyWithReason(lobbyID LobbyID, playerID PlayerID, reason LeaveReason) error {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
 	if !exists {
 		return errors.New("lobby does not exist")
 	}
+	var err error
+	switch {
+	case removeSpectator(lobby, playerID):
+		m.broadcastLobbyState(lobby, ReasonSpectatorLeft)
+	case reason == LeaveVoluntary:
+		delete(lobby.retained, playerID)
+		err = m.leaveLobbyLocked(lobby, playerID, ReasonPlayerLeft)
+	default:
+		err = m.disconnectLocked(lobby, playerID, ReasonPlayerDisconnected)
+		if err == nil {
+			m.holdForLastPlayerLocked(lobby, playerID)
+		}
+	}
+	abandoned := isAbandoned(lobby)
+	unlock()
+
+	// Deleting needs mu exclusively, so recheck once no lobby lock is held
+	if err == nil && abandoned {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.lobbies[lobbyID] == lobby {
+			m.removeIfAbandonedLocked(lobby)
+		}
+	}
+	return err
+}
+
+// disconnectLocked removes a player who is expected back, holding their seat and retaining
+// their state as configured. Caller must hold the lobby's lock.
+func (m *LobbyManager) disconnectLocked(lobby *Lobby, playerID PlayerID, reason string) error {
+	if player := findPlayer(lobby, playerID); player != nil {
+		now := time.Now()
+		if m.DisconnectGrace > 0 {
+			if lobby.heldSeats == nil {
+				lobby.heldSeats = make(map[PlayerID]time.Time)
+			}
+			lobby.heldSeats[playerID] = now.Add(m.DisconnectGrace)
+		}
+		if m.RetainStateFor > 0 {
+			if lobby.retained == nil {
+				lobby.retained = make(map[PlayerID]*retainedPlayer)
+			}
+			lobby.retained[playerID] = &retainedPlayer{
+				Ready:     player.Ready,
+				Metadata:  player.Metadata,
+				Moderator: lobby.Moderators[playerID],
+				ExpiresAt: now.Add(m.RetainStateFor),
+			}
+		}
+	}
+	return m.leaveLobbyLocked(lobby, playerID, reason)
+}
+
+// restoreRetainedState reapplies state retained from a disconnect to a rejoining player and
+// forgets it. Expired state is discarded. Caller must hold the lobby's lock.
+func (m *LobbyManager) restoreRetainedState(lobby *Lobby, player *Player) {
+	state, ok := lobby.retained[player.ID]
+	if !ok {
+		return
+	}
+	delete(lobby.retained, player.ID)
+	if time.Now().After(state.ExpiresAt) {
+		return
+	}
+	player.Ready = state.Ready
+	player.Metadata = state.Metadata
+	if state.Moderator && string(player.ID) != lobby.OwnerID {
+		if lobby.Moderators == nil {
+			lobby.Moderators = make(map[PlayerID]bool)
+		}
+		lobby.Moderators[player.ID] = true
+	}
+}
+
+// leaveLobbyLocked removes a player from the lobby and fires events. If the owner leaves,
+// ownership passes to the player chosen by OwnerSelector. It never deletes the lobby, since
+// that needs m.mu exclusively; callers follow up with removeIfAbandonedLocked. Caller must
+// hold the lobby's lock.
+func (m *LobbyManager) leaveLobbyLocked(lobby *Lobby, playerID PlayerID, reason string) error {
 	var leavingPlayer *Player
 	newPlayers := make([]*Player, 0, len(lobby.Players))
 	for _, p := range lobby.Players {
@@ -210,63 +810,201 @@ func (m *LobbyManager) LeaveLobby(lobbyID LobbyID, playerID PlayerID) error {
 		return errors.New("player not in lobby")
 	}
 	lobby.Players = newPlayers
+	lobby.LastActivity = time.Now()
+	delete(lobby.Moderators, playerID)
+	m.removeMembership(playerID, lobby.ID)
+	m.count(countLeaves)
+	previousOwnerID := lobby.OwnerID
+	if lobby.OwnerID == string(playerID) && len(lobby.Players) > 0 {
+		m.transferOwnership(lobby, leavingPlayer)
+	}
+	if lobby.countdown != nil && len(lobby.Players) < m.minPlayers(lobby) {
+		m.cancelCountdownLocked(lobby)
+	}
 	if m.Events != nil {
 		if m.Events.OnPlayerLeave != nil {
-			m.Events.OnPlayerLeave(lobby, leavingPlayer)
+			m.emitPlayer(lobby, leavingPlayer, m.Events.OnPlayerLeave)
 		}
 		if len(lobby.Players) == 0 && m.Events.OnLobbyEmpty != nil {
-			m.Events.OnLobbyEmpty(lobby)
+			m.emit(lobby, m.Events.OnLobbyEmpty)
 		}
 		if m.Events.OnLobbyStateChange != nil {
-			m.Events.OnLobbyStateChange(lobby)
+			m.emit(lobby, m.Events.OnLobbyStateChange)
 		}
 	}
-	m.broadcastLobbyState(lobby)
+	m.broadcastLobbyState(lobby, reason)
+	if lobby.OwnerID != previousOwnerID {
+		m.broadcastOwnerChanged(lobby, previousOwnerID)
+	}
 
-	if len(lobby.Players) == 0 {
-		if m.Events != nil && m.Events.OnLobbyDeleted != nil {
-			m.Events.OnLobbyDeleted(lobby)
+	return nil
+}
+
+// isAbandoned reports whether a lobby is empty and should be deleted. A lobby held for its
+// last player is kept until the hold ends.
+func isAbandoned(lobby *Lobby) bool {
+	return len(lobby.Players) == 0 && !lobby.PersistWhenEmpty && lobby.lastPlayerHold == nil
+}
+
+// removeIfAbandonedLocked deletes the lobby if its last player has left and it was not
+// created with PersistWhenEmpty. Caller must hold m.mu exclusively.
+func (m *LobbyManager) removeIfAbandonedLocked(lobby *Lobby) {
+	if isAbandoned(lobby) {
+		m.removeLobbyLocked(lobby)
+	}
+}
+
+// transferOwnership hands the lobby to a remaining player after its owner left.
+// Caller must hold the lobby's lock, and the lobby must have at least one player.
+func (m *LobbyManager) transferOwnership(lobby *Lobby, leaving *Player) {
+	var next *Player
+	if m.OwnerSelector != nil {
+		if candidate := m.OwnerSelector(lobby, leaving); candidate != nil && findPlayer(lobby, candidate.ID) != nil {
+			next = candidate
 		}
-		delete(m.lobbies, lobbyID)
 	}
-	return nil
+	if next == nil {
+		next = lobby.Players[0] // Players are kept in join order, so this is the longest-tenured player
+	}
+	lobby.OwnerID = string(next.ID)
+	delete(lobby.Moderators, next.ID)
+}
+
+// broadcastOwnerChanged tells the lobby who the new owner is, using OwnerChangedBuilder if set.
+func (m *LobbyManager) broadcastOwnerChanged(lobby *Lobby, previousOwnerID string) {
+	if !m.canBroadcast() {
+		return
+	}
+	var msg interface{} = OwnerChangedResponse{
+		Action:          "owner_changed",
+		LobbyID:         string(lobby.ID),
+		NewOwnerID:      lobby.OwnerID,
+		PreviousOwnerID: previousOwnerID,
+	}
+	if m.Events.OwnerChangedBuilder != nil {
+		msg = m.Events.OwnerChangedBuilder(lobby, previousOwnerID)
+	}
+	m.BroadcastToLobby(lobby, msg)
 }
 
 // SetPlayerReady updates a player's ready status in a lobby.
+// Returns ErrorCodeLobbyNotFound, ErrorCodePlayerNotInLobby, or ErrorCodeLobbyNotWaiting
+// if the lobby is missing, the player is not a member, or the lobby is no longer waiting.
 func (m *LobbyManager) SetPlayerReady(lobbyID LobbyID, playerID PlayerID, ready bool) error {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	defer unlock()
+	_, err := m.setPlayerReadyLocked(lobby, playerID, ready)
+	return err
+}
+
+// SetPlayerReadyAndMaybeStart sets a player's ready status and, if the lobby has AutoStart
+// and both validate and ExternalStartCheck accept the lobby, starts the game in the same
+// critical section. It reports whether the game was started.
+func (m *LobbyManager) SetPlayerReadyAndMaybeStart(lobbyID LobbyID, playerID PlayerID, ready bool, validate func(*Lobby, string) error) (bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	lobby, exists := m.lobbies[lobbyID]
 	if !exists {
-		return errors.New("lobby does not exist")
+		return false, ErrLobbyNotFound(string(lobbyID))
 	}
-	var targetPlayer *Player
-	for _, p := range lobby.Players {
-		if p.ID == playerID {
-			targetPlayer = p
-			break
-		}
+	player, err := m.setPlayerReadyLocked(lobby, playerID, ready)
+	if err != nil {
+		return false, err
 	}
+	return m.maybeAutoStartLocked(lobby, player.Username, validate), nil
+}
+
+// maybeAutoStartLocked starts the game if the lobby has AutoStart and validate (when set) and
+// ExternalStartCheck pass, reporting whether it started. Caller must hold the lobby's lock.
+func (m *LobbyManager) maybeAutoStartLocked(lobby *Lobby, username string, validate func(*Lobby, string) error) bool {
+	if !lobby.AutoStart || lobby.State != LobbyWaiting {
+		return false
+	}
+	if validate != nil && validate(lobby, username) != nil {
+		return false
+	}
+	if m.runExternalStartCheck(context.Background(), lobby) != nil {
+		return false
+	}
+	return m.startGameLocked(lobby) == nil
+}
+
+// setPlayerReadyLocked updates a player's ready status and returns the player. Caller must
+// hold the lobby's lock.
+func (m *LobbyManager) setPlayerReadyLocked(lobby *Lobby, playerID PlayerID, ready bool) (*Player, error) {
+	targetPlayer := findPlayer(lobby, playerID)
 	if targetPlayer == nil {
-		return errors.New("player not in lobby")
+		return nil, ErrPlayerNotInLobby(string(playerID), string(lobby.ID))
+	}
+	if lobby.State != LobbyWaiting {
+		return nil, ErrLobbyNotWaiting(string(lobby.ID))
+	}
+	if lobby.ReadyLocked {
+		return nil, ErrReadyLocked(string(lobby.ID))
 	}
 	if targetPlayer.Ready == ready {
-		return nil // No change
+		return targetPlayer, nil // No change
 	}
 	targetPlayer.Ready = ready
+	lobby.LastActivity = time.Now()
+	if ready {
+		m.count(countReadies)
+	}
 	if m.Events != nil {
 		if m.Events.OnPlayerReady != nil {
-			m.Events.OnPlayerReady(lobby, targetPlayer)
+			m.emitPlayer(lobby, targetPlayer, m.Events.OnPlayerReady)
 		}
 		if m.Events.OnLobbyStateChange != nil {
-			m.Events.OnLobbyStateChange(lobby)
+			m.emit(lobby, m.Events.OnLobbyStateChange)
 		}
 	}
-	m.broadcastLobbyState(lobby)
+	m.broadcastLobbyState(lobby, ReasonPlayerReady)
+	return targetPlayer, nil
+}
+
+// LockReadyState freezes or unfreezes every player's ready status, e.g. for a start countdown.
+// While locked, SetPlayerReady fails with ErrorCodeLobbyLocked. The owner and moderators may
+// change the lock; the change is broadcast with ReasonReadyLockChanged.
+func (m *LobbyManager) LockReadyState(lobbyID LobbyID, modID string, locked bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, modID) {
+		return ErrUnauthorized("lock_ready_state")
+	}
+	if lobby.ReadyLocked == locked {
+		return nil // No change
+	}
+	lobby.ReadyLocked = locked
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonReadyLockChanged)
 	return nil
 }
 
-// SetLobbyState updates the state of a lobby and broadcasts the change
+// ActionAllowed reports whether action may be used against the lobby, per its AllowedActions.
+// Unknown lobbies allow everything so the handler can report them properly.
+func (m *LobbyManager) ActionAllowed(lobbyID LobbyID, action string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return true
+	}
+	allowed, listed := lobby.AllowedActions[action]
+	return !listed || allowed
+}
+
+// SetLobbyState updates the state of a lobby and broadcasts the change. It has the same side
+// effects as every other transition: entering in-game sends game_started, and returning to
+// waiting clears ready flags.
 func (m *LobbyManager) SetLobbyState(lobbyID LobbyID, state LobbyState) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -277,28 +1015,152 @@ func (m *LobbyManager) SetLobbyState(lobbyID LobbyID, state LobbyState) error {
 	if lobby.State == state {
 		return nil // No change
 	}
+	return m.transitionState(lobby, state, ReasonStateChanged)
+}
+
+// transitionState moves a lobby to state and applies the side effects of the transition, so
+// every path that changes state behaves the same way:
+//
+//   - LastActivity is updated and OnLobbyStateChange fires, followed by OnGameStart when
+//     entering LobbyInGame or OnGameEnd when entering LobbyFinished.
+//   - Entering LobbyInGame stamps StartedAt, counts a start and sends game_started after the
+//     lobby_state broadcast.
+//   - Returning to LobbyWaiting clears every ready flag, the ready lock and StartedAt, so the
+//     next round starts fresh.
+//   - Leaving LobbyWaiting cancels any ready countdown.
+//   - lobby_state is broadcast with reason.
+//
+// Entering LobbyInGame fails with ErrTooManyGames, changing nothing, when MaxConcurrentGames
+// games are already running. Caller must hold the lobby's lock.
+func (m *LobbyManager) transitionState(lobby *Lobby, state LobbyState, reason string) error {
+	if state == LobbyInGame && lobby.State != LobbyInGame {
+		if !m.acquireGameSlot() {
+			return ErrTooManyGames(m.MaxConcurrentGames)
+		}
+	} else if lobby.State == LobbyInGame && state != LobbyInGame {
+		m.releaseGameSlot()
+	}
+	if state != LobbyWaiting {
+		m.cancelCountdownLocked(lobby)
+	}
+	now := time.Now()
 	lobby.State = state
+	lobby.LastActivity = now
+	switch state {
+	case LobbyInGame:
+		lobby.StartedAt = now
+		m.count(countStarts)
+	case LobbyWaiting:
+		for _, p := range lobby.Players {
+			p.Ready = false
+		}
+		lobby.ReadyLocked = false
+		lobby.StartedAt = time.Time{}
+	}
 	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
-		m.Events.OnLobbyStateChange(lobby)
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	if m.Events != nil {
+		if state == LobbyInGame && m.Events.OnGameStart != nil {
+			m.emit(snapshotLobby(lobby), m.Events.OnGameStart)
+		}
+		if state == LobbyFinished && m.Events.OnGameEnd != nil {
+			m.emit(snapshotLobby(lobby), m.Events.OnGameEnd)
+		}
+	}
+	m.broadcastLobbyState(lobby, reason)
+	if state == LobbyInGame {
+		m.broadcastCritical(lobby, GameStartedResponse{
+			Action:    "game_started",
+			LobbyID:   string(lobby.ID),
+			StartedAt: lobby.StartedAt,
+		})
 	}
-	m.broadcastLobbyState(lobby)
 	return nil
 }
 
-// StartGame sets the lobby state to in-game if the user is allowed to start the game
-func (m *LobbyManager) StartGame(lobbyID LobbyID, userID string) error {
+// UpdateLobbyMetadata replaces a lobby's metadata and broadcasts the change.
+// The metadata must pass the same validateLobbyInput rules as CreateLobby.
+func (m *LobbyManager) UpdateLobbyMetadata(lobbyID LobbyID, metadata map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if err := m.validateLobbyInput(lobby.Name, metadata); err != nil {
+		return err
+	}
+	lobby.Metadata = metadata
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonMetadataChanged)
+	return nil
+}
+
+// SetPlayersMetadata merges per-player metadata into several players at once and broadcasts a
+// single update. Only the owner may do this. Every target must be in the lobby and every
+// entry must pass the metadata limits, otherwise nothing is applied.
+func (m *LobbyManager) SetPlayersMetadata(lobbyID LobbyID, ownerID string, updates map[PlayerID]map[string]interface{}) error {
+	for _, metadata := range updates {
+		if err := validateMetadata(metadata, m.MaxMetadataDepth, m.MaxMetadataElements); err != nil {
+			return err
+		}
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if lobby.OwnerID != ownerID {
+		return ErrUnauthorized("set_players_metadata")
+	}
+	targets := make(map[PlayerID]*Player, len(updates))
+	for playerID := range updates {
+		player := findPlayer(lobby, playerID)
+		if player == nil {
+			return ErrPlayerNotInLobby(string(playerID), string(lobbyID))
+		}
+		targets[playerID] = player
+	}
+	for playerID, metadata := range updates {
+		player := targets[playerID]
+		if player.Metadata == nil {
+			player.Metadata = make(map[string]interface{}, len(metadata))
+		}
+		for key, value := range metadata {
+			player.Metadata[key] = value
+		}
+	}
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonMetadataChanged)
+	return nil
+}
+
+// StartGame sets the lobby state to in-game if the user is allowed to start the game.
+// Players receive the updated lobby state followed by a game_started message whose
+// delivery is reported through OnDeliveryReport.
+func (m *LobbyManager) StartGame(lobbyID LobbyID, userID string) error {
+	return m.StartGameContext(context.Background(), lobbyID, userID)
+}
+
+// StartGameContext is StartGame with a context that is passed to ExternalStartCheck.
+func (m *LobbyManager) StartGameContext(ctx context.Context, lobbyID LobbyID, userID string) error {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
 	if !exists {
 		return errors.New("lobby does not exist")
 	}
+	defer unlock()
 
 	canStart := false
 	if m.Events != nil && m.Events.CanStartGame != nil {
 		canStart = m.Events.CanStartGame(lobby, userID)
 	} else {
-		canStart = (lobby.OwnerID == userID)
+		canStart = m.actsAsOwner(lobby, userID)
 	}
 	if !canStart {
 		return errors.New("not allowed to start the game")
@@ -306,45 +1168,321 @@ func (m *LobbyManager) StartGame(lobbyID LobbyID, userID string) error {
 	if lobby.State == LobbyInGame {
 		return errors.New("game already started")
 	}
-	lobby.State = LobbyInGame
+	if err := m.runExternalStartCheck(ctx, lobby); err != nil {
+		return err
+	}
+	return m.startGameLocked(lobby)
+}
+
+// runExternalStartCheck runs ExternalStartCheck, if set, wrapping a failure in
+// ErrorCodeStartBlocked. Caller must hold the lobby's lock.
+func (m *LobbyManager) runExternalStartCheck(ctx context.Context, lobby *Lobby) error {
+	if m.ExternalStartCheck == nil {
+		return nil
+	}
+	if err := m.ExternalStartCheck(ctx, lobby); err != nil {
+		return ErrStartBlocked(err.Error())
+	}
+	return nil
+}
+
+// startGameLocked moves the lobby in-game and announces it, unless MaxConcurrentGames is
+// reached. Caller must hold the lobby's lock.
+func (m *LobbyManager) startGameLocked(lobby *Lobby) error {
+	return m.transitionState(lobby, LobbyInGame, ReasonGameStarted)
+}
+
+// AddModerator grants moderator rights to a player in the lobby. Only the owner may do this.
+func (m *LobbyManager) AddModerator(lobbyID LobbyID, ownerID string, playerID PlayerID) error {
+	return m.setModerator(lobbyID, ownerID, playerID, true)
+}
+
+// RemoveModerator revokes a player's moderator rights. Only the owner may do this.
+func (m *LobbyManager) RemoveModerator(lobbyID LobbyID, ownerID string, playerID PlayerID) error {
+	return m.setModerator(lobbyID, ownerID, playerID, false)
+}
+
+func (m *LobbyManager) setModerator(lobbyID LobbyID, ownerID string, playerID PlayerID, moderator bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if lobby.OwnerID != ownerID {
+		return ErrUnauthorized("set_moderator")
+	}
+	if findPlayer(lobby, playerID) == nil {
+		return ErrPlayerNotInLobby(string(playerID), string(lobbyID))
+	}
+	if lobby.Moderators[playerID] == moderator {
+		return nil // No change
+	}
+	if moderator {
+		if lobby.Moderators == nil {
+			lobby.Moderators = make(map[PlayerID]bool)
+		}
+		lobby.Moderators[playerID] = true
+	} else {
+		delete(lobby.Moderators, playerID)
+	}
 	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
-		m.Events.OnLobbyStateChange(lobby)
+		m.emit(lobby, m.Events.OnLobbyStateChange)
 	}
-	m.broadcastLobbyState(lobby)
+	m.broadcastLobbyState(lobby, ReasonModeratorsChanged)
 	return nil
 }
 
-// ListLobbies returns all lobbies managed by the LobbyManager.
+// ListLobbies returns snapshots of the lobbies managed by the LobbyManager, leaving out lobbies
+// that have not yet reached MinListingAge or MinListingPlayers. Snapshots can be read without
+// a lock while the lobbies keep changing. If ReadReplica is set, the list comes from the
+// replica instead.
 func (m *LobbyManager) ListLobbies() []*Lobby {
+	if m.ReadReplica != nil {
+		return m.listable(m.ReadReplica.ListLobbies())
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	lobbies := make([]*Lobby, 0, len(m.lobbies))
 	for _, l := range m.lobbies {
 		lobbies = append(lobbies, l)
 	}
+	return snapshotLobbies(m.listable(lobbies))
+}
+
+// snapshotLobbies replaces each lobby with a snapshot, reusing the slice. Caller must hold
+// every lobby's lock, i.e. m.mu exclusively for the manager's lobbies.
+func snapshotLobbies(lobbies []*Lobby) []*Lobby {
+	for i, l := range lobbies {
+		lobbies[i] = snapshotLobby(l)
+	}
 	return lobbies
 }
 
-// GetLobbyByID returns a lobby by its ID and whether it exists.
-func (m *LobbyManager) GetLobbyByID(id LobbyID) (*Lobby, bool) {
+// listable filters out lobbies below MinListingAge or MinListingPlayers, reusing the slice.
+func (m *LobbyManager) listable(lobbies []*Lobby) []*Lobby {
+	if m.MinListingAge <= 0 && m.MinListingPlayers <= 0 {
+		return lobbies
+	}
+	now := time.Now()
+	visible := lobbies[:0]
+	for _, l := range lobbies {
+		if now.Sub(l.CreatedAt) >= m.MinListingAge && len(l.Players) >= m.MinListingPlayers {
+			visible = append(visible, l)
+		}
+	}
+	return visible
+}
+
+// AllPlayersReady reports whether the lobby has players and all of them are ready, and whether
+// the lobby exists. The check runs under the lock so it sees a consistent snapshot even while
+// players concurrently join, leave, or toggle ready.
+func (m *LobbyManager) AllPlayersReady(lobbyID LobbyID) (bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return false, false
+	}
+	return allPlayersReady(lobby.Players), true
+}
+
+// RemainingCapacity returns how many more players can join a lobby, accounting for team caps and
+// seats held for disconnected players, and whether the lobby exists.
+func (m *LobbyManager) RemainingCapacity(lobbyID LobbyID) (int, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return 0, false
+	}
+	return m.remainingCapacityLocked(lobby), true
+}
+
+// remainingCapacityLocked counts the seats left in a lobby. Caller must hold the lobby's lock.
+func (m *LobbyManager) remainingCapacityLocked(lobby *Lobby) int {
+	capacity := lobby.MaxPlayers
+	if teams, ok := teamCapacity(lobby); ok && teams < capacity {
+		capacity = teams
+	}
+	remaining := capacity - m.occupiedSeats(lobby)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
+
+// AllPlayers returns the location of every player across all lobbies, ordered by lobby ID then player ID.
+// A player who belongs to several lobbies appears once per lobby.
+func (m *LobbyManager) AllPlayers() []PlayerLocation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locations := make([]PlayerLocation, 0, len(m.memberships))
+	for playerID, lobbyIDs := range m.memberships {
+		for lobbyID := range lobbyIDs {
+			lobby, exists := m.lobbies[lobbyID]
+			if !exists {
+				continue
+			}
+			for _, p := range lobby.Players {
+				if p.ID == playerID {
+					locations = append(locations, PlayerLocation{PlayerID: p.ID, Username: p.Username, LobbyID: lobbyID})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].LobbyID != locations[j].LobbyID {
+			return locations[i].LobbyID < locations[j].LobbyID
+		}
+		return locations[i].PlayerID < locations[j].PlayerID
+	})
+	return locations
+}
+
+// GetLobbyByID returns a lobby by its ID and whether it exists.
+// If ReadReplica is set, the lookup goes to the replica instead.
+func (m *LobbyManager) GetLobbyByID(id LobbyID) (*Lobby, bool) {
+	if m.ReadReplica != nil {
+		return m.ReadReplica.GetLobby(id)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	lobby, exists := m.lobbies[id]
 	return lobby, exists
 }
 
+// allPlayersReady reports whether there is at least one player and every player is ready.
+func allPlayersReady(players []*Player) bool {
+	if len(players) == 0 {
+		return false
+	}
+	for _, p := range players {
+		if !p.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// canModerate reports whether a user is the lobby owner or one of its moderators.
+func canModerate(lobby *Lobby, userID string) bool {
+	return lobby.OwnerID == userID || lobby.Moderators[PlayerID(userID)]
+}
+
+// isOwnerless reports whether a lobby has no owner among its members.
+func isOwnerless(lobby *Lobby) bool {
+	return lobby.OwnerID == "" || findPlayer(lobby, PlayerID(lobby.OwnerID)) == nil
+}
+
+// actsAsOwner reports whether a user may act as the lobby owner, including under
+// OwnerlessPolicy when the lobby is ownerless.
+func (m *LobbyManager) actsAsOwner(lobby *Lobby, userID string) bool {
+	if userID != "" && lobby.OwnerID == userID {
+		return true
+	}
+	if !isOwnerless(lobby) {
+		return false
+	}
+	switch m.OwnerlessPolicy {
+	case OwnerlessSystemOwner:
+		return m.SystemOwnerID != "" && userID == m.SystemOwnerID
+	case OwnerlessAnyMember:
+		return findPlayer(lobby, PlayerID(userID)) != nil
+	default:
+		return false
+	}
+}
+
+// playerRole returns the role of a user within a lobby.
+func playerRole(lobby *Lobby, userID string) string {
+	switch {
+	case lobby.OwnerID == userID:
+		return RoleOwner
+	case lobby.Moderators[PlayerID(userID)]:
+		return RoleModerator
+	default:
+		return RolePlayer
+	}
+}
+
+// findPlayer returns the player with the given ID in the lobby, or nil.
+func findPlayer(lobby *Lobby, playerID PlayerID) *Player {
+	for _, p := range lobby.Players {
+		if p.ID == playerID {
+			return p
+		}
+	}
+	return nil
+}
+
+// occupiedSeats counts players plus unexpired held seats and join reservations, releasing
+// any that have expired. Caller must hold the lobby's lock.
+func (m *LobbyManager) occupiedSeats(lobby *Lobby) int {
+	now := time.Now()
+	for playerID, expiresAt := range lobby.heldSeats {
+		if !now.Before(expiresAt) {
+			delete(lobby.heldSeats, playerID)
+		}
+	}
+	for token, pending := range lobby.pendingJoins {
+		if !now.Before(pending.ExpiresAt) {
+			delete(lobby.pendingJoins, token)
+			m.forgetPendingJoin(token)
+		}
+	}
+	return len(lobby.Players) + len(lobby.heldSeats) + len(lobby.pendingJoins)
+}
+
 // broadcastLobbyState broadcasts the current lobby state to all players.
-func (m *LobbyManager) broadcastLobbyState(lobby *Lobby) {
-	if m.Events == nil || m.Events.Broadcaster == nil {
+// When the built message is a LobbyStateResponse, reason records what triggered the broadcast.
+func (m *LobbyManager) broadcastLobbyState(lobby *Lobby, reason string) {
+	if !m.canBroadcast() {
 		return
 	}
+	// Build from a snapshot so the message shares no players or metadata with the live lobby,
+	// and broadcasters may encode it after the lock is released
+	snapshot := snapshotLobby(lobby)
 	var msg interface{}
 	if m.Events.LobbyStateBuilder != nil {
-		msg = m.Events.LobbyStateBuilder(lobby)
+		msg = m.Events.LobbyStateBuilder(snapshot)
 	} else {
-		msg = lobby
+		// Match what handlers send so clients only ever see one lobby_state shape
+		msg = NewResponseBuilder(m).BuildLobbyStateResponse(snapshot)
+	}
+	resp, isState := msg.(LobbyStateResponse)
+	if isState {
+		resp.Reason = reason
+		msg = resp
+	}
+	var private []interface{}
+	if isState && m.Events.PlayerPrivateStateBuilder != nil {
+		private = make([]interface{}, len(snapshot.Players))
+		for i, player := range snapshot.Players {
+			private[i] = m.Events.PlayerPrivateStateBuilder(snapshot, player)
+		}
+	}
+	if m.DedupeBroadcasts {
+		// Private state is hashed too, so a change only a player can see still goes out
+		if encoded, err := json.Marshal([]interface{}{msg, private}); err == nil {
+			hash := sha256.Sum256(encoded)
+			if hash == lobby.lastBroadcastHash {
+				return
+			}
+			lobby.lastBroadcastHash = hash
+		}
+	}
+	for i, player := range snapshot.Players {
+		if private != nil {
+			tailored := resp
+			tailored.Private = private[i]
+			m.deliver(string(player.ID), tailored)
+			continue
+		}
+		m.deliver(string(player.ID), msg)
 	}
-	for _, player := range lobby.Players {
-		m.Events.Broadcaster(string(player.ID), msg)
+	for _, spectator := range snapshot.Spectators {
+		m.deliver(string(spectator.ID), msg)
 	}
 }
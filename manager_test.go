@@ -1,7 +1,16 @@
 package lobby
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestLobbyManager_BasicFlow(t *testing.T) {
@@ -284,3 +293,2039 @@ func TestSessionHijackingPrevention(t *testing.T) {
 
 	t.Log("✅ All session hijacking attempts were properly blocked")
 }
+
+func TestLobbyManager_MaxLobbiesPerPlayer(t *testing.T) {
+	manager := NewLobbyManager()
+
+	first, _ := manager.CreateLobby("First", 4, true, nil, "owner1")
+	second, _ := manager.CreateLobby("Second", 4, true, nil, "owner1")
+	third, _ := manager.CreateLobby("Third", 4, true, nil, "owner1")
+
+	p1 := &Player{ID: "player1", Username: "Alice"}
+	if err := manager.JoinLobby(first.ID, p1); err != nil {
+		t.Fatalf("JoinLobby failed: %v", err)
+	}
+
+	// Default cap is a single lobby
+	err := manager.JoinLobby(second.ID, p1)
+	lobbyErr, ok := err.(*LobbyError)
+	if !ok || lobbyErr.Code != ErrorCodePlayerAlreadyInLobby {
+		t.Fatalf("Expected %s, got %v", ErrorCodePlayerAlreadyInLobby, err)
+	}
+
+	// Raising the cap allows multi-membership up to the new limit
+	manager.MaxLobbiesPerPlayer = 2
+	if err := manager.JoinLobby(second.ID, p1); err != nil {
+		t.Fatalf("JoinLobby with cap 2 failed: %v", err)
+	}
+	if err := manager.JoinLobby(third.ID, p1); err == nil {
+		t.Fatal("JoinLobby should fail once the cap of 2 is reached")
+	}
+
+	// Leaving frees a membership slot
+	if err := manager.LeaveLobby(first.ID, p1.ID); err != nil {
+		t.Fatalf("LeaveLobby failed: %v", err)
+	}
+	if err := manager.JoinLobby(third.ID, p1); err != nil {
+		t.Errorf("JoinLobby after leaving should succeed: %v", err)
+	}
+}
+
+func TestLobbyManager_ExportImport(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Export Lobby", 4, true, map[string]interface{}{"mode": "ctf"}, "owner1")
+	p1 := &Player{ID: "player1", Username: "Alice", Metadata: map[string]interface{}{"color": "red"}}
+	p2 := &Player{ID: "player2", Username: "Bob"}
+	manager.JoinLobby(lobby.ID, p1)
+	manager.JoinLobby(lobby.ID, p2)
+	manager.SetPlayerReady(lobby.ID, p1.ID, true)
+	manager.SetLobbyState(lobby.ID, LobbyInGame)
+
+	data, err := manager.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// Clear the manager, then restore it from the export
+	if err := manager.Import([]byte("[]"), ImportReplace); err != nil {
+		t.Fatalf("Clearing import failed: %v", err)
+	}
+	if len(manager.ListLobbies()) != 0 {
+		t.Fatal("Expected no lobbies after clearing")
+	}
+	if err := manager.Import(data, ImportReplace); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	got, exists := manager.GetLobbyByID(lobby.ID)
+	if !exists {
+		t.Fatal("Lobby missing after import")
+	}
+	if got.Name != lobby.Name || got.MaxPlayers != lobby.MaxPlayers || got.Public != lobby.Public ||
+		got.State != LobbyInGame || got.OwnerID != lobby.OwnerID || !got.CreatedAt.Equal(lobby.CreatedAt) {
+		t.Errorf("Lobby fields not preserved: got %+v", got)
+	}
+	if !reflect.DeepEqual(got.Metadata, lobby.Metadata) {
+		t.Errorf("Metadata not preserved: got %v, want %v", got.Metadata, lobby.Metadata)
+	}
+	if len(got.Players) != 2 {
+		t.Fatalf("Expected 2 players, got %d", len(got.Players))
+	}
+	for i, p := range got.Players {
+		want := lobby.Players[i]
+		if p.ID != want.ID || p.Username != want.Username || p.Ready != want.Ready || !reflect.DeepEqual(p.Metadata, want.Metadata) {
+			t.Errorf("Player %d not preserved: got %+v, want %+v", i, p, want)
+		}
+	}
+
+	// The membership index is rebuilt, so imported players still count toward the cap
+	other, _ := manager.CreateLobby("Other", 4, true, nil, "owner2")
+	if err := manager.JoinLobby(other.ID, p1); err == nil {
+		t.Error("Imported membership should prevent joining a second lobby")
+	}
+}
+
+func TestLobbyManager_ImportReplaceStopsCountdowns(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Countdown Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	expired := make(chan *Lobby, 1)
+	if err := manager.StartReadyCountdown(lobby.ID, 30*time.Millisecond, func(l *Lobby) { expired <- l }); err != nil {
+		t.Fatalf("StartReadyCountdown failed: %v", err)
+	}
+
+	if err := manager.Import([]byte("[]"), ImportReplace); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if lobby.countdown != nil {
+		t.Error("Expected the replaced lobby's countdown to be cancelled")
+	}
+	select {
+	case <-expired:
+		t.Error("Countdown of a replaced lobby should not time out")
+	case <-time.After(80 * time.Millisecond):
+	}
+}
+
+func TestLobbyManager_AllPlayers(t *testing.T) {
+	manager := NewLobbyManager()
+	a, _ := manager.CreateLobby("A", 4, true, nil, "owner1")
+	b, _ := manager.CreateLobby("B", 4, true, nil, "owner2")
+	manager.JoinLobby(a.ID, &Player{ID: "p2", Username: "Bob"})
+	manager.JoinLobby(a.ID, &Player{ID: "p1", Username: "Alice"})
+	manager.JoinLobby(b.ID, &Player{ID: "p3", Username: "Carol"})
+
+	want := []PlayerLocation{
+		{PlayerID: "p1", Username: "Alice", LobbyID: a.ID},
+		{PlayerID: "p2", Username: "Bob", LobbyID: a.ID},
+		{PlayerID: "p3", Username: "Carol", LobbyID: b.ID},
+	}
+	if b.ID < a.ID { // Sorted by lobby ID, which is random
+		want = append(want[2:], want[:2]...)
+	}
+	if got := manager.AllPlayers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllPlayers = %+v, want %+v", got, want)
+	}
+
+	manager.LeaveLobby(b.ID, "p3")
+	if got := manager.AllPlayers(); len(got) != 2 {
+		t.Errorf("Expected 2 players after leave, got %+v", got)
+	}
+}
+
+func TestLobbyManager_DisconnectHoldsSeat(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.DisconnectGrace = time.Minute
+	lobby, _ := manager.CreateLobby("Test Lobby", 2, true, nil, "owner1")
+	p1 := &Player{ID: "player1", Username: "Alice"}
+	p2 := &Player{ID: "player2", Username: "Bob"}
+	p3 := &Player{ID: "player3", Username: "Carol"}
+	manager.JoinLobby(lobby.ID, p1)
+	manager.JoinLobby(lobby.ID, p2)
+
+	if err := manager.DisconnectPlayer(lobby.ID, p2.ID); err != nil {
+		t.Fatalf("DisconnectPlayer failed: %v", err)
+	}
+	if len(lobby.Players) != 1 {
+		t.Fatalf("Expected disconnected player to be removed, got %d players", len(lobby.Players))
+	}
+
+	// The held seat blocks newcomers
+	err := manager.JoinLobby(lobby.ID, p3)
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyFull {
+		t.Fatalf("Expected %s while seat is held, got %v", ErrorCodeLobbyFull, err)
+	}
+
+	// The disconnected player can reclaim it
+	if err := manager.JoinLobby(lobby.ID, p2); err != nil {
+		t.Fatalf("Returning player should reclaim held seat: %v", err)
+	}
+
+	// Once the grace expires the seat is freed
+	manager.DisconnectPlayer(lobby.ID, p2.ID)
+	lobby.heldSeats[p2.ID] = time.Now().Add(-time.Second)
+	if err := manager.JoinLobby(lobby.ID, p3); err != nil {
+		t.Errorf("Expired hold should free the seat: %v", err)
+	}
+}
+
+func TestLobbyManager_GameStartDeliveryReport(t *testing.T) {
+	var report []DeliveryReceipt
+	var reported interface{}
+	events := &LobbyEvents{
+		ReliableBroadcaster: func(userID string, message interface{}) error {
+			if userID == "player2" {
+				return errors.New("connection closed")
+			}
+			return nil
+		},
+		OnDeliveryReport: func(l *Lobby, message interface{}, receipts []DeliveryReceipt) {
+			reported = message
+			report = receipts
+		},
+	}
+	manager := NewLobbyManagerWithEvents(events)
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	if err := manager.StartGame(lobby.ID, "player1"); err != nil {
+		t.Fatalf("StartGame failed: %v", err)
+	}
+
+	if msg, ok := reported.(GameStartedResponse); !ok || msg.Action != "game_started" {
+		t.Fatalf("Expected game_started report, got %#v", reported)
+	}
+	if len(report) != 2 {
+		t.Fatalf("Expected 2 receipts, got %d", len(report))
+	}
+	for _, r := range report {
+		if r.UserID == "player1" && r.Err != nil {
+			t.Errorf("Expected delivery to player1 to succeed, got %v", r.Err)
+		}
+		if r.UserID == "player2" && r.Err == nil {
+			t.Error("Expected delivery to player2 to fail")
+		}
+	}
+}
+
+func TestLobbyManager_RemainingCapacity(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.DisconnectGrace = time.Minute
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+
+	if remaining, ok := manager.RemainingCapacity(lobby.ID); !ok || remaining != 4 {
+		t.Fatalf("Expected 4 remaining, got %d (exists=%v)", remaining, ok)
+	}
+
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	if remaining, _ := manager.RemainingCapacity(lobby.ID); remaining != 2 {
+		t.Errorf("Expected 2 remaining after joins, got %d", remaining)
+	}
+
+	// A held seat still counts as occupied
+	manager.DisconnectPlayer(lobby.ID, "player2")
+	if remaining, _ := manager.RemainingCapacity(lobby.ID); remaining != 2 {
+		t.Errorf("Expected 2 remaining with a held seat, got %d", remaining)
+	}
+
+	if _, ok := manager.RemainingCapacity("missing"); ok {
+		t.Error("Expected missing lobby to report not found")
+	}
+}
+
+func TestLobbyManager_AllPlayersReadyConcurrent(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	var wg sync.WaitGroup
+	for _, id := range []PlayerID{"player1", "player2"} {
+		wg.Add(1)
+		go func(id PlayerID) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				manager.SetPlayerReady(lobby.ID, id, i%2 == 0)
+			}
+		}(id)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if _, exists := manager.AllPlayersReady(lobby.ID); !exists {
+				t.Error("Lobby should exist")
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	manager.SetPlayerReady(lobby.ID, "player2", false)
+	if ready, _ := manager.AllPlayersReady(lobby.ID); ready {
+		t.Error("Expected not all ready")
+	}
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+	if ready, _ := manager.AllPlayersReady(lobby.ID); !ready {
+		t.Error("Expected all ready")
+	}
+}
+
+func TestLobbyManager_Moderators(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "owner1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+
+	if err := manager.AddModerator(lobby.ID, "owner1", "player2"); err != nil {
+		t.Fatalf("AddModerator failed: %v", err)
+	}
+	if !canModerate(lobby, "player2") || canModerate(lobby, "player3") {
+		t.Error("Only the owner and moderators should be able to moderate")
+	}
+
+	// Moderators cannot appoint other moderators
+	err := manager.AddModerator(lobby.ID, "player2", "player3")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUnauthorized {
+		t.Errorf("Expected %s, got %v", ErrorCodeUnauthorized, err)
+	}
+	if err := manager.AddModerator(lobby.ID, "owner1", "nobody"); err == nil {
+		t.Error("Expected error for player not in lobby")
+	}
+
+	resp := NewResponseBuilder(manager).BuildLobbyStateResponse(lobby)
+	roles := map[string]string{}
+	for _, p := range resp.Players {
+		roles[p.UserID] = p.Role
+	}
+	if roles["owner1"] != RoleOwner || roles["player2"] != RoleModerator || roles["player3"] != RolePlayer {
+		t.Errorf("Unexpected roles: %v", roles)
+	}
+
+	if err := manager.RemoveModerator(lobby.ID, "owner1", "player2"); err != nil {
+		t.Fatalf("RemoveModerator failed: %v", err)
+	}
+	if canModerate(lobby, "player2") {
+		t.Error("Removed moderator should no longer moderate")
+	}
+}
+
+func TestLobbyManager_OwnerTransfer(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "owner1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol", Metadata: map[string]interface{}{"rating": 1800}})
+
+	// Default: the longest-tenured remaining player
+	manager.LeaveLobby(lobby.ID, "owner1")
+	if lobby.OwnerID != "player2" {
+		t.Fatalf("Expected player2 to become owner, got %s", lobby.OwnerID)
+	}
+
+	// Custom: highest rating
+	manager.OwnerSelector = func(l *Lobby, leaving *Player) *Player {
+		var best *Player
+		bestRating := -1
+		for _, p := range l.Players {
+			if rating, ok := p.Metadata["rating"].(int); ok && rating > bestRating {
+				best, bestRating = p, rating
+			}
+		}
+		return best
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "player4", Username: "Dave", Metadata: map[string]interface{}{"rating": 1200}})
+	manager.LeaveLobby(lobby.ID, "player2")
+	if lobby.OwnerID != "player3" {
+		t.Errorf("Expected highest-rated player3 to become owner, got %s", lobby.OwnerID)
+	}
+}
+
+func TestLobbyManager_TwoPhaseJoin(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 2, true, nil, "owner1")
+	p1 := &Player{ID: "player1", Username: "Alice"}
+	p2 := &Player{ID: "player2", Username: "Bob"}
+	p3 := &Player{ID: "player3", Username: "Carol"}
+	manager.JoinLobby(lobby.ID, p1)
+
+	pending, err := manager.RequestJoin(lobby.ID, p2)
+	if err != nil {
+		t.Fatalf("RequestJoin failed: %v", err)
+	}
+	if len(lobby.Players) != 1 {
+		t.Fatalf("Reserved player should not be in the lobby yet, got %d players", len(lobby.Players))
+	}
+
+	// The reservation blocks newcomers
+	err = manager.JoinLobby(lobby.ID, p3)
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyFull {
+		t.Fatalf("Expected %s while seat is reserved, got %v", ErrorCodeLobbyFull, err)
+	}
+
+	// Only the reserving player can confirm
+	if _, err := manager.ConfirmJoin(pending.Token, p3.ID); err == nil {
+		t.Fatal("Expected confirmation by another player to fail")
+	}
+	if _, err := manager.ConfirmJoin(pending.Token, p2.ID); err != nil {
+		t.Fatalf("ConfirmJoin failed: %v", err)
+	}
+	if len(lobby.Players) != 2 {
+		t.Errorf("Expected 2 players after confirmation, got %d", len(lobby.Players))
+	}
+	if _, err := manager.ConfirmJoin(pending.Token, p2.ID); err == nil {
+		t.Error("Expected a token to be usable only once")
+	}
+}
+
+func TestLobbyManager_TwoPhaseJoinExpiry(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 1, true, nil, "owner1")
+	p1 := &Player{ID: "player1", Username: "Alice"}
+	p2 := &Player{ID: "player2", Username: "Bob"}
+
+	pending, err := manager.RequestJoin(lobby.ID, p1)
+	if err != nil {
+		t.Fatalf("RequestJoin failed: %v", err)
+	}
+	lobby.pendingJoins[pending.Token].ExpiresAt = time.Now().Add(-time.Second)
+
+	// Once the reservation expires the seat is freed
+	if err := manager.JoinLobby(lobby.ID, p2); err != nil {
+		t.Fatalf("Expired reservation should free the seat: %v", err)
+	}
+	if _, err := manager.ConfirmJoin(pending.Token, p1.ID); err == nil {
+		t.Error("Expected expired reservation to be rejected")
+	}
+}
+
+func TestLobbyManager_ConcurrentCreateSameName(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.RequireUniqueNames = true
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	created := make(chan *Lobby, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lobby, err := manager.CreateLobby("Race", 4, true, nil, fmt.Sprintf("owner%d", i))
+			if err == nil {
+				created <- lobby
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyAlreadyExists {
+			t.Errorf("Expected %s, got %v", ErrorCodeLobbyAlreadyExists, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Expected exactly one create to succeed, got %d", succeeded)
+	}
+
+	// The name is free again once the lobby is gone
+	manager.DeleteLobby((<-created).ID)
+	if _, err := manager.CreateLobby("Race", 4, true, nil, "owner1"); err != nil {
+		t.Errorf("Expected name to be reusable after deletion: %v", err)
+	}
+}
+
+func TestLobbyManager_ReadyAndMaybeStart(t *testing.T) {
+	manager := NewLobbyManager()
+	validate := ConfigurableGameStartValidator(nil)
+	manual, _ := manager.CreateLobby("Manual", 2, true, nil, "player1")
+	auto, _ := manager.CreateLobbyWithOptions("Auto", 2, true, nil, "player3", LobbyOptions{AutoStart: true})
+	manager.MaxLobbiesPerPlayer = 2
+	for _, l := range []*Lobby{manual, auto} {
+		manager.JoinLobby(l.ID, &Player{ID: "player1", Username: "Alice"})
+		manager.JoinLobby(l.ID, &Player{ID: "player2", Username: "Bob"})
+	}
+
+	for _, id := range []PlayerID{"player1", "player2"} {
+		if started, err := manager.SetPlayerReadyAndMaybeStart(manual.ID, id, true, validate); err != nil || started {
+			t.Fatalf("Lobby without AutoStart should not start: started=%v err=%v", started, err)
+		}
+	}
+
+	if started, _ := manager.SetPlayerReadyAndMaybeStart(auto.ID, "player1", true, validate); started {
+		t.Fatal("Game should not start before everyone is ready")
+	}
+	started, err := manager.SetPlayerReadyAndMaybeStart(auto.ID, "player2", true, validate)
+	if err != nil || !started || auto.State != LobbyInGame {
+		t.Errorf("Expected last ready to start the game: started=%v err=%v state=%d", started, err, auto.State)
+	}
+}
+
+func TestLobbyManager_LeaveReasons(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.RetainStateFor = time.Minute
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob", Metadata: map[string]interface{}{"team": "red"}})
+	manager.AddModerator(lobby.ID, "player1", "player2")
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+
+	// A disconnect retains state, restored on rejoin
+	if err := manager.LeaveLobbyWithReason(lobby.ID, "player2", LeaveDisconnect); err != nil {
+		t.Fatalf("Disconnect leave failed: %v", err)
+	}
+	rejoined := &Player{ID: "player2", Username: "Bob"}
+	manager.JoinLobby(lobby.ID, rejoined)
+	if !rejoined.Ready || rejoined.Metadata["team"] != "red" || !lobby.Moderators["player2"] {
+		t.Fatalf("Expected retained state to be restored, got ready=%v metadata=%v moderator=%v",
+			rejoined.Ready, rejoined.Metadata, lobby.Moderators["player2"])
+	}
+
+	// A voluntary leave discards it
+	manager.LeaveLobbyWithReason(lobby.ID, "player2", LeaveVoluntary)
+	fresh := &Player{ID: "player2", Username: "Bob"}
+	manager.JoinLobby(lobby.ID, fresh)
+	if fresh.Ready || fresh.Metadata != nil || lobby.Moderators["player2"] {
+		t.Errorf("Expected no state after voluntary leave, got ready=%v metadata=%v", fresh.Ready, fresh.Metadata)
+	}
+
+	// Retained state expires
+	manager.DisconnectPlayer(lobby.ID, "player2")
+	lobby.retained["player2"].ExpiresAt = time.Now().Add(-time.Second)
+	late := &Player{ID: "player2", Username: "Bob"}
+	manager.JoinLobby(lobby.ID, late)
+	if late.Ready {
+		t.Error("Expired state should not be restored")
+	}
+}
+
+func TestLobbyManager_MetadataLimits(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.MaxMetadataDepth = 3
+	manager.MaxMetadataElements = 5
+
+	nested := func(levels int) map[string]interface{} {
+		metadata := map[string]interface{}{"leaf": true}
+		for i := 1; i < levels; i++ {
+			metadata = map[string]interface{}{"child": metadata}
+		}
+		return metadata
+	}
+	expectInvalid := func(err error) {
+		t.Helper()
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInvalidRequest {
+			t.Errorf("Expected %s, got %v", ErrorCodeInvalidRequest, err)
+		}
+	}
+
+	if _, err := manager.CreateLobby("Deep", 4, true, nested(4), "owner1"); err == nil {
+		t.Fatal("Expected metadata nested 4 levels to be rejected")
+	} else {
+		expectInvalid(err)
+	}
+	lobby, err := manager.CreateLobby("Shallow", 4, true, nested(3), "owner1")
+	if err != nil {
+		t.Fatalf("Metadata at the depth limit should be accepted: %v", err)
+	}
+
+	tooMany := map[string]interface{}{"tags": []interface{}{"a", "b", "c", "d", "e"}}
+	expectInvalid(manager.UpdateLobbyMetadata(lobby.ID, tooMany))
+	expectInvalid(manager.UpdateLobbyMetadata(lobby.ID, nested(4)))
+	if err := manager.UpdateLobbyMetadata(lobby.ID, map[string]interface{}{"mode": "ranked"}); err != nil {
+		t.Errorf("Small metadata update should be accepted: %v", err)
+	}
+	if lobby.Metadata["mode"] != "ranked" {
+		t.Errorf("Expected metadata to be updated, got %v", lobby.Metadata)
+	}
+}
+
+func TestLobbyManager_PersistWhenEmpty(t *testing.T) {
+	var emptied []string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnLobbyEmpty: func(l *Lobby) { emptied = append(emptied, l.Name) },
+	})
+	clan, _ := manager.CreateLobbyWithOptions("Clan Room", 4, false, nil, "player1", LobbyOptions{PersistWhenEmpty: true})
+	adHoc, _ := manager.CreateLobby("Quick Game", 4, true, nil, "player2")
+	manager.MaxLobbiesPerPlayer = 2
+	manager.JoinLobby(clan.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(adHoc.ID, &Player{ID: "player1", Username: "Alice"})
+
+	manager.LeaveLobby(clan.ID, "player1")
+	manager.LeaveLobby(adHoc.ID, "player1")
+
+	if _, exists := manager.GetLobbyByID(clan.ID); !exists {
+		t.Error("Persistent lobby should survive being empty")
+	}
+	if _, exists := manager.GetLobbyByID(adHoc.ID); exists {
+		t.Error("Ad-hoc lobby should be deleted when empty")
+	}
+	if want := []string{"Clan Room", "Quick Game"}; !reflect.DeepEqual(emptied, want) {
+		t.Errorf("Expected OnLobbyEmpty for both lobbies %v, got %v", want, emptied)
+	}
+
+	// The persistent lobby can be rejoined
+	if err := manager.JoinLobby(clan.ID, &Player{ID: "player3", Username: "Carol"}); err != nil {
+		t.Errorf("Expected to rejoin persistent lobby: %v", err)
+	}
+}
+
+func TestLobbyManager_SweepIdleOwners(t *testing.T) {
+	sessions := NewSessionManager()
+	alice := sessions.CreateSession("alice")
+	bob := sessions.CreateSession("bob")
+	var idle []string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnOwnerIdle: func(l *Lobby, owner *Player) { idle = append(idle, string(owner.ID)) },
+	})
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, alice.ID)
+	manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(alice.ID), Username: "alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(bob.ID), Username: "bob"})
+
+	if swept := manager.SweepIdleOwners(sessions.LastSeen, time.Minute); len(swept) != 0 {
+		t.Fatalf("Active owner should not be swept, got %v", swept)
+	}
+
+	// The owner goes silent without disconnecting
+	alice.LastSeen = time.Now().Add(-2 * time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := manager.StartIdleOwnerSweep(ctx, sessions, 5*time.Millisecond, time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for {
+		manager.mu.Lock()
+		owner := lobby.OwnerID
+		manager.mu.Unlock()
+		if owner == bob.ID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected ownership to migrate to bob, owner is %s", owner)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(idle) != 1 || idle[0] != alice.ID {
+		t.Errorf("Expected OnOwnerIdle for alice, got %v", idle)
+	}
+	if findPlayer(lobby, PlayerID(alice.ID)) != nil {
+		t.Error("Idle owner should be removed from the lobby")
+	}
+}
+
+func TestLobbyManager_SweepIdleOwners_ConcurrentReconnect(t *testing.T) {
+	sessions := NewSessionManager()
+	sessions.RotateIDOnReconnect = true
+	manager := NewLobbyManager()
+	sessions.OnSessionIDChanged = func(oldID string, session *UserSession) {
+		manager.ReassignPlayerID(PlayerID(oldID), PlayerID(session.ID))
+	}
+	alice := sessions.CreateSession("alice")
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, alice.ID)
+	manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(alice.ID), Username: "alice"})
+	token := alice.Token
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			manager.SweepIdleOwners(sessions.LastSeen, time.Hour)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		session, ok := sessions.ReconnectSession("alice", token)
+		if !ok {
+			t.Fatal("Reconnect failed")
+		}
+		sessions.GetSessionByID(session.ID) // Updates LastSeen while the sweep reads it
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SweepIdleOwners deadlocked against ReconnectSession")
+	}
+}
+
+func TestLobbyManager_StartReaper(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	var deleted []LobbyID
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster:    rec.broadcast,
+		OnLobbyDeleted: func(l *Lobby) { deleted = append(deleted, l.ID) },
+	})
+	stale, _ := manager.CreateLobby("Stale", 4, true, nil, "player1")
+	manager.JoinLobby(stale.ID, &Player{ID: "player1", Username: "Alice"})
+	fresh, _ := manager.CreateLobby("Fresh", 4, true, nil, "player2")
+	manager.JoinLobby(fresh.ID, &Player{ID: "player2", Username: "Bob"})
+	playing, _ := manager.CreateLobby("Playing", 4, true, nil, "player3")
+	manager.JoinLobby(playing.ID, &Player{ID: "player3", Username: "Carol"})
+	manager.SetLobbyState(playing.ID, LobbyInGame)
+
+	manager.mu.Lock()
+	stale.LastActivity = time.Now().Add(-time.Hour)
+	playing.LastActivity = time.Now().Add(-time.Hour)
+	manager.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := manager.StartReaper(ctx, time.Minute, 5*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, exists := manager.GetLobbyByID(stale.ID); !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stale lobby to be reaped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, exists := manager.GetLobbyByID(fresh.ID); !exists {
+		t.Error("Recently active lobby should not be reaped")
+	}
+	if _, exists := manager.GetLobbyByID(playing.ID); !exists {
+		t.Error("In-game lobby should not be reaped")
+	}
+	if len(deleted) != 1 || deleted[0] != stale.ID {
+		t.Errorf("Expected OnLobbyDeleted for the stale lobby only, got %v", deleted)
+	}
+	var reason string
+	for _, msg := range rec.received("player1") {
+		if removed, ok := msg.(RemovedFromLobbyResponse); ok {
+			reason = removed.Reason
+		}
+	}
+	if reason != RemovalExpired {
+		t.Errorf("Expected removed_from_lobby with reason %q, got %q", RemovalExpired, reason)
+	}
+	if manager.membershipCount("player1") != 0 {
+		t.Error("Reaped lobby's players should no longer be indexed")
+	}
+}
+
+func TestLobbyManager_SeatAssignmentConcurrent(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobbyWithOptions("Teams", 12, true, nil, "owner1", LobbyOptions{TeamCount: 3})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("player%d", i)), Username: fmt.Sprintf("P%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	slots := make(map[int]bool)
+	teams := make(map[int]int)
+	for _, p := range lobby.Players {
+		if slots[p.Slot] {
+			t.Errorf("Duplicate slot %d", p.Slot)
+		}
+		slots[p.Slot] = true
+		teams[p.Team]++
+	}
+	for slot := 0; slot < 12; slot++ {
+		if !slots[slot] {
+			t.Errorf("Slot %d was not assigned", slot)
+		}
+	}
+	if teams[1] != 4 || teams[2] != 4 || teams[3] != 4 {
+		t.Errorf("Expected balanced teams of 4, got %v", teams)
+	}
+
+	// A rejoining player takes the lowest free slot and the smallest team, lowest index first
+	manager.LeaveLobby(lobby.ID, lobby.Players[7].ID)
+	leaving := lobby.Players[2]
+	manager.LeaveLobby(lobby.ID, leaving.ID)
+	next := &Player{ID: "late", Username: "Late"}
+	manager.JoinLobby(lobby.ID, next)
+	if next.Slot != 2 {
+		t.Errorf("Expected lowest free slot 2, got %d", next.Slot)
+	}
+	// Joins alternate teams 1, 2, 3, so teams 2 and 3 are now one short and team 2 wins the tie
+	if next.Team != 2 {
+		t.Errorf("Expected team 2, got %d", next.Team)
+	}
+}
+
+func TestLobbyManager_TrimToCapacity(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	lobby, _ := manager.CreateLobby("Test Lobby", 5, true, nil, "player1")
+	for i := 1; i <= 5; i++ {
+		manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("player%d", i)), Username: fmt.Sprintf("P%d", i)})
+	}
+	manager.SetPlayerReady(lobby.ID, "player5", true)
+
+	// Capacity shrinks below the current player count
+	lobby.MaxPlayers = 3
+	removed, err := manager.TrimToCapacity(lobby.ID, TrimNotReady)
+	if err != nil {
+		t.Fatalf("TrimToCapacity failed: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []PlayerID{"player4", "player3"}) {
+		t.Fatalf("Expected not-ready latest joiners to be trimmed, got %v", removed)
+	}
+	for _, id := range removed {
+		msgs := rec.received(string(id))
+		if notice, ok := msgs[len(msgs)-1].(RemovedFromLobbyResponse); !ok || notice.Reason != RemovalOverCapacity {
+			t.Errorf("Expected %s to be notified, got %#v", id, msgs[len(msgs)-1])
+		}
+	}
+
+	lobby.MaxPlayers = 2
+	removed, _ = manager.TrimToCapacity(lobby.ID, TrimLastJoined)
+	if !reflect.DeepEqual(removed, []PlayerID{"player5"}) {
+		t.Errorf("Expected last joiner to be trimmed, got %v", removed)
+	}
+	if removed, _ := manager.TrimToCapacity(lobby.ID, TrimLastJoined); len(removed) != 0 {
+		t.Errorf("Expected nothing to trim at capacity, got %v", removed)
+	}
+}
+
+func TestLobbyManager_LobbyTicker(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.StartGame(lobby.ID, "player1")
+
+	ticks := make(chan *Lobby, 100)
+	stop, err := manager.StartLobbyTicker(lobby.ID, time.Millisecond, func(l *Lobby) { ticks <- l })
+	if err != nil {
+		t.Fatalf("StartLobbyTicker failed: %v", err)
+	}
+	defer stop()
+
+	select {
+	case snapshot := <-ticks:
+		if snapshot == lobby || len(snapshot.Players) != 1 {
+			t.Errorf("Expected a snapshot copy of the lobby, got %+v", snapshot)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Ticker never fired")
+	}
+
+	// Deleting the lobby stops the ticker
+	manager.DeleteLobby(lobby.ID)
+	time.Sleep(10 * time.Millisecond)
+	for len(ticks) > 0 {
+		<-ticks
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(ticks) != 0 {
+		t.Errorf("Expected no ticks after deletion, got %d", len(ticks))
+	}
+
+	if _, err := manager.StartLobbyTicker("missing", time.Millisecond, func(*Lobby) {}); err == nil {
+		t.Error("Expected error for unknown lobby")
+	}
+}
+
+func TestLobbyManager_LobbyTickerStopsOnNewGame(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.StartGame(lobby.ID, "player1")
+
+	ticks := make(chan *Lobby, 100)
+	stop, err := manager.StartLobbyTicker(lobby.ID, 20*time.Millisecond, func(l *Lobby) { ticks <- l })
+	if err != nil {
+		t.Fatalf("StartLobbyTicker failed: %v", err)
+	}
+	defer stop()
+
+	// The game ends and another starts before the first tick
+	manager.SetLobbyState(lobby.ID, LobbyWaiting)
+	time.Sleep(time.Millisecond) // So the new game gets a different StartedAt
+	manager.SetLobbyState(lobby.ID, LobbyInGame)
+	time.Sleep(70 * time.Millisecond)
+	if len(ticks) != 0 {
+		t.Errorf("Expected the ticker to stop with its game, got %d ticks", len(ticks))
+	}
+}
+
+func TestLobbyManager_StartOwnerlessLobby(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  OwnerlessPolicy
+		starter string
+		allowed bool
+	}{
+		{"nobody rejects member", OwnerlessNobody, "player2", false},
+		{"nobody rejects system owner", OwnerlessNobody, "admin", false},
+		{"system owner allowed", OwnerlessSystemOwner, "admin", true},
+		{"system owner rejects member", OwnerlessSystemOwner, "player2", false},
+		{"any member allowed", OwnerlessAnyMember, "player2", true},
+		{"any member rejects outsider", OwnerlessAnyMember, "admin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewLobbyManager()
+			manager.OwnerlessPolicy = tt.policy
+			manager.SystemOwnerID = "admin"
+			lobby, _ := manager.CreateLobby("Orphaned", 4, true, nil, "")
+			manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+			err := manager.StartGame(lobby.ID, tt.starter)
+			if tt.allowed && err != nil {
+				t.Fatalf("Expected %s to start, got %v", tt.starter, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatalf("Expected %s to be refused", tt.starter)
+			}
+		})
+	}
+}
+
+func TestLobbyManager_OwnerlessPolicyIgnoredWithOwner(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.OwnerlessPolicy = OwnerlessAnyMember
+	lobby, _ := manager.CreateLobby("Owned", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	if err := manager.StartGame(lobby.ID, "player2"); err == nil {
+		t.Fatal("Expected non-owner to be refused while the owner is present")
+	}
+	state := NewResponseBuilder(manager).BuildLobbyStateResponse(lobby)
+	if state.Players[1].CanStartGame {
+		t.Error("Expected can_start_game false for non-owner")
+	}
+}
+
+func TestLobbyManager_AutoReadyOnJoin(t *testing.T) {
+	var states []LobbyStateResponse
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: func(userID string, message interface{}) {
+			if state, ok := message.(LobbyStateResponse); ok && userID == "player1" {
+				states = append(states, state)
+			}
+		},
+	})
+	lobby, _ := manager.CreateLobbyWithOptions("Quick", 3, true, nil, "player1",
+		LobbyOptions{AutoStart: true, AutoReadyOnJoin: true, MinPlayers: 3})
+
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	if len(states) != 1 || states[0].Reason != ReasonPlayerJoined || !states[0].Players[0].Ready {
+		t.Fatalf("Expected join broadcast with player ready, got %#v", states)
+	}
+
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	if lobby.State != LobbyWaiting {
+		t.Fatal("Game should not start before the lobby is full")
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	if lobby.State != LobbyInGame {
+		t.Fatalf("Expected the lobby to auto-start when full, state=%d", lobby.State)
+	}
+	if last := states[len(states)-1]; last.Reason != ReasonGameStarted {
+		t.Errorf("Expected final broadcast %s, got %s", ReasonGameStarted, last.Reason)
+	}
+}
+
+func TestLobbyManager_ValidationLimitsOnCreateAndUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   LobbyValidationConfig
+		metadata map[string]interface{}
+	}{
+		{"metadata bytes", LobbyValidationConfig{MaxMetadataBytes: 20}, map[string]interface{}{"description": strings.Repeat("x", 32)}},
+		{"tags from JSON", LobbyValidationConfig{MaxTags: 2}, map[string]interface{}{"tags": []interface{}{"a", "b", "c"}}},
+		{"tags from Go", LobbyValidationConfig{MaxTags: 2}, map[string]interface{}{"tags": []string{"a", "b", "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewLobbyManager()
+			manager.Validation = tt.config
+
+			_, err := manager.CreateLobby("Rejected", 4, true, tt.metadata, "player1")
+			if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInvalidRequest {
+				t.Fatalf("Expected create to fail with INVALID_REQUEST, got %v", err)
+			}
+
+			lobby, err := manager.CreateLobby("Accepted", 4, true, nil, "player1")
+			if err != nil {
+				t.Fatalf("CreateLobby failed: %v", err)
+			}
+			err = manager.UpdateLobbyMetadata(lobby.ID, tt.metadata)
+			if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInvalidRequest {
+				t.Fatalf("Expected update to fail with INVALID_REQUEST, got %v", err)
+			}
+			if lobby.Metadata != nil {
+				t.Errorf("Rejected update should not change metadata, got %v", lobby.Metadata)
+			}
+		})
+	}
+}
+
+func TestLobbyManager_ValidationMaxNameLen(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.Validation = LobbyValidationConfig{MaxNameLen: 5}
+
+	if _, err := manager.CreateLobby("Arena!", 4, true, nil, "player1"); err == nil {
+		t.Fatal("Expected a six-character name to be rejected")
+	}
+	lobby, err := manager.CreateLobby("Aréna", 4, true, nil, "player1")
+	if err != nil {
+		t.Fatalf("Expected five characters to be accepted regardless of bytes: %v", err)
+	}
+	if err := manager.UpdateLobbyMetadata(lobby.ID, map[string]interface{}{"mode": "ffa"}); err != nil {
+		t.Errorf("Update of a valid lobby should pass: %v", err)
+	}
+}
+
+func TestLobbyManager_SpectatorRatio(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobbyWithOptions("Arena", 4, true, nil, "p1", LobbyOptions{MaxSpectators: 10, SpectatorRatio: 2})
+	if err := manager.JoinAsSpectator(lobby.ID, &Player{ID: "s0"}); err == nil {
+		t.Fatal("Expected an empty lobby to refuse spectators under a ratio")
+	}
+	manager.JoinLobby(lobby.ID, &Player{ID: "p1"})
+	for i := 1; i <= 2; i++ {
+		if err := manager.JoinAsSpectator(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("s%d", i))}); err != nil {
+			t.Fatalf("Spectator %d at the ratio failed: %v", i, err)
+		}
+	}
+	err := manager.JoinAsSpectator(lobby.ID, &Player{ID: "s3"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeSpectatorsFull {
+		t.Fatalf("Expected SPECTATORS_FULL above the ratio, got %v", err)
+	}
+
+	// Another player raises the cap
+	manager.JoinLobby(lobby.ID, &Player{ID: "p2"})
+	if err := manager.JoinAsSpectator(lobby.ID, &Player{ID: "s3"}); err != nil {
+		t.Fatalf("Expected room for a spectator after a player joined, got %v", err)
+	}
+
+	// Spectators over the ratio after a leave are kept, but no new ones get in
+	manager.LeaveLobby(lobby.ID, "p2")
+	if len(lobby.Spectators) != 3 {
+		t.Errorf("Expected excess spectators to stay, got %d", len(lobby.Spectators))
+	}
+	if err := manager.JoinAsSpectator(lobby.ID, &Player{ID: "s4"}); err == nil {
+		t.Error("Expected no new spectators while over the ratio")
+	}
+}
+
+func TestLobbyManager_JoinOrSpectate(t *testing.T) {
+	var spectatorMsgs int
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster: func(userID string, message interface{}) {
+			if userID == "watcher" {
+				spectatorMsgs++
+			}
+		},
+	})
+	lobby, _ := manager.CreateLobbyWithOptions("Arena", 1, true, nil, "player1", LobbyOptions{MaxSpectators: 1})
+
+	if spectating, err := manager.JoinOrSpectate(lobby.ID, &Player{ID: "player1", Username: "Alice"}); err != nil || spectating {
+		t.Fatalf("Expected a seat while there is room: spectating=%v err=%v", spectating, err)
+	}
+	if spectating, err := manager.JoinOrSpectate(lobby.ID, &Player{ID: "watcher", Username: "Bob"}); err != nil || !spectating {
+		t.Fatalf("Expected fallback to spectating: spectating=%v err=%v", spectating, err)
+	}
+	if len(lobby.Players) != 1 || len(lobby.Spectators) != 1 {
+		t.Fatalf("Expected 1 player and 1 spectator, got %d and %d", len(lobby.Players), len(lobby.Spectators))
+	}
+
+	_, err := manager.JoinOrSpectate(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeSpectatorsFull {
+		t.Fatalf("Expected SPECTATORS_FULL, got %v", err)
+	}
+
+	spectatorMsgs = 0
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	if spectatorMsgs != 1 {
+		t.Errorf("Expected spectator to receive the lobby_state broadcast, got %d", spectatorMsgs)
+	}
+	if err := manager.LeaveLobby(lobby.ID, "watcher"); err != nil || len(lobby.Spectators) != 0 {
+		t.Errorf("Expected spectator to leave: err=%v spectators=%d", err, len(lobby.Spectators))
+	}
+}
+
+func TestLobbyManager_SpectatorCannotTakeSeat(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobbyWithOptions("Arena", 2, true, nil, "player1", LobbyOptions{MaxSpectators: 1})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinAsSpectator(lobby.ID, &Player{ID: "watcher", Username: "Bob"})
+
+	err := manager.JoinLobby(lobby.ID, &Player{ID: "watcher", Username: "Bob"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodePlayerAlreadyInLobby {
+		t.Fatalf("Expected PLAYER_ALREADY_IN_LOBBY for a spectator taking a seat, got %v", err)
+	}
+	if len(lobby.Players) != 1 || len(lobby.Spectators) != 1 {
+		t.Fatalf("Expected 1 player and 1 spectator, got %d and %d", len(lobby.Players), len(lobby.Spectators))
+	}
+
+	manager.LeaveLobby(lobby.ID, "watcher")
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "watcher", Username: "Bob"}); err != nil {
+		t.Errorf("Expected a seat once the spectator has left, got %v", err)
+	}
+}
+
+func TestLobbyManager_CreateLobbyRandomIDs(t *testing.T) {
+	manager := NewLobbyManager()
+	first, err := manager.CreateLobby("Arena", 4, true, nil, "owner1")
+	if err != nil {
+		t.Fatalf("CreateLobby failed: %v", err)
+	}
+	second, err := manager.CreateLobby("Arena", 4, true, nil, "owner2")
+	if err != nil {
+		t.Fatalf("Expected a second lobby named Arena: %v", err)
+	}
+	if first.ID == second.ID || first.ID == "Arena" || second.Name != "Arena" {
+		t.Fatalf("Expected distinct opaque IDs with the name kept, got %q and %q", first.ID, second.ID)
+	}
+	if got, ok := manager.GetLobbyByID(second.ID); !ok || got != second {
+		t.Error("Expected GetLobbyByID to find the lobby by its ID")
+	}
+
+	// A true ID collision is still rejected
+	manager.Rand = strings.NewReader(strings.Repeat("\x00", 16))
+	manager.CreateLobby("Zero", 4, true, nil, "owner3")
+	_, err = manager.CreateLobby("Zero Again", 4, true, nil, "owner4")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyAlreadyExists {
+		t.Errorf("Expected %s on ID collision, got %v", ErrorCodeLobbyAlreadyExists, err)
+	}
+
+	// The reader is now drained, so no ID can be generated
+	_, err = manager.CreateLobby("Drained", 4, true, nil, "owner5")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInternalError {
+		t.Errorf("Expected %s when the randomness source fails, got %v", ErrorCodeInternalError, err)
+	}
+}
+
+func TestLobbyManager_TeamCapacity(t *testing.T) {
+	manager := NewLobbyManager()
+	// Two teams of two hold four players, fewer than MaxPlayers
+	lobby, _ := manager.CreateLobbyWithOptions("Teams", 6, true, nil, "p1", LobbyOptions{TeamCount: 2, MaxPerTeam: 2})
+	for i := 1; i <= 4; i++ {
+		if err := manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("p%d", i))}); err != nil {
+			t.Fatalf("Join %d failed: %v", i, err)
+		}
+	}
+	if remaining, _ := manager.RemainingCapacity(lobby.ID); remaining != 0 {
+		t.Errorf("Expected no remaining capacity once teams are full, got %d", remaining)
+	}
+	err := manager.JoinLobby(lobby.ID, &Player{ID: "p5"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeTeamFull {
+		t.Fatalf("Expected TEAM_FULL under MaxPlayers, got %v", err)
+	}
+
+	// MaxPlayers still applies when teams have room
+	small, _ := manager.CreateLobbyWithOptions("Small", 2, true, nil, "q1", LobbyOptions{TeamCount: 2, MaxPerTeam: 3})
+	manager.JoinLobby(small.ID, &Player{ID: "q1"})
+	manager.JoinLobby(small.ID, &Player{ID: "q2"})
+	err = manager.JoinLobby(small.ID, &Player{ID: "q3"})
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyFull {
+		t.Fatalf("Expected LOBBY_FULL with room on the teams, got %v", err)
+	}
+}
+
+func TestLobbyManager_SetPlayerTeam(t *testing.T) {
+	manager := NewLobbyManager()
+	// Joins alternate teams: p1 and p3 on team 1, p2 on team 2
+	lobby, _ := manager.CreateLobbyWithOptions("Teams", 4, true, nil, "p1", LobbyOptions{TeamCount: 2, MaxPerTeam: 2})
+	for i := 1; i <= 3; i++ {
+		manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("p%d", i))})
+	}
+
+	err := manager.SetPlayerTeam(lobby.ID, "p2", 1)
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeTeamFull {
+		t.Fatalf("Expected TEAM_FULL moving onto a full team, got %v", err)
+	}
+	if err := manager.SetPlayerTeam(lobby.ID, "p1", 2); err != nil {
+		t.Fatalf("SetPlayerTeam failed: %v", err)
+	}
+	if got, want := lobby.TeamBalance(), map[int]int{1: 1, 2: 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected balance %v, got %v", want, got)
+	}
+	if err := manager.SetPlayerTeam(lobby.ID, "p1", 2); err != nil {
+		t.Errorf("Expected staying on the same full team to be a no-op, got %v", err)
+	}
+
+	for _, team := range []int{0, 3} {
+		err := manager.SetPlayerTeam(lobby.ID, "p3", team)
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInvalidRequest {
+			t.Errorf("Expected INVALID_REQUEST for team %d, got %v", team, err)
+		}
+	}
+	if err := manager.SetPlayerTeam(lobby.ID, "p9", 1); err == nil {
+		t.Error("Expected a non-member to be rejected")
+	}
+
+	noTeams, _ := manager.CreateLobby("No Teams", 4, true, nil, "q1")
+	manager.JoinLobby(noTeams.ID, &Player{ID: "q1"})
+	if err := manager.SetPlayerTeam(noTeams.ID, "q1", 1); err == nil {
+		t.Error("Expected SetPlayerTeam to fail in a lobby without teams")
+	}
+	if balance := noTeams.TeamBalance(); len(balance) != 0 {
+		t.Errorf("Expected an empty balance without teams, got %v", balance)
+	}
+}
+
+func TestLobbyManager_ShuffleTeams(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobbyWithOptions("Teams", 5, true, nil, "p1", LobbyOptions{TeamCount: 2, MaxPerTeam: 3})
+	for i := 1; i <= 5; i++ {
+		manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(fmt.Sprintf("p%d", i))})
+	}
+
+	if err := manager.ShuffleTeams(lobby.ID, "p2"); err == nil {
+		t.Fatal("Expected a non-owner shuffle to be rejected")
+	}
+
+	manager.Rand = rand.New(rand.NewSource(1))
+	if err := manager.ShuffleTeams(lobby.ID, "p1"); err != nil {
+		t.Fatalf("ShuffleTeams failed: %v", err)
+	}
+	got := make(map[PlayerID]int)
+	sizes := make(map[int]int)
+	for _, p := range lobby.Players {
+		got[p.ID] = p.Team
+		sizes[p.Team]++
+	}
+	want := map[PlayerID]int{"p1": 1, "p2": 2, "p3": 1, "p4": 1, "p5": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected seeded shuffle %v, got %v", want, got)
+	}
+	for team := 1; team <= 2; team++ {
+		if sizes[team] < 2 || sizes[team] > 3 {
+			t.Errorf("Expected team %d to hold 2-3 players, got %d", team, sizes[team])
+		}
+	}
+}
+
+func TestLobbyManager_MinListingAgeAndPlayers(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.MinListingAge = 20 * time.Millisecond
+	manager.MinListingPlayers = 1
+	lobby, _ := manager.CreateLobby("Fresh", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	empty, _ := manager.CreateLobby("Empty", 4, true, nil, "player2")
+
+	if got := len(manager.ListLobbies()); got != 0 {
+		t.Fatalf("Expected young lobbies hidden, got %d", got)
+	}
+	if _, ok := manager.GetLobbyByID(lobby.ID); !ok {
+		t.Error("Expected a hidden lobby to stay reachable by ID")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	listed := manager.ListLobbies()
+	if len(listed) != 1 || listed[0].ID != lobby.ID {
+		t.Fatalf("Expected only the populated lobby listed after the threshold, got %v", listed)
+	}
+
+	manager.JoinLobby(empty.ID, &Player{ID: "player2", Username: "Bob"})
+	if got := len(manager.ListLobbies()); got != 2 {
+		t.Errorf("Expected lobby listed once it has players, got %d", got)
+	}
+}
+
+func TestLobbyManager_ConcurrentDistinctLobbies(t *testing.T) {
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Counters: &EventCounters{}})
+	const lobbies = 50
+	const playersPerLobby = 4
+	ids := make([]LobbyID, lobbies)
+	for i := range ids {
+		lobby, _ := manager.CreateLobbyWithOptions(fmt.Sprintf("Lobby %d", i), playersPerLobby, true, nil, "", LobbyOptions{PersistWhenEmpty: true})
+		ids[i] = lobby.ID
+	}
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		for j := 0; j < playersPerLobby; j++ {
+			wg.Add(1)
+			go func(id LobbyID, playerID PlayerID) {
+				defer wg.Done()
+				for round := 0; round < 10; round++ {
+					if err := manager.JoinLobby(id, &Player{ID: playerID}); err != nil {
+						t.Errorf("JoinLobby %s failed: %v", playerID, err)
+						return
+					}
+					manager.SetPlayerReady(id, playerID, true)
+					if err := manager.LeaveLobby(id, playerID); err != nil {
+						t.Errorf("LeaveLobby %s failed: %v", playerID, err)
+						return
+					}
+				}
+			}(id, PlayerID(fmt.Sprintf("p%d-%d", i, j)))
+		}
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		lobby, ok := manager.GetLobbyByID(id)
+		if !ok || len(lobby.Players) != 0 {
+			t.Fatalf("Expected lobby %s to persist empty", id)
+		}
+	}
+	if len(manager.AllPlayers()) != 0 {
+		t.Error("Expected no memberships left")
+	}
+	counts := manager.Events.Counters.Snapshot()
+	if want := int64(lobbies * playersPerLobby * 10); counts["joins"] != want || counts["leaves"] != want {
+		t.Errorf("Expected %d joins and leaves, got %v", want, counts)
+	}
+}
+
+func TestLobbyManager_ConcurrentLastLeaveDeletes(t *testing.T) {
+	manager := NewLobbyManager()
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			playerID := PlayerID(fmt.Sprintf("p%d", i))
+			lobby, err := manager.CreateLobby(fmt.Sprintf("Lobby %d", i), 2, true, nil, string(playerID))
+			if err != nil {
+				t.Errorf("CreateLobby failed: %v", err)
+				return
+			}
+			manager.JoinLobby(lobby.ID, &Player{ID: playerID})
+			manager.LeaveLobby(lobby.ID, playerID)
+		}(i)
+	}
+	wg.Wait()
+	if got := len(manager.ListLobbies()); got != 0 {
+		t.Errorf("Expected every abandoned lobby deleted, got %d left", got)
+	}
+}
+
+func TestLobbyManager_ReassignPlayerIDKeepsSeat(t *testing.T) {
+	sessions := NewSessionManager()
+	sessions.RotateIDOnReconnect = true
+	manager := NewLobbyManager()
+	manager.DisconnectGrace = time.Minute
+	sessions.OnSessionIDChanged = func(oldID string, session *UserSession) {
+		if err := manager.ReassignPlayerID(PlayerID(oldID), PlayerID(session.ID)); err != nil {
+			t.Errorf("ReassignPlayerID failed: %v", err)
+		}
+	}
+
+	alice := sessions.CreateSession("alice")
+	oldID := alice.ID
+	lobby, _ := manager.CreateLobby("Test Lobby", 2, true, nil, oldID)
+	manager.JoinLobby(lobby.ID, &Player{ID: PlayerID(oldID), Username: "alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "bob", Username: "bob"})
+	manager.AddModerator(lobby.ID, oldID, "bob")
+
+	sessions.RemoveSession(oldID)
+	reconnected, ok := sessions.ReconnectSession("alice", alice.Token)
+	if !ok {
+		t.Fatal("Expected reconnect to succeed")
+	}
+	newID := PlayerID(reconnected.ID)
+
+	if lobby.Players[0].ID != newID {
+		t.Errorf("Expected alice's seat to carry the new ID %s, got %s", newID, lobby.Players[0].ID)
+	}
+	if lobby.OwnerID != string(newID) {
+		t.Errorf("Expected ownership to follow the new ID, got %s", lobby.OwnerID)
+	}
+	if manager.membershipCount(PlayerID(oldID)) != 0 || manager.membershipCount(newID) != 1 {
+		t.Error("Expected the membership index to move to the new ID")
+	}
+	if err := manager.LeaveLobby(lobby.ID, PlayerID(oldID)); err == nil {
+		t.Error("Old ID should no longer be in the lobby")
+	}
+
+	// A held seat follows the player too
+	manager.DisconnectPlayer(lobby.ID, newID)
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "carol", Username: "carol"}); err == nil {
+		t.Fatal("Expected the held seat to keep the lobby full")
+	}
+	if err := manager.ReassignPlayerID(newID, "alice-2"); err != nil {
+		t.Fatalf("ReassignPlayerID failed: %v", err)
+	}
+	if err := manager.JoinLobby(lobby.ID, &Player{ID: "alice-2", Username: "alice"}); err != nil {
+		t.Errorf("Expected the held seat to admit the new ID, got %v", err)
+	}
+}
+
+func TestLobbyManager_LockReadyState(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+
+	if err := manager.LockReadyState(lobby.ID, "player2", true); err == nil {
+		t.Fatal("Expected a lock by a non-moderator to be rejected")
+	}
+	manager.AddModerator(lobby.ID, "player1", "player2")
+	if err := manager.LockReadyState(lobby.ID, "player2", true); err != nil {
+		t.Fatalf("Expected a moderator to lock ready status, got %v", err)
+	}
+	if err := manager.LockReadyState(lobby.ID, "player1", true); err != nil {
+		t.Fatalf("LockReadyState failed: %v", err)
+	}
+
+	for _, change := range []struct {
+		playerID PlayerID
+		ready    bool
+	}{{"player1", false}, {"player2", true}} {
+		err := manager.SetPlayerReady(lobby.ID, change.playerID, change.ready)
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyLocked {
+			t.Errorf("Expected LOBBY_LOCKED for %s, got %v", change.playerID, err)
+		}
+	}
+	if !lobby.Players[0].Ready || lobby.Players[1].Ready {
+		t.Error("Ready status should not change while locked")
+	}
+
+	manager.LockReadyState(lobby.ID, "player1", false)
+	if err := manager.SetPlayerReady(lobby.ID, "player2", true); err != nil {
+		t.Errorf("Expected ready change after unlock, got %v", err)
+	}
+}
+
+func TestLobbyManager_StateTransitionSideEffects(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	var changes []LobbyState
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		Broadcaster:        rec.broadcast,
+		OnLobbyStateChange: func(l *Lobby) { changes = append(changes, l.State) },
+	})
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+	manager.LockReadyState(lobby.ID, "player1", true)
+
+	gameStarted := func() bool {
+		for _, msg := range rec.received("player2") {
+			if _, ok := msg.(GameStartedResponse); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	steps := []struct {
+		state       LobbyState
+		wantStarted bool // game_started sent
+		wantReady   bool // ready flags survive
+	}{
+		{LobbyInGame, true, true},
+		{LobbyFinished, false, true},
+		{LobbyWaiting, false, false},
+	}
+	for _, step := range steps {
+		rec.reset()
+		changes = nil
+		if err := manager.SetLobbyState(lobby.ID, step.state); err != nil {
+			t.Fatalf("SetLobbyState(%s) failed: %v", lobbyStateString(step.state), err)
+		}
+		name := lobbyStateString(step.state)
+		if len(changes) != 1 || changes[0] != step.state {
+			t.Errorf("%s: expected one OnLobbyStateChange, got %v", name, changes)
+		}
+		if gameStarted() != step.wantStarted {
+			t.Errorf("%s: expected game_started sent=%v", name, step.wantStarted)
+		}
+		if reason := lastReason(t, rec, "player2"); reason != ReasonStateChanged {
+			t.Errorf("%s: expected reason %q, got %q", name, ReasonStateChanged, reason)
+		}
+		if lobby.Players[1].Ready != step.wantReady {
+			t.Errorf("%s: expected ready=%v, got %v", name, step.wantReady, lobby.Players[1].Ready)
+		}
+	}
+	if !lobby.StartedAt.IsZero() || lobby.ReadyLocked {
+		t.Error("Returning to waiting should clear StartedAt and the ready lock")
+	}
+
+	// StartGame goes through the same transition
+	manager.SetPlayerReady(lobby.ID, "player1", true)
+	manager.SetPlayerReady(lobby.ID, "player2", true)
+	rec.reset()
+	if err := manager.StartGame(lobby.ID, "player1"); err != nil {
+		t.Fatalf("StartGame failed: %v", err)
+	}
+	if !gameStarted() || lobby.StartedAt.IsZero() {
+		t.Error("StartGame should send game_started and stamp StartedAt")
+	}
+}
+
+func TestLobbyManager_FindLobbies(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.CreateLobby("Ranked Arena", 2, true, map[string]interface{}{"mode": "ctf", "map": "dust"}, "p1")
+	casual, _ := manager.CreateLobby("Casual Arena", 2, true, map[string]interface{}{"mode": "ctf"}, "p2")
+	manager.CreateLobby("Private Arena", 4, false, map[string]interface{}{"mode": "ctf"}, "p3")
+	manager.JoinLobby(casual.ID, &Player{ID: "p2"})
+	manager.JoinLobby(casual.ID, &Player{ID: "p4"})
+	waiting := LobbyWaiting
+	inGame := LobbyInGame
+
+	names := func(lobbies []*Lobby) []string {
+		var got []string
+		for _, l := range lobbies {
+			got = append(got, l.Name)
+		}
+		sort.Strings(got)
+		return got
+	}
+	cases := []struct {
+		name   string
+		filter LobbyFilter
+		want   []string
+	}{
+		{"everything", LobbyFilter{}, []string{"Casual Arena", "Private Arena", "Ranked Arena"}},
+		{"public and not full", LobbyFilter{PublicOnly: true, NotFull: true}, []string{"Ranked Arena"}},
+		{"name and state", LobbyFilter{NameContains: "arena", State: &waiting}, []string{"Casual Arena", "Private Arena", "Ranked Arena"}},
+		{"metadata", LobbyFilter{MetadataMatch: map[string]interface{}{"mode": "ctf", "map": "dust"}}, []string{"Ranked Arena"}},
+		{"metadata and public", LobbyFilter{PublicOnly: true, MetadataMatch: map[string]interface{}{"mode": "ctf"}, NameContains: "PRIVATE"}, nil},
+		{"no state match", LobbyFilter{State: &inGame}, nil},
+	}
+	for _, c := range cases {
+		if got := names(manager.FindLobbies(c.filter)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestLobbyManager_MaxConcurrentGames(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.MaxConcurrentGames = 1
+	first, _ := manager.CreateLobby("First", 4, true, nil, "p1")
+	second, _ := manager.CreateLobby("Second", 4, true, nil, "p2")
+	manager.JoinLobby(first.ID, &Player{ID: "p1"})
+	manager.JoinLobby(second.ID, &Player{ID: "p2"})
+
+	if err := manager.StartGame(first.ID, "p1"); err != nil {
+		t.Fatalf("StartGame failed: %v", err)
+	}
+	err := manager.StartGame(second.ID, "p2")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeServiceUnavailable {
+		t.Fatalf("Expected SERVICE_UNAVAILABLE at the cap, got %v", err)
+	}
+	if second.State != LobbyWaiting || manager.GamesInProgress() != 1 {
+		t.Errorf("Expected the refused lobby to stay waiting with 1 game running, got state %v and %d games", second.State, manager.GamesInProgress())
+	}
+
+	manager.SetLobbyState(first.ID, LobbyFinished)
+	if err := manager.StartGame(second.ID, "p2"); err != nil {
+		t.Fatalf("Expected the start to succeed once the first game ended, got %v", err)
+	}
+
+	// Deleting an in-game lobby frees its slot too
+	manager.LeaveLobby(second.ID, "p2")
+	if manager.GamesInProgress() != 0 {
+		t.Errorf("Expected no games in progress, got %d", manager.GamesInProgress())
+	}
+}
+
+func TestLobbyManager_MovePlayer(t *testing.T) {
+	var events []string
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{
+		OnPlayerJoin:  func(l *Lobby, p *Player) { events = append(events, "join "+l.Name) },
+		OnPlayerLeave: func(l *Lobby, p *Player) { events = append(events, "leave "+l.Name) },
+	})
+	source, _ := manager.CreateLobby("Source", 4, true, nil, "p1")
+	full, _ := manager.CreateLobby("Full", 1, true, nil, "p3")
+	open, _ := manager.CreateLobby("Open", 4, true, nil, "p4")
+	manager.JoinLobby(source.ID, &Player{ID: "p1", Username: "Alice"})
+	manager.JoinLobby(source.ID, &Player{ID: "p2", Username: "Bob"})
+	manager.JoinLobby(full.ID, &Player{ID: "p3"})
+	manager.JoinLobby(open.ID, &Player{ID: "p4"})
+	manager.SetPlayerReady(source.ID, "p1", true)
+	events = nil
+
+	err := manager.MovePlayer(source.ID, full.ID, "p1")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyFull {
+		t.Fatalf("Expected LOBBY_FULL moving into a full lobby, got %v", err)
+	}
+	if findPlayer(source, "p1") == nil || len(events) != 0 {
+		t.Fatalf("Expected the player to stay put without events, got events %v", events)
+	}
+	if err := manager.JoinLobby(open.ID, &Player{ID: "p1"}); err == nil {
+		t.Error("Expected the source membership to still count after a failed move")
+	}
+
+	if err := manager.MovePlayer(source.ID, open.ID, "p1"); err != nil {
+		t.Fatalf("MovePlayer failed: %v", err)
+	}
+	if want := []string{"leave Source", "join Open"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+	moved := findPlayer(open, "p1")
+	if findPlayer(source, "p1") != nil || moved == nil || moved.Username != "Alice" || moved.Ready {
+		t.Errorf("Expected Alice to arrive unready in the destination only, got %+v", moved)
+	}
+	if source.OwnerID != "p2" {
+		t.Errorf("Expected ownership of the source to pass to p2, got %s", source.OwnerID)
+	}
+
+	if err := manager.MovePlayer(source.ID, open.ID, "p9"); err == nil {
+		t.Error("Expected moving a non-member to fail")
+	}
+}
+
+func TestLobbyManager_RematchLobby(t *testing.T) {
+	rec := newRecordingBroadcaster()
+	manager := NewLobbyManagerWithEvents(&LobbyEvents{Broadcaster: rec.broadcast})
+	manager.RequireUniqueNames = true
+	manager.RematchSpectators = true
+	old, _ := manager.CreateLobbyWithOptions("Finals", 4, true, map[string]interface{}{"map": "dust"}, "p1",
+		LobbyOptions{TeamCount: 2, MaxPerTeam: 2, MaxSpectators: 1})
+	for i := 1; i <= 4; i++ {
+		manager.JoinLobby(old.ID, &Player{ID: PlayerID(fmt.Sprintf("p%d", i))})
+	}
+	manager.JoinAsSpectator(old.ID, &Player{ID: "watcher"})
+	manager.SetPlayerReady(old.ID, "p1", true)
+	manager.StartGame(old.ID, "p1")
+	teams := make(map[PlayerID]int)
+	for _, p := range old.Players {
+		teams[p.ID] = p.Team
+	}
+
+	if _, err := manager.RematchLobby(old.ID, "p2"); err == nil {
+		t.Fatal("Expected a non-owner rematch to be rejected")
+	}
+	lobby, err := manager.RematchLobby(old.ID, "p1")
+	if err != nil {
+		t.Fatalf("RematchLobby failed: %v", err)
+	}
+
+	if _, exists := manager.GetLobbyByID(old.ID); exists {
+		t.Error("Expected the old lobby to be deleted")
+	}
+	if lobby.State != LobbyWaiting || lobby.Name != "Finals" || lobby.Metadata["map"] != "dust" || lobby.OwnerID != "p1" {
+		t.Errorf("Expected a waiting copy of the old lobby, got %+v", lobby)
+	}
+	got := make(map[PlayerID]int)
+	for _, p := range lobby.Players {
+		got[p.ID] = p.Team
+		if p.Ready {
+			t.Errorf("Expected %s to arrive unready", p.ID)
+		}
+	}
+	if !reflect.DeepEqual(got, teams) {
+		t.Errorf("Expected teams %v to be kept, got %v", teams, got)
+	}
+	if len(lobby.Spectators) != 1 || manager.GamesInProgress() != 0 {
+		t.Errorf("Expected the spectator along and no game running, got %d spectators and %d games", len(lobby.Spectators), manager.GamesInProgress())
+	}
+	for _, id := range []string{"p3", "watcher"} {
+		var rematch *RematchResponse
+		for _, msg := range rec.received(id) {
+			if resp, ok := msg.(RematchResponse); ok {
+				rematch = &resp
+			}
+		}
+		if rematch == nil || rematch.NewLobbyID != string(lobby.ID) {
+			t.Errorf("Expected %s to be told about the new lobby, got %v", id, rematch)
+		}
+	}
+	if err := manager.LeaveLobby(lobby.ID, "p4"); err != nil || manager.membershipCount("p4") != 0 {
+		t.Errorf("Expected memberships to follow players to the new lobby: %v", err)
+	}
+}
+
+func TestLobbyManager_ListLobbiesPaged(t *testing.T) {
+	manager := NewLobbyManager()
+	for i := 0; i < 5; i++ {
+		manager.CreateLobby(fmt.Sprintf("Lobby %d", i), 4, true, nil, "owner")
+	}
+
+	all, total := manager.ListLobbiesPaged(0, 10)
+	if total != 5 || len(all) != 5 {
+		t.Fatalf("Expected all 5 lobbies, got %d of %d", len(all), total)
+	}
+	for i := 1; i < len(all); i++ {
+		prev, cur := all[i-1], all[i]
+		if cur.CreatedAt.Before(prev.CreatedAt) || (cur.CreatedAt.Equal(prev.CreatedAt) && cur.ID < prev.ID) {
+			t.Fatalf("Lobbies not ordered by creation time then ID at %d", i)
+		}
+	}
+
+	var paged []*Lobby
+	for offset := 0; offset < total; offset += 2 {
+		page, _ := manager.ListLobbiesPaged(offset, 2)
+		paged = append(paged, page...)
+	}
+	if !reflect.DeepEqual(paged, all) {
+		t.Error("Expected consecutive pages to cover every lobby once, in order")
+	}
+
+	if page, _ := manager.ListLobbiesPaged(-3, 0); len(page) != 5 || page[0].ID != all[0].ID {
+		t.Errorf("Expected a negative offset and zero limit to return the default first page, got %d lobbies", len(page))
+	}
+	if page, total := manager.ListLobbiesPaged(10, 2); len(page) != 0 || total != 5 {
+		t.Errorf("Expected an empty page past the end with total 5, got %d lobbies of %d", len(page), total)
+	}
+}
+
+func TestLobbyManager_GetLobbyByNameInsensitive(t *testing.T) {
+	manager := NewLobbyManager()
+	friday, _ := manager.CreateLobby("Friday Night", 4, true, nil, "owner1")
+
+	for _, name := range []string{"Friday Night", "friday night", "FRIDAY NIGHT", "  Friday   Night\t"} {
+		lobby, err := manager.GetLobbyByNameInsensitive(name)
+		if err != nil || lobby.ID != friday.ID {
+			t.Errorf("Expected %q to find %s, got %v", name, friday.ID, err)
+		}
+	}
+	for _, name := range []string{"Friday", "FridayNight", "   "} {
+		if _, err := manager.GetLobbyByNameInsensitive(name); err == nil {
+			t.Errorf("Expected %q not to match", name)
+		} else if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeLobbyNotFound {
+			t.Errorf("Expected LOBBY_NOT_FOUND for %q, got %v", name, err)
+		}
+	}
+
+	// Names differing only in case are distinct lobbies, so the lookup must not pick one
+	_, _ = manager.CreateLobby("FRIDAY night", 4, true, nil, "owner2")
+	_, err := manager.GetLobbyByNameInsensitive("friday night")
+	lobbyErr, ok := err.(*LobbyError)
+	if !ok || lobbyErr.Code != ErrorCodeLobbyNotFound {
+		t.Fatalf("Expected LOBBY_NOT_FOUND for an ambiguous name, got %v", err)
+	}
+	if !strings.Contains(lobbyErr.Details, "matches 2 lobbies") {
+		t.Errorf("Expected details to report the ambiguity, got %q", lobbyErr.Details)
+	}
+}
+
+func TestLobbyManager_MutePlayer(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "owner1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "mod", Username: "Bob"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	manager.AddModerator(lobby.ID, "owner1", "mod")
+
+	expectCode := func(err error, code ErrorCode) {
+		t.Helper()
+		if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != code {
+			t.Errorf("Expected %s, got %v", code, err)
+		}
+	}
+	expectCode(manager.MutePlayer(lobby.ID, "player3", "mod", time.Minute), ErrorCodeUnauthorized)
+	expectCode(manager.MutePlayer(lobby.ID, "mod", "owner1", time.Minute), ErrorCodeUnauthorized)
+
+	if err := manager.MutePlayer(lobby.ID, "mod", "player3", time.Minute); err != nil {
+		t.Fatalf("MutePlayer failed: %v", err)
+	}
+	expectCode(manager.SendChatMessage(lobby.ID, "player3", "hello?"), ErrorCodeUnauthorized)
+	if err := manager.SendChatMessage(lobby.ID, "mod", "behave"); err != nil {
+		t.Errorf("Unmuted players should still chat, got %v", err)
+	}
+
+	// Leaving and rejoining does not shake off the mute
+	manager.LeaveLobby(lobby.ID, "player3")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player3", Username: "Carol"})
+	expectCode(manager.SendChatMessage(lobby.ID, "player3", "hello?"), ErrorCodeUnauthorized)
+
+	// Simulate the mute running out
+	manager.mu.Lock()
+	lobby.mutedInChat["player3"] = time.Now().Add(-time.Second)
+	manager.mu.Unlock()
+	if err := manager.SendChatMessage(lobby.ID, "player3", "sorry"); err != nil {
+		t.Errorf("Expected the mute to expire, got %v", err)
+	}
+
+	manager.MutePlayer(lobby.ID, "owner1", "player3", time.Hour)
+	if err := manager.UnmutePlayer(lobby.ID, "mod", "player3"); err != nil {
+		t.Fatalf("UnmutePlayer failed: %v", err)
+	}
+	if err := manager.SendChatMessage(lobby.ID, "player3", "thanks"); err != nil {
+		t.Errorf("Expected unmuted player to chat, got %v", err)
+	}
+}
+
+func TestLobbyManager_ChatRateLimit(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.ChatRateLimit = 2
+	manager.ChatRateWindow = time.Minute
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	for _, text := range []string{"one", "two"} {
+		if err := manager.SendChatMessage(lobby.ID, "player1", text); err != nil {
+			t.Fatalf("Messages within the limit should be sent, got %v", err)
+		}
+	}
+	err := manager.SendChatMessage(lobby.ID, "player1", "three")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeRateLimited {
+		t.Fatalf("Expected RATE_LIMITED over the limit, got %v", err)
+	}
+	if err := manager.SendChatMessage(lobby.ID, "player2", "hi"); err != nil {
+		t.Errorf("The limit is per player, got %v", err)
+	}
+	if history, _ := manager.ChatHistory(lobby.ID); len(history) != 3 {
+		t.Errorf("Refused messages should not reach the history, got %d messages", len(history))
+	}
+
+	// Simulate the window passing
+	manager.mu.Lock()
+	for i := range lobby.chatSent["player1"] {
+		lobby.chatSent["player1"][i] = time.Now().Add(-2 * time.Minute)
+	}
+	manager.mu.Unlock()
+	if err := manager.SendChatMessage(lobby.ID, "player1", "three"); err != nil {
+		t.Errorf("Expected the limit to reset after the window, got %v", err)
+	}
+}
+
+func TestLobbyManager_ChatHistory(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.MaxChatHistory = 3
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "player1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "player1", Username: "Alice"})
+
+	for i := 1; i <= 5; i++ {
+		manager.SendChatMessage(lobby.ID, "player1", fmt.Sprintf("msg%d", i))
+	}
+	history, err := manager.ChatHistory(lobby.ID)
+	if err != nil {
+		t.Fatalf("ChatHistory failed: %v", err)
+	}
+	var texts []string
+	for _, msg := range history {
+		texts = append(texts, msg.Text)
+	}
+	if want := []string{"msg3", "msg4", "msg5"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("Expected the oldest messages dropped, leaving %v, got %v", want, texts)
+	}
+
+	manager.MaxChatHistory = -1
+	other, _ := manager.CreateLobby("Quiet", 4, true, nil, "player2")
+	manager.JoinLobby(other.ID, &Player{ID: "player2", Username: "Bob"})
+	manager.SendChatMessage(other.ID, "player2", "hello")
+	if history, _ := manager.ChatHistory(other.ID); len(history) != 0 {
+		t.Errorf("A negative MaxChatHistory should keep nothing, got %v", history)
+	}
+	if _, err := manager.ChatHistory("missing"); err == nil {
+		t.Error("Expected an error for an unknown lobby")
+	}
+}
+
+func TestLobbyManager_FindNearestLobbies(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.RegionAdjacency = map[string][]string{
+		"eu-west":    {"eu-central"},
+		"eu-central": {"eu-east"},
+		"us-east":    {"us-west"},
+	}
+	create := func(name, region string, public bool) *Lobby {
+		t.Helper()
+		lobby, err := manager.CreateLobbyWithOptions(name, 2, public, nil, "owner", LobbyOptions{Region: region})
+		if err != nil {
+			t.Fatalf("CreateLobby failed: %v", err)
+		}
+		return lobby
+	}
+	east := create("East", "eu-east", true)
+	central := create("Central", "eu-central", true)
+	west := create("West", "eu-west", true)
+	create("Private", "eu-west", false)
+	create("US", "us-east", true)
+	full := create("Full", "eu-west", true)
+	manager.JoinLobby(full.ID, &Player{ID: "p1", Username: "p1"})
+	manager.JoinLobby(full.ID, &Player{ID: "p2", Username: "p2"})
+
+	names := func(lobbies []*Lobby) []string {
+		out := make([]string, len(lobbies))
+		for i, l := range lobbies {
+			out[i] = l.Name
+		}
+		return out
+	}
+	got := manager.FindNearestLobbies("eu-west", 0)
+	if len(got) != 3 || got[0].ID != west.ID || got[1].ID != central.ID || got[2].ID != east.ID {
+		t.Errorf("Expected West, Central, East, got %v", names(got))
+	}
+	if got := manager.FindNearestLobbies("eu-west", 2); len(got) != 2 || got[1].ID != central.ID {
+		t.Errorf("Expected the two nearest, got %v", names(got))
+	}
+	// Adjacency works both ways
+	if got := manager.FindNearestLobbies("eu-east", 1); len(got) != 1 || got[0].ID != east.ID {
+		t.Errorf("Expected East first from eu-east, got %v", names(got))
+	}
+	if got := manager.FindNearestLobbies("us-west", 0); len(got) != 1 || got[0].Name != "US" {
+		t.Errorf("Expected only the US lobby from us-west, got %v", names(got))
+	}
+
+	// A custom distance replaces the adjacency map
+	manager.RegionDistance = func(from, to string) int {
+		if to == "us-east" {
+			return 0
+		}
+		return 1
+	}
+	if got := manager.FindNearestLobbies("eu-west", 0); len(got) != 4 || got[0].Name != "US" {
+		t.Errorf("Expected the custom distance to put US first, got %v", names(got))
+	}
+}
+
+func TestLobbyManager_LastPlayerGrace(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.LastPlayerGrace = time.Hour
+
+	// A disconnect holds the solo lobby, and rejoining reclaims it as owner
+	held, _ := manager.CreateLobby("Solo", 1, true, nil, "owner1")
+	manager.JoinLobby(held.ID, &Player{ID: "owner1", Username: "Alice"})
+	if err := manager.DisconnectPlayer(held.ID, "owner1"); err != nil {
+		t.Fatalf("DisconnectPlayer failed: %v", err)
+	}
+	if _, exists := manager.GetLobbyByID(held.ID); !exists {
+		t.Fatal("Expected the lobby to be held after its last player disconnected")
+	}
+	if err := manager.JoinLobby(held.ID, &Player{ID: "other", Username: "Bob"}); err == nil {
+		t.Error("Expected the disconnected player's seat to stay held")
+	}
+	if err := manager.JoinLobby(held.ID, &Player{ID: "owner1", Username: "Alice"}); err != nil {
+		t.Fatalf("Expected the player to reclaim their lobby, got %v", err)
+	}
+	if lobby, _ := manager.GetLobbySnapshot(held.ID); lobby.OwnerID != "owner1" || len(lobby.Players) != 1 {
+		t.Errorf("Expected owner1 back as owner, got owner %q with %d players", lobby.OwnerID, len(lobby.Players))
+	}
+
+	// Once reclaimed, an explicit leave deletes the lobby as usual
+	if err := manager.LeaveLobby(held.ID, "owner1"); err != nil {
+		t.Fatalf("LeaveLobby failed: %v", err)
+	}
+	if _, exists := manager.GetLobbyByID(held.ID); exists {
+		t.Error("Expected an explicit leave to delete the lobby")
+	}
+
+	// A lobby nobody returns to is deleted when the grace ends
+	manager.LastPlayerGrace = 20 * time.Millisecond
+	abandoned, _ := manager.CreateLobby("Abandoned", 2, true, nil, "owner2")
+	manager.JoinLobby(abandoned.ID, &Player{ID: "owner2", Username: "Carol"})
+	manager.DisconnectPlayer(abandoned.ID, "owner2")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, exists := manager.GetLobbyByID(abandoned.ID); !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the held lobby to be deleted after the grace")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLobbyManager_QuickJoin(t *testing.T) {
+	manager := NewLobbyManager()
+	manager.MaxLobbiesPerPlayer = 2
+	ctf := map[string]interface{}{"mode": "ctf"}
+	emptier, _ := manager.CreateLobby("Emptier", 4, true, copyMetadata(ctf), "a")
+	fuller, _ := manager.CreateLobby("Fuller", 4, true, copyMetadata(ctf), "b")
+	full, _ := manager.CreateLobby("Full", 2, true, copyMetadata(ctf), "c")
+	hidden, _ := manager.CreateLobby("Hidden", 4, false, copyMetadata(ctf), "d")
+	other, _ := manager.CreateLobby("Other", 4, true, map[string]interface{}{"mode": "dm"}, "e")
+	manager.JoinLobby(emptier.ID, &Player{ID: "a"})
+	manager.JoinLobby(fuller.ID, &Player{ID: "b"})
+	manager.JoinLobby(fuller.ID, &Player{ID: "b2"})
+	manager.JoinLobby(full.ID, &Player{ID: "c"})
+	manager.JoinLobby(full.ID, &Player{ID: "c2"})
+	manager.JoinLobby(hidden.ID, &Player{ID: "d"})
+	manager.JoinLobby(hidden.ID, &Player{ID: "d2"})
+	manager.JoinLobby(hidden.ID, &Player{ID: "d3"})
+	manager.JoinLobby(other.ID, &Player{ID: "e"})
+	manager.JoinLobby(other.ID, &Player{ID: "e2"})
+	manager.JoinLobby(other.ID, &Player{ID: "e3"})
+
+	lobby, err := manager.QuickJoin(&Player{ID: "q1"}, QuickJoinCriteria{Metadata: ctf})
+	if err != nil {
+		t.Fatalf("QuickJoin failed: %v", err)
+	}
+	if lobby.ID != fuller.ID {
+		t.Errorf("Expected the fullest open matching lobby %s, got %s", fuller.Name, lobby.Name)
+	}
+	if findPlayer(fuller, "q1") == nil {
+		t.Error("Expected the player to be seated in the chosen lobby")
+	}
+
+	if _, err := manager.QuickJoin(&Player{ID: "q2"}, QuickJoinCriteria{Metadata: map[string]interface{}{"mode": "koth"}}); err == nil {
+		t.Fatal("Expected no match for unknown mode")
+	} else if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeNoMatchingLobby {
+		t.Fatalf("Expected NO_MATCHING_LOBBY, got %v", err)
+	}
+
+	created, err := manager.QuickJoin(&Player{ID: "q2"}, QuickJoinCriteria{Metadata: map[string]interface{}{"mode": "koth"}, CreateIfNone: true})
+	if err != nil {
+		t.Fatalf("QuickJoin with CreateIfNone failed: %v", err)
+	}
+	if created.OwnerID != "q2" || !created.Public || created.MaxPlayers != DefaultQuickJoinMaxPlayers || len(created.Players) != 1 {
+		t.Errorf("Unexpected created lobby %+v", created)
+	}
+	if again, _ := manager.QuickJoin(&Player{ID: "q3"}, QuickJoinCriteria{Metadata: map[string]interface{}{"mode": "koth"}}); again == nil || again.ID != created.ID {
+		t.Error("Expected the created lobby to match the same criteria")
+	}
+}
+
+// fakeHasher records its calls and "hashes" by prefixing.
+type fakeHasher struct {
+	hashed   []string
+	verified []string
+}
+
+func (h *fakeHasher) Hash(plain string) (string, error) {
+	h.hashed = append(h.hashed, plain)
+	return "fake:" + plain, nil
+}
+
+func (h *fakeHasher) Verify(hash, plain string) bool {
+	h.verified = append(h.verified, plain)
+	return hash == "fake:"+plain
+}
+
+func TestLobbyManager_Hasher(t *testing.T) {
+	hasher := &fakeHasher{}
+	manager := NewLobbyManager()
+	manager.Hasher = hasher
+
+	hash, err := manager.hashPassword("hunter2")
+	if err != nil || hash != "fake:hunter2" {
+		t.Fatalf("Expected the injected hasher to hash the password, got %q, %v", hash, err)
+	}
+	if !manager.checkPassword(hash, "hunter2") || manager.checkPassword(hash, "hunter3") {
+		t.Error("Expected the injected hasher to check passwords")
+	}
+	if len(hasher.hashed) != 1 || len(hasher.verified) != 2 {
+		t.Errorf("Expected 1 hash and 2 verifies, got %v and %v", hasher.hashed, hasher.verified)
+	}
+	if !manager.checkPassword("", "anything") || len(hasher.verified) != 2 {
+		t.Error("No password set should match without calling the hasher")
+	}
+}
+
+func TestPBKDF2Hasher(t *testing.T) {
+	hasher := PBKDF2Hasher{Iterations: 1000} // Low to keep the test fast
+	hash, err := hasher.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if hash == "hunter2" || !hasher.Verify(hash, "hunter2") {
+		t.Error("Expected a hash that verifies against the password")
+	}
+	if again, _ := hasher.Hash("hunter2"); again == hash {
+		t.Error("Expected a fresh salt for every hash")
+	}
+	if hasher.Verify(hash, "hunter3") || (PBKDF2Hasher{}).Verify("not a hash", "hunter2") {
+		t.Error("Expected wrong passwords and malformed hashes to fail")
+	}
+	if !(PBKDF2Hasher{Iterations: 2000}).Verify(hash, "hunter2") {
+		t.Error("Expected Verify to use the iteration count stored in the hash")
+	}
+}
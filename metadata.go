@@ -0,0 +1,98 @@
+package lobby
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// LobbyValidationConfig caps the size of lobby input. A limit of zero or less is not enforced.
+type LobbyValidationConfig struct {
+	MaxNameLen       int // Characters in the lobby name
+	MaxMetadataBytes int // Size of the lobby metadata encoded as JSON
+	MaxTags          int // Entries in the metadata "tags" list
+}
+
+// validateLobbyInput applies every rule for a lobby's name and metadata: LobbyNameValidator,
+// Validation, MaxMetadataDepth and MaxMetadataElements. CreateLobby and every update path call
+// it so the rules cannot drift apart. Failures are ErrorCodeInvalidRequest.
+func (m *LobbyManager) validateLobbyInput(name string, metadata map[string]interface{}) error {
+	if m.LobbyNameValidator != nil {
+		if err := m.LobbyNameValidator(name); err != nil {
+			return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid lobby name", err.Error())
+		}
+	}
+	limits := m.Validation
+	if limits.MaxNameLen > 0 && utf8.RuneCountInString(name) > limits.MaxNameLen {
+		return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid lobby name",
+			fmt.Sprintf("longer than %d characters", limits.MaxNameLen))
+	}
+	if err := validateMetadata(metadata, m.MaxMetadataDepth, m.MaxMetadataElements); err != nil {
+		return err
+	}
+	if limits.MaxTags > 0 && countTags(metadata["tags"]) > limits.MaxTags {
+		return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid metadata",
+			fmt.Sprintf("more than %d tags", limits.MaxTags))
+	}
+	if limits.MaxMetadataBytes > 0 && metadata != nil {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid metadata", err.Error())
+		}
+		if len(encoded) > limits.MaxMetadataBytes {
+			return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid metadata",
+				fmt.Sprintf("larger than %d bytes", limits.MaxMetadataBytes))
+		}
+	}
+	return nil
+}
+
+// countTags returns the length of a tags list as decoded from JSON or set from Go.
+func countTags(tags interface{}) int {
+	switch v := tags.(type) {
+	case []interface{}:
+		return len(v)
+	case []string:
+		return len(v)
+	default:
+		return 0
+	}
+}
+
+// validateMetadata rejects metadata nested deeper than maxDepth levels or holding more than
+// maxElements values in total, counting map entries and slice items at every level.
+// A limit of zero or less is not enforced.
+func validateMetadata(metadata map[string]interface{}, maxDepth, maxElements int) error {
+	count := 0
+	if err := walkMetadata(metadata, 1, maxDepth, maxElements, &count); err != nil {
+		return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid metadata", err.Error())
+	}
+	return nil
+}
+
+func walkMetadata(value interface{}, depth, maxDepth, maxElements int, count *int) error {
+	var children []interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			children = append(children, child)
+		}
+	case []interface{}:
+		children = v
+	default:
+		return nil
+	}
+	if maxDepth > 0 && depth > maxDepth {
+		return fmt.Errorf("nesting exceeds %d levels", maxDepth)
+	}
+	*count += len(children)
+	if maxElements > 0 && *count > maxElements {
+		return fmt.Errorf("more than %d elements", maxElements)
+	}
+	for _, child := range children {
+		if err := walkMetadata(child, depth+1, maxDepth, maxElements, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package lobby
+
+import "sync/atomic"
+
+// Event kinds tracked by EventCounters, indexing counterNames.
+const (
+	countJoins = iota
+	countLeaves
+	countReadies
+	countStarts
+	countDeletions
+	numCounters
+)
+
+var counterNames = [numCounters]string{"joins", "leaves", "readies", "starts", "deletions"}
+
+// EventCounters counts lobby events for basic metrics. Attach one to LobbyEvents.Counters;
+// it is safe for concurrent use.
+type EventCounters struct {
+	counts [numCounters]int64
+}
+
+// Snapshot returns the current counts keyed by "joins", "leaves", "readies", "starts" and "deletions".
+func (c *EventCounters) Snapshot() map[string]int64 {
+	snapshot := make(map[string]int64, numCounters)
+	for kind, name := range counterNames {
+		snapshot[name] = atomic.LoadInt64(&c.counts[kind])
+	}
+	return snapshot
+}
+
+// incr adds one to the counter for kind. A nil receiver ignores the update.
+func (c *EventCounters) incr(kind int) {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.counts[kind], 1)
+}
+
+// count records an event on the attached EventCounters, if any.
+func (m *LobbyManager) count(kind int) {
+	if m.Events != nil {
+		m.Events.Counters.incr(kind)
+	}
+}
@@ -0,0 +1,49 @@
+package lobby
+
+// MovePlayer moves a player from one lobby to another in a single critical section, so no one
+// can take the last seat in the destination between the leave and the join. The destination
+// is checked exactly as JoinLobby would, with the player's membership of the source not
+// counted against MaxLobbiesPerPlayer; if the checks fail the player stays in the source and
+// the error is returned. On success the source sees a normal leave (OnPlayerLeave, owner
+// transfer, deletion if now abandoned) and the destination a normal join. The player arrives
+// unready, without lobby-scoped metadata, and with a fresh slot and team.
+func (m *LobbyManager) MovePlayer(from, to LobbyID, playerID PlayerID) error {
+	if from == to {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Source and destination lobby are the same")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source, exists := m.lobbies[from]
+	if !exists {
+		return ErrLobbyNotFound(string(from))
+	}
+	destination, exists := m.lobbies[to]
+	if !exists {
+		return ErrLobbyNotFound(string(to))
+	}
+	current := findPlayer(source, playerID)
+	if current == nil {
+		return ErrPlayerNotInLobby(string(playerID), string(from))
+	}
+
+	// Check the destination as if the player had already left, putting the membership back
+	// if they cannot join. Nothing else runs under the exclusive lock, so the join that
+	// follows a passing check cannot fail.
+	moved := &Player{ID: current.ID, Username: current.Username, Connection: current.Connection}
+	m.removeMembership(playerID, from)
+	if err := m.checkCanJoin(destination, moved); err != nil {
+		m.addMembership(playerID, from)
+		return err
+	}
+
+	delete(source.retained, playerID)
+	if err := m.leaveLobbyLocked(source, playerID, ReasonPlayerLeft); err != nil {
+		m.addMembership(playerID, from)
+		return err
+	}
+	if err := m.joinLobbyLocked(destination, moved); err != nil {
+		return err // Unreachable under the exclusive lock, see above
+	}
+	m.removeIfAbandonedLocked(source)
+	return nil
+}
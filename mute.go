@@ -0,0 +1,67 @@
+package lobby
+
+import "time"
+
+// MutePlayer stops a player from sending chat messages in the lobby for duration, without
+// removing them; SendChatMessage rejects their messages with ErrorCodeUnauthorized until the
+// mute expires or UnmutePlayer lifts it. The owner and moderators may mute players, and only the
+// owner may mute a moderator. Muting an already muted player replaces the expiry. The mute
+// outlives a leave and rejoin, so leaving is no way around it.
+func (m *LobbyManager) MutePlayer(lobbyID LobbyID, modID string, target PlayerID, duration time.Duration) error {
+	if duration <= 0 {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Mute duration must be positive")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, modID) {
+		return ErrUnauthorized("mute_player")
+	}
+	if findPlayer(lobby, target) == nil {
+		return ErrPlayerNotInLobby(string(target), string(lobbyID))
+	}
+	if string(target) == modID {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Cannot mute yourself")
+	}
+	if string(target) == lobby.OwnerID || (lobby.Moderators[target] && lobby.OwnerID != modID) {
+		return ErrUnauthorized("mute_player")
+	}
+
+	now := time.Now()
+	for id, until := range lobby.mutedInChat {
+		if !now.Before(until) {
+			delete(lobby.mutedInChat, id)
+		}
+	}
+	if lobby.mutedInChat == nil {
+		lobby.mutedInChat = make(map[PlayerID]time.Time)
+	}
+	lobby.mutedInChat[target] = now.Add(duration)
+	return nil
+}
+
+// UnmutePlayer lifts a chat mute before it expires. The owner and moderators may unmute
+// players; unmuting a player who is not muted is not an error.
+func (m *LobbyManager) UnmutePlayer(lobbyID LobbyID, modID string, target PlayerID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if !canModerate(lobby, modID) {
+		return ErrUnauthorized("unmute_player")
+	}
+	delete(lobby.mutedInChat, target)
+	return nil
+}
+
+// mutedUntil returns when the player's chat mute in the lobby ends, and whether one is in
+// effect. Caller must hold the lobby's lock.
+func mutedUntil(lobby *Lobby, playerID PlayerID) (time.Time, bool) {
+	until, muted := lobby.mutedInChat[playerID]
+	return until, muted && time.Now().Before(until)
+}
@@ -9,4 +9,15 @@ type Player struct {
 	Username string
 	Ready    bool
 	Metadata map[string]interface{}
+	Slot     int // Seat index assigned on join, see assignSeat
+	Team     int // Team number from 1 to Lobby.TeamCount, or 0 if the lobby has no teams
+
+	Connection *ConnectionInfo // Latest connection quality, see SetPlayerConnectionInfo
+}
+
+// PlayerLocation identifies a player and the lobby they are in.
+type PlayerLocation struct {
+	PlayerID PlayerID
+	Username string
+	LobbyID  LobbyID
 }
@@ -0,0 +1,90 @@
+package lobby
+
+import "sort"
+
+// DefaultQuickJoinMaxPlayers is the capacity of lobbies QuickJoin creates when
+// QuickJoinCriteria.MaxPlayers is unset.
+const DefaultQuickJoinMaxPlayers = 4
+
+// QuickJoinCriteria narrows which lobbies QuickJoin may pick and describes the lobby it
+// creates when CreateIfNone is set.
+type QuickJoinCriteria struct {
+	Metadata     map[string]interface{} // Values the lobby's metadata must hold, compared with reflect.DeepEqual
+	CreateIfNone bool                   // Create a public lobby owned by the player when nothing matches
+	Name         string                 // Name of a created lobby (default: "Quick Match")
+	MaxPlayers   int                    // Capacity of a created lobby (default: DefaultQuickJoinMaxPlayers)
+}
+
+// QuickJoin joins the player to an open lobby: public, waiting, with room and matching
+// criteria.Metadata. The fullest such lobby wins so games fill faster; ties go to the oldest
+// lobby, then the lowest ID. When nothing matches it fails with ErrorCodeNoMatchingLobby, or
+// with CreateIfNone creates a lobby carrying criteria.Metadata, owned by the player, and joins
+// them to it. Selection and join happen under one lock, so the chosen lobby cannot fill up in
+// between.
+func (m *LobbyManager) QuickJoin(player *Player, criteria QuickJoinCriteria) (*Lobby, error) {
+	name := criteria.Name
+	if name == "" {
+		name = "Quick Match"
+	}
+	metadata := copyMetadata(criteria.Metadata)
+	if criteria.CreateIfNone {
+		if err := m.validateLobbyInput(name, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.membershipCount(player.ID) >= m.maxLobbiesPerPlayer() {
+		return nil, ErrPlayerAlreadyInLobby(string(player.ID))
+	}
+
+	waiting := LobbyWaiting
+	candidates := make([]*Lobby, 0, len(m.lobbies))
+	for _, l := range m.lobbies {
+		candidates = append(candidates, l)
+	}
+	candidates = m.filterLobbies(candidates, LobbyFilter{
+		PublicOnly:    true,
+		State:         &waiting,
+		NotFull:       true,
+		MetadataMatch: criteria.Metadata,
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if len(a.Players) != len(b.Players) {
+			return len(a.Players) > len(b.Players)
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	for _, lobby := range candidates {
+		if m.checkCanJoin(lobby, player) != nil || m.joinLobbyLocked(lobby, player) != nil {
+			continue
+		}
+		return lobby, nil
+	}
+
+	if !criteria.CreateIfNone {
+		return nil, ErrNoMatchingLobby()
+	}
+	maxPlayers := criteria.MaxPlayers
+	if maxPlayers <= 0 {
+		maxPlayers = DefaultQuickJoinMaxPlayers
+	}
+	lobby, err := m.createLobbyLocked(name, maxPlayers, true, metadata, string(player.ID), LobbyOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkCanJoin(lobby, player); err != nil {
+		m.dropLobbyLocked(lobby)
+		return nil, err
+	}
+	if err := m.joinLobbyLocked(lobby, player); err != nil {
+		m.dropLobbyLocked(lobby)
+		return nil, err
+	}
+	return lobby, nil
+}
@@ -0,0 +1,107 @@
+package lobby
+
+// ReassignPlayerID renames a player everywhere the manager knows them: their seat in every lobby
+// they belong to, ownership and moderator roles, spectator places, held seats, retained state and
+// pending joins. It is meant for SessionManager.OnSessionIDChanged, so a player whose user ID
+// rotates on reconnect keeps their seat. It returns an error if newID is already in use.
+func (m *LobbyManager) ReassignPlayerID(oldID, newID PlayerID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if oldID == newID {
+		return nil
+	}
+	if len(m.memberships[newID]) > 0 {
+		return ErrPlayerAlreadyInLobby(string(newID))
+	}
+	for _, lobby := range m.lobbies {
+		for _, p := range lobby.Players {
+			if p.ID == oldID {
+				p.ID = newID
+			}
+		}
+		for _, s := range lobby.Spectators {
+			if s.ID == oldID {
+				s.ID = newID
+			}
+		}
+		if lobby.OwnerID == string(oldID) {
+			lobby.OwnerID = string(newID)
+		}
+		if lobby.Moderators[oldID] {
+			delete(lobby.Moderators, oldID)
+			lobby.Moderators[newID] = true
+		}
+		if expiry, held := lobby.heldSeats[oldID]; held {
+			delete(lobby.heldSeats, oldID)
+			lobby.heldSeats[newID] = expiry
+		}
+		if until, muted := lobby.mutedInChat[oldID]; muted {
+			delete(lobby.mutedInChat, oldID)
+			lobby.mutedInChat[newID] = until
+		}
+		if at, kicked := lobby.kickedAt[oldID]; kicked {
+			delete(lobby.kickedAt, oldID)
+			lobby.kickedAt[newID] = at
+		}
+		if ban, banned := lobby.bans[oldID]; banned {
+			delete(lobby.bans, oldID)
+			ban.PlayerID = newID
+			lobby.bans[newID] = ban
+		}
+		if sent, ok := lobby.chatSent[oldID]; ok {
+			delete(lobby.chatSent, oldID)
+			lobby.chatSent[newID] = sent
+		}
+		if hold := lobby.lastPlayerHold; hold != nil && hold.playerID == oldID {
+			hold.playerID = newID
+		}
+		if state, ok := lobby.retained[oldID]; ok {
+			delete(lobby.retained, oldID)
+			lobby.retained[newID] = state
+		}
+		for _, pending := range lobby.pendingJoins {
+			if pending.Player.ID == oldID {
+				pending.Player.ID = newID
+			}
+		}
+	}
+	if lobbies, ok := m.memberships[oldID]; ok {
+		delete(m.memberships, oldID)
+		m.memberships[newID] = lobbies
+	}
+	if m.listWatchers[string(oldID)] {
+		delete(m.listWatchers, string(oldID))
+		m.listWatchers[string(newID)] = true
+	}
+	return nil
+}
+
+// RenamePlayer changes a player's display name wherever they are seated or spectating, and
+// tells each of those lobbies with ReasonPlayerRenamed. It is the lobby side of
+// SessionManager.RenameUser; IDs are unaffected.
+func (m *LobbyManager) RenamePlayer(playerID PlayerID, username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, lobby := range m.lobbies {
+		renamed := false
+		for _, p := range lobby.Players {
+			if p.ID == playerID && p.Username != username {
+				p.Username = username
+				renamed = true
+			}
+		}
+		for _, s := range lobby.Spectators {
+			if s.ID == playerID && s.Username != username {
+				s.Username = username
+				renamed = true
+			}
+		}
+		if !renamed {
+			continue
+		}
+		if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+			m.emit(lobby, m.Events.OnLobbyStateChange)
+		}
+		m.broadcastLobbyState(lobby, ReasonPlayerRenamed)
+	}
+}
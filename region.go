@@ -0,0 +1,77 @@
+package lobby
+
+import "sort"
+
+// FindNearestLobbies suggests low-latency lobbies for a player in region: the public, waiting
+// lobbies with a seat left that ListLobbies would list, nearest first by RegionDistance. Ties
+// go to the oldest lobby, then the lowest ID. Lobbies in regions RegionDistance cannot reach
+// are left out. A limit of zero or less returns every reachable lobby.
+func (m *LobbyManager) FindNearestLobbies(region string, limit int) []*Lobby {
+	waiting := LobbyWaiting
+	candidates := m.FindLobbies(LobbyFilter{PublicOnly: true, State: &waiting, NotFull: true})
+
+	distanceTo := m.RegionDistance
+	if distanceTo == nil {
+		hops := regionHops(region, m.RegionAdjacency)
+		distanceTo = func(from, to string) int {
+			if distance, reachable := hops[to]; reachable {
+				return distance
+			}
+			return -1
+		}
+	}
+	distances := make(map[string]int)
+	nearest := candidates[:0]
+	for _, l := range candidates {
+		distance, known := distances[l.Region]
+		if !known {
+			distance = distanceTo(region, l.Region)
+			distances[l.Region] = distance
+		}
+		if distance >= 0 {
+			nearest = append(nearest, l)
+		}
+	}
+	sort.Slice(nearest, func(i, j int) bool {
+		a, b := nearest[i], nearest[j]
+		if distances[a.Region] != distances[b.Region] {
+			return distances[a.Region] < distances[b.Region]
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	if limit > 0 && len(nearest) > limit {
+		nearest = nearest[:limit]
+	}
+	return nearest
+}
+
+// regionHops returns how many adjacency steps each region reachable from region is away,
+// with region itself at 0. Adjacency is treated as undirected.
+func regionHops(region string, adjacency map[string][]string) map[string]int {
+	if region == "" {
+		return map[string]int{}
+	}
+	hops := map[string]int{region: 0}
+	neighbours := make(map[string][]string, len(adjacency))
+	for from, tos := range adjacency {
+		for _, to := range tos {
+			neighbours[from] = append(neighbours[from], to)
+			neighbours[to] = append(neighbours[to], from)
+		}
+	}
+	queue := []string{region}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range neighbours[current] {
+			if _, seen := hops[next]; !seen {
+				hops[next] = hops[current] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return hops
+}
@@ -0,0 +1,127 @@
+package lobby
+
+import "time"
+
+// RematchResponse is sent to everyone moved by RematchLobby, pointing them at the new lobby.
+type RematchResponse struct {
+	Action     string `json:"action"`
+	LobbyID    string `json:"lobby_id"`     // The lobby that was replaced
+	NewLobbyID string `json:"new_lobby_id"` // The fresh lobby everyone now belongs to
+}
+
+// RematchLobby starts a rematch with the same group: it creates a fresh waiting lobby with the
+// old one's name, settings and metadata, moves every player into it keeping their slot and
+// team, and deletes the old lobby. Moderators, running chat mutes and kick cooldowns carry
+// over. With RematchSpectators, spectators come along too. Players arrive unready. Only the
+// owner may call it, in any state.
+//
+// Everyone moved receives a rematch message naming the new lobby, followed by its
+// lobby_state; callers tracking lobby membership elsewhere (such as sessions) must follow
+// them. The new lobby has the same capacity, so everyone fits; held seats and pending joins
+// of the old lobby are dropped.
+func (m *LobbyManager) RematchLobby(lobbyID LobbyID, ownerID string) (*Lobby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, exists := m.lobbies[lobbyID]
+	if !exists {
+		return nil, ErrLobbyNotFound(string(lobbyID))
+	}
+	if !m.actsAsOwner(old, ownerID) {
+		return nil, ErrUnauthorized("rematch")
+	}
+
+	// The old lobby still holds its name until it is dropped below
+	if m.lobbyNames[old.Name] == old.ID {
+		delete(m.lobbyNames, old.Name)
+	}
+	var allowed map[string]bool
+	if old.AllowedActions != nil {
+		allowed = make(map[string]bool, len(old.AllowedActions))
+		for action, ok := range old.AllowedActions {
+			allowed[action] = ok
+		}
+	}
+	lobby, err := m.createLobbyLocked(old.Name, old.MaxPlayers, old.Public, copyMetadata(old.Metadata), old.OwnerID, LobbyOptions{
+		AutoStart:        old.AutoStart,
+		AutoReadyOnJoin:  old.AutoReadyOnJoin,
+		MaxSpectators:    old.MaxSpectators,
+		SpectatorRatio:   old.SpectatorRatio,
+		PersistWhenEmpty: old.PersistWhenEmpty,
+		TeamCount:        old.TeamCount,
+		MaxPerTeam:       old.MaxPerTeam,
+		MinPlayers:       old.MinPlayers,
+		AllowedActions:   allowed,
+		Region:           old.Region,
+	})
+	if err != nil {
+		m.lobbyNames[old.Name] = old.ID
+		return nil, err
+	}
+	if len(old.Moderators) > 0 {
+		lobby.Moderators = make(map[PlayerID]bool, len(old.Moderators))
+		for id, moderator := range old.Moderators {
+			lobby.Moderators[id] = moderator
+		}
+	}
+	for id := range old.mutedInChat {
+		if until, muted := mutedUntil(old, id); muted {
+			if lobby.mutedInChat == nil {
+				lobby.mutedInChat = make(map[PlayerID]time.Time)
+			}
+			lobby.mutedInChat[id] = until
+		}
+	}
+	for id, at := range old.kickedAt {
+		if _, cooling := m.kickCooldownUntil(old, id); cooling {
+			if lobby.kickedAt == nil {
+				lobby.kickedAt = make(map[PlayerID]time.Time)
+			}
+			lobby.kickedAt[id] = at
+		}
+	}
+	if len(old.bans) > 0 {
+		lobby.bans = make(map[PlayerID]BanEntry, len(old.bans))
+		for id, ban := range old.bans {
+			lobby.bans[id] = ban
+		}
+	}
+
+	// Players are seated as they were rather than through assignSeat, so teams stay intact
+	for _, p := range old.Players {
+		player := &Player{ID: p.ID, Username: p.Username, Slot: p.Slot, Team: p.Team, Connection: p.Connection}
+		lobby.Players = append(lobby.Players, player)
+		m.removeMembership(p.ID, old.ID)
+		m.addMembership(p.ID, lobby.ID)
+		if m.Events != nil && m.Events.OnPlayerJoin != nil {
+			m.emitPlayer(lobby, player, m.Events.OnPlayerJoin)
+		}
+	}
+	if m.RematchSpectators {
+		for _, s := range old.Spectators {
+			lobby.Spectators = append(lobby.Spectators, &Player{ID: s.ID, Username: s.Username})
+		}
+	}
+
+	if m.canBroadcast() {
+		msg := RematchResponse{Action: "rematch", LobbyID: string(old.ID), NewLobbyID: string(lobby.ID)}
+		for _, p := range lobby.Players {
+			m.deliver(string(p.ID), msg)
+		}
+		for _, s := range lobby.Spectators {
+			m.deliver(string(s.ID), msg)
+		}
+	}
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonRematch)
+
+	// Everyone moved has been told already, so only list watchers and spectators left behind
+	// hear that the old lobby is gone
+	old.Players = nil
+	if m.RematchSpectators {
+		old.Spectators = nil
+	}
+	m.removeLobbyLocked(old)
+	return lobby, nil
+}
@@ -11,6 +11,47 @@ type LobbyRepository interface {
 	DeleteLobby(id LobbyID) error
 }
 
+// ReadOnlyLobbyRepository is the read side of a lobby store, such as a read replica.
+// Replicas may lag the primary, so reads can return stale lobbies, miss newly created ones,
+// or still return deleted ones.
+type ReadOnlyLobbyRepository interface {
+	GetLobby(id LobbyID) (*Lobby, bool)
+	ListLobbies() []*Lobby
+}
+
+// SplitRepo routes writes to Primary and reads to Replica. Reads are only as fresh as the
+// replica: read-your-writes is not guaranteed, so callers that must see their own update
+// should read from Primary directly.
+type SplitRepo struct {
+	Primary LobbyRepository
+	Replica ReadOnlyLobbyRepository
+}
+
+// CreateLobby stores a new lobby in the primary.
+func (r *SplitRepo) CreateLobby(lobby *Lobby) error {
+	return r.Primary.CreateLobby(lobby)
+}
+
+// GetLobby retrieves a lobby by ID from the replica.
+func (r *SplitRepo) GetLobby(id LobbyID) (*Lobby, bool) {
+	return r.Replica.GetLobby(id)
+}
+
+// ListLobbies returns all lobbies known to the replica.
+func (r *SplitRepo) ListLobbies() []*Lobby {
+	return r.Replica.ListLobbies()
+}
+
+// UpdateLobby updates an existing lobby in the primary.
+func (r *SplitRepo) UpdateLobby(lobby *Lobby) error {
+	return r.Primary.UpdateLobby(lobby)
+}
+
+// DeleteLobby removes a lobby by ID from the primary.
+func (r *SplitRepo) DeleteLobby(id LobbyID) error {
+	return r.Primary.DeleteLobby(id)
+}
+
 // InMemoryLobbyRepo is a thread-safe in-memory implementation of LobbyRepository.
 type InMemoryLobbyRepo struct {
 	mu      sync.Mutex
@@ -0,0 +1,60 @@
+package lobby
+
+import "testing"
+
+func TestSplitRepo_RoutesReadsToReplica(t *testing.T) {
+	primary := NewInMemoryLobbyRepo()
+	replica := NewInMemoryLobbyRepo()
+	repo := &SplitRepo{Primary: primary, Replica: replica}
+
+	// The replica has not caught up with the primary yet
+	replica.CreateLobby(&Lobby{ID: "room", Name: "room", MaxPlayers: 2})
+	if err := repo.CreateLobby(&Lobby{ID: "new", Name: "new", MaxPlayers: 4}); err != nil {
+		t.Fatalf("CreateLobby failed: %v", err)
+	}
+	primary.CreateLobby(&Lobby{ID: "room", Name: "room", MaxPlayers: 8})
+
+	if _, ok := primary.GetLobby("new"); !ok {
+		t.Error("Expected write to reach the primary")
+	}
+	if _, ok := repo.GetLobby("new"); ok {
+		t.Error("Expected read to miss a lobby the replica has not seen")
+	}
+	if l, _ := repo.GetLobby("room"); l.MaxPlayers != 2 {
+		t.Errorf("Expected stale replica data, got MaxPlayers %d", l.MaxPlayers)
+	}
+	if len(repo.ListLobbies()) != 1 {
+		t.Errorf("Expected list from the replica, got %d lobbies", len(repo.ListLobbies()))
+	}
+
+	if err := repo.DeleteLobby("room"); err != nil {
+		t.Fatalf("DeleteLobby failed: %v", err)
+	}
+	if _, ok := primary.GetLobby("room"); ok {
+		t.Error("Expected delete to reach the primary")
+	}
+	if _, ok := repo.GetLobby("room"); !ok {
+		t.Error("Expected replica to still return the deleted lobby")
+	}
+}
+
+func TestLobbyManager_ReadReplica(t *testing.T) {
+	replica := NewInMemoryLobbyRepo()
+	manager := NewLobbyManager()
+	manager.ReadReplica = replica
+
+	lobby, err := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	if err != nil {
+		t.Fatalf("Writes should go to the manager: %v", err)
+	}
+	replica.CreateLobby(&Lobby{ID: lobby.ID, Name: "Test Lobby", MaxPlayers: 2})
+	got, ok := manager.GetLobbyByID(lobby.ID)
+	if !ok || got == lobby || got.MaxPlayers != 2 {
+		t.Errorf("Expected read from the stale replica, got %+v", got)
+	}
+
+	manager.CreateLobby("Other Lobby", 4, true, nil, "owner1")
+	if len(manager.ListLobbies()) != 1 {
+		t.Errorf("Expected list from the replica, got %d lobbies", len(manager.ListLobbies()))
+	}
+}
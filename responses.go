@@ -15,14 +15,17 @@ func NewResponseBuilder(manager *LobbyManager) *ResponseBuilder {
 // BuildLobbyStateResponse creates a standardized lobby state response
 func (rb *ResponseBuilder) BuildLobbyStateResponse(l *Lobby) LobbyStateResponse {
 	players := make([]PlayerState, 0, len(l.Players))
-	canStartGameFunc := rb.manager.Events.CanStartGame
+	var canStartGameFunc func(lobby *Lobby, userID string) bool
+	if rb.manager.Events != nil {
+		canStartGameFunc = rb.manager.Events.CanStartGame
+	}
 
 	for _, p := range l.Players {
 		canStart := false
 		if canStartGameFunc != nil {
 			canStart = canStartGameFunc(l, string(p.ID))
 		} else {
-			canStart = (l.OwnerID == string(p.ID))
+			canStart = rb.manager.actsAsOwner(l, string(p.ID))
 		}
 
 		players = append(players, PlayerState{
@@ -30,6 +33,11 @@ func (rb *ResponseBuilder) BuildLobbyStateResponse(l *Lobby) LobbyStateResponse
 			Username:     p.Username,
 			Ready:        p.Ready,
 			CanStartGame: canStart,
+			Role:         playerRole(l, string(p.ID)),
+			Slot:         p.Slot,
+			Team:         p.Team,
+			Metadata:     p.Metadata,
+			Connection:   p.Connection,
 		})
 	}
 
@@ -39,6 +47,53 @@ func (rb *ResponseBuilder) BuildLobbyStateResponse(l *Lobby) LobbyStateResponse
 		Players:  players,
 		State:    lobbyStateString(l.State),
 		Metadata: l.Metadata,
+
+		MinPlayers:  rb.manager.minPlayers(l),
+		ReadyLocked: l.ReadyLocked,
+		TeamCount:   l.TeamCount,
+		MaxPerTeam:  l.MaxPerTeam,
+		Spectators:  spectatorStates(l),
+	}
+}
+
+// BuildLobbyStateSnapshot is BuildLobbyStateResponse for a lobby the caller does not hold the
+// lock for, such as one returned by CreateLobby or QuickJoin. It builds from a GetLobbySnapshot
+// copy so the response never shares players or metadata with the live lobby; a lobby that has
+// since been removed is built as-is, since nothing changes it any more.
+func (rb *ResponseBuilder) BuildLobbyStateSnapshot(l *Lobby) LobbyStateResponse {
+	if snapshot, ok := rb.manager.GetLobbySnapshot(l.ID); ok {
+		l = snapshot
+	}
+	return rb.BuildLobbyStateResponse(l)
+}
+
+// spectatorStates lists a lobby's spectators, or nil if it has none.
+func spectatorStates(l *Lobby) []PlayerState {
+	if len(l.Spectators) == 0 {
+		return nil
+	}
+	spectators := make([]PlayerState, 0, len(l.Spectators))
+	for _, s := range l.Spectators {
+		spectators = append(spectators, PlayerState{
+			UserID:   string(s.ID),
+			Username: s.Username,
+			Role:     RoleSpectator,
+		})
+	}
+	return spectators
+}
+
+// BuildInGameJoinResponse creates the response for a player joining a game already in progress
+func (rb *ResponseBuilder) BuildInGameJoinResponse(l *Lobby, player *Player) InGameJoinResponse {
+	state := rb.BuildLobbyStateResponse(l)
+	return InGameJoinResponse{
+		Action:    "in_game_join",
+		LobbyID:   string(l.ID),
+		PlayerID:  string(player.ID),
+		Players:   state.Players,
+		State:     state.State,
+		StartedAt: l.StartedAt,
+		Metadata:  l.Metadata,
 	}
 }
 
@@ -51,6 +106,11 @@ func (rb *ResponseBuilder) BuildLobbyInfoResponse(l *Lobby) LobbyInfoResponse {
 			Username:     p.Username,
 			Ready:        p.Ready,
 			CanStartGame: false,
+			Role:         playerRole(l, string(p.ID)),
+			Slot:         p.Slot,
+			Team:         p.Team,
+			Metadata:     p.Metadata,
+			Connection:   p.Connection,
 		})
 	}
 
@@ -61,6 +121,7 @@ func (rb *ResponseBuilder) BuildLobbyInfoResponse(l *Lobby) LobbyInfoResponse {
 		Players:    players,
 		State:      lobbyStateString(l.State),
 		MaxPlayers: l.MaxPlayers,
+		MinPlayers: rb.manager.minPlayers(l),
 		Public:     l.Public,
 	}
 }
@@ -68,6 +129,17 @@ func (rb *ResponseBuilder) BuildLobbyInfoResponse(l *Lobby) LobbyInfoResponse {
 // BuildLobbyListResponse creates a standardized lobby list response
 func (rb *ResponseBuilder) BuildLobbyListResponse() LobbyListResponse {
 	lobbies := rb.manager.ListLobbies()
+	return rb.buildLobbyList(lobbies, len(lobbies), false)
+}
+
+// BuildFilteredLobbyListResponse creates a lobby list response for the lobbies matching filter
+func (rb *ResponseBuilder) BuildFilteredLobbyListResponse(filter LobbyFilter) LobbyListResponse {
+	lobbies := rb.manager.FindLobbies(filter)
+	return rb.buildLobbyList(lobbies, len(lobbies), false)
+}
+
+// buildLobbyList lists lobbies, one page of total matching lobbies.
+func (rb *ResponseBuilder) buildLobbyList(lobbies []*Lobby, total int, hasMore bool) LobbyListResponse {
 	ids := make([]string, 0, len(lobbies))
 	for _, l := range lobbies {
 		ids = append(ids, string(l.ID))
@@ -76,6 +148,43 @@ func (rb *ResponseBuilder) BuildLobbyListResponse() LobbyListResponse {
 	return LobbyListResponse{
 		Action:  "lobby_list",
 		Lobbies: ids,
+		Total:   total,
+		HasMore: hasMore,
+	}
+}
+
+// BuildLobbyListDetailedResponse creates a lobby list response carrying a summary of each lobby
+func (rb *ResponseBuilder) BuildLobbyListDetailedResponse() LobbyListDetailedResponse {
+	lobbies := rb.manager.ListLobbies()
+	return rb.buildLobbyListDetailed(lobbies, len(lobbies), false)
+}
+
+// BuildFilteredLobbyListDetailedResponse creates a detailed lobby list response for the lobbies matching filter
+func (rb *ResponseBuilder) BuildFilteredLobbyListDetailedResponse(filter LobbyFilter) LobbyListDetailedResponse {
+	lobbies := rb.manager.FindLobbies(filter)
+	return rb.buildLobbyListDetailed(lobbies, len(lobbies), false)
+}
+
+// buildLobbyListDetailed summarizes lobbies, one page of total matching lobbies.
+func (rb *ResponseBuilder) buildLobbyListDetailed(lobbies []*Lobby, total int, hasMore bool) LobbyListDetailedResponse {
+	summaries := make([]LobbySummary, 0, len(lobbies))
+	for _, l := range lobbies {
+		summaries = append(summaries, LobbySummary{
+			LobbyID:     string(l.ID),
+			Name:        l.Name,
+			PlayerCount: len(l.Players),
+			MaxPlayers:  l.MaxPlayers,
+			State:       lobbyStateString(l.State),
+			Public:      l.Public,
+			Region:      l.Region,
+		})
+	}
+
+	return LobbyListDetailedResponse{
+		Action:  "lobby_list_detailed",
+		Lobbies: summaries,
+		Total:   total,
+		HasMore: hasMore,
 	}
 }
 
@@ -88,6 +197,20 @@ func (rb *ResponseBuilder) BuildSuccessResponse(action string, data interface{})
 	}
 }
 
+// parseLobbyState converts a string from lobbyStateString back to a lobby state.
+func parseLobbyState(s string) (LobbyState, bool) {
+	switch s {
+	case "waiting":
+		return LobbyWaiting, true
+	case "in_game":
+		return LobbyInGame, true
+	case "finished":
+		return LobbyFinished, true
+	default:
+		return 0, false
+	}
+}
+
 // lobbyStateString converts lobby state to string representation
 func lobbyStateString(state LobbyState) string {
 	switch state {
@@ -0,0 +1,77 @@
+package lobby
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResponseBuilder_NilEvents(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Test Lobby", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "owner1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	resp := NewResponseBuilder(manager).BuildLobbyStateResponse(lobby)
+	if len(resp.Players) != 2 {
+		t.Fatalf("Expected 2 players, got %d", len(resp.Players))
+	}
+	if !resp.Players[0].CanStartGame {
+		t.Error("Owner should be able to start the game by default")
+	}
+	if resp.Players[1].CanStartGame {
+		t.Error("Non-owner should not be able to start the game by default")
+	}
+}
+
+func TestResponses_EmptyListsEncodeAsArrays(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Empty Lobby", 4, true, nil, "owner1")
+	builder := NewResponseBuilder(manager)
+
+	cases := map[string]interface{}{
+		"built state":   builder.BuildLobbyStateResponse(lobby),
+		"built info":    builder.BuildLobbyInfoResponse(lobby),
+		"literal state": LobbyStateResponse{Action: "lobby_state"},
+		"literal info":  LobbyInfoResponse{Action: "lobby_info"},
+	}
+	for name, resp := range cases {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", name, err)
+		}
+		if !strings.Contains(string(data), `"players":[]`) {
+			t.Errorf("%s: expected \"players\":[], got %s", name, data)
+		}
+	}
+
+	for _, resp := range []interface{}{
+		LobbyListResponse{Action: "lobby_list"},
+		LobbyListDetailedResponse{Action: "lobby_list_detailed"},
+	} {
+		data, _ := json.Marshal(resp)
+		if !strings.Contains(string(data), `"lobbies":[]`) {
+			t.Errorf("Expected \"lobbies\":[], got %s", data)
+		}
+	}
+}
+
+func TestResponseBuilder_LobbyListDetailed(t *testing.T) {
+	manager := NewLobbyManager()
+	lobby, _ := manager.CreateLobby("Game Room", 4, true, nil, "owner1")
+	manager.JoinLobby(lobby.ID, &Player{ID: "owner1", Username: "Alice"})
+	manager.JoinLobby(lobby.ID, &Player{ID: "player2", Username: "Bob"})
+
+	resp := NewResponseBuilder(manager).BuildLobbyListDetailedResponse()
+	want := LobbySummary{
+		LobbyID:     string(lobby.ID),
+		Name:        "Game Room",
+		PlayerCount: 2,
+		MaxPlayers:  4,
+		State:       "waiting",
+		Public:      true,
+	}
+	if len(resp.Lobbies) != 1 || resp.Lobbies[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, resp.Lobbies)
+	}
+}
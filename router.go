@@ -15,6 +15,22 @@ const (
 	ActionStartGame    = "start_game"
 	ActionGetLobbyInfo = "get_lobby_info"
 	ActionLogout       = "logout"
+	ActionRequestJoin  = "request_join"
+	ActionConfirmJoin  = "confirm_join"
+
+	ActionReadyAndMaybeStart = "ready_and_maybe_start"
+	ActionSetPlayersMetadata = "set_players_metadata"
+	ActionKickPlayer         = "kick_player"
+	ActionChatMessage        = "chat_message"
+
+	ActionListLobbiesDetailed = "list_lobbies_detailed"
+	ActionQuickJoin           = "quick_join"
+	ActionJoinLobbyByName     = "join_lobby_by_name"
+	ActionSetTeam             = "set_team"
+	ActionRematch             = "rematch"
+	ActionHeartbeat           = "heartbeat"
+	ActionRenameUser          = "rename_user"
+	ActionListBans            = "list_bans"
 )
 
 // Conn is a minimal interface for sending JSON responses, transport-agnostic.
@@ -38,12 +54,17 @@ type Middleware func(next MessageHandler) MessageHandler
 type MessageRouter struct {
 	handlers   map[string]MessageHandler
 	middleware []Middleware
+
+	// RequireAuth marks actions that AuthMiddleware must authenticate before dispatch.
+	// Handlers that validate their own session token keep doing so regardless of this map.
+	RequireAuth map[string]bool
 }
 
 // NewMessageRouter creates a new MessageRouter.
 func NewMessageRouter() *MessageRouter {
 	return &MessageRouter{
-		handlers: make(map[string]MessageHandler),
+		handlers:    make(map[string]MessageHandler),
+		RequireAuth: make(map[string]bool),
 	}
 }
 
@@ -57,18 +78,161 @@ func (r *MessageRouter) Use(mw Middleware) {
 	r.middleware = append(r.middleware, mw)
 }
 
+// AuthMiddleware returns middleware that authenticates every action marked in RequireAuth.
+// Authenticated actions must carry "user_id" and "token" in their data.
+func (r *MessageRouter) AuthMiddleware(deps *HandlerDeps) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(conn Conn, msg IncomingMessage) error {
+			if !r.RequireAuth[msg.Action] {
+				return next(conn, msg)
+			}
+			var creds struct {
+				UserID string `json:"user_id"`
+				Token  string `json:"token"`
+			}
+			if err := json.Unmarshal(msg.Data, &creds); err != nil {
+				return conn.WriteJSON(ErrInvalidMessage(msg.Action).ToErrorResponse())
+			}
+			if _, err := validateSessionToken(deps, creds.UserID, creds.Token); err != nil {
+				return conn.WriteJSON(toErrorResponse(err))
+			}
+			return next(conn, msg)
+		}
+	}
+}
+
+// LobbyActionsMiddleware returns middleware that rejects actions a lobby's AllowedActions
+// forbid with ErrorCodeUnauthorized. The lobby is the request's "lobby_id", or the requester's
+// current lobby when the request names none. Requests tied to no lobby pass through.
+func (r *MessageRouter) LobbyActionsMiddleware(deps *HandlerDeps) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(conn Conn, msg IncomingMessage) error {
+			var target struct {
+				LobbyID string `json:"lobby_id"`
+				UserID  string `json:"user_id"`
+			}
+			if err := json.Unmarshal(msg.Data, &target); err != nil {
+				return next(conn, msg)
+			}
+			lobbyID := target.LobbyID
+			if lobbyID == "" && target.UserID != "" {
+				lobbyID, _ = deps.SessionManager.GetLobbyID(target.UserID)
+			}
+			if lobbyID != "" && !deps.LobbyManager.ActionAllowed(LobbyID(lobbyID), msg.Action) {
+				return conn.WriteJSON(ErrUnauthorized(msg.Action).ToErrorResponse())
+			}
+			return next(conn, msg)
+		}
+	}
+}
+
+// OutgoingTransformMiddleware returns middleware that applies Events.OutgoingTransform to
+// handler responses, keyed by the request's "user_id". Requests without one, such as
+// register_user, are passed through untransformed.
+func (r *MessageRouter) OutgoingTransformMiddleware(deps *HandlerDeps) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(conn Conn, msg IncomingMessage) error {
+			events := deps.LobbyManager.Events
+			if events == nil || events.OutgoingTransform == nil {
+				return next(conn, msg)
+			}
+			var creds struct {
+				UserID string `json:"user_id"`
+			}
+			if err := json.Unmarshal(msg.Data, &creds); err != nil || creds.UserID == "" {
+				return next(conn, msg)
+			}
+			return next(&transformingConn{Conn: conn, userID: creds.UserID, transform: events.OutgoingTransform}, msg)
+		}
+	}
+}
+
+// transformingConn applies an outgoing transform to every message written for one user.
+type transformingConn struct {
+	Conn
+	userID    string
+	transform func(userID string, message interface{}) interface{}
+}
+
+func (c *transformingConn) WriteJSON(v interface{}) error {
+	return c.Conn.WriteJSON(c.transform(c.userID, v))
+}
+
+// ErrorFieldNames renames the fields of error responses, for front ends built against another
+// contract. Empty names keep the defaults of "code", "message" and "details".
+type ErrorFieldNames struct {
+	Code    string
+	Message string
+	Details string
+}
+
+// ErrorFieldsMiddleware returns middleware that writes every ErrorResponse from the handlers
+// with the given field names, e.g. ErrorFieldNames{Code: "error_code", Message: "error_message"}.
+// Other responses, and the "action" field, are unchanged.
+func (r *MessageRouter) ErrorFieldsMiddleware(names ErrorFieldNames) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(conn Conn, msg IncomingMessage) error {
+			return next(&errorFieldsConn{Conn: conn, names: names}, msg)
+		}
+	}
+}
+
+// errorFieldsConn rewrites error responses with renamed fields.
+type errorFieldsConn struct {
+	Conn
+	names ErrorFieldNames
+}
+
+func (c *errorFieldsConn) WriteJSON(v interface{}) error {
+	errResp, ok := v.(ErrorResponse)
+	if !ok {
+		return c.Conn.WriteJSON(v)
+	}
+	renamed := map[string]interface{}{
+		"action":                              errResp.Action,
+		fieldName(c.names.Code, "code"):       errResp.Code,
+		fieldName(c.names.Message, "message"): errResp.Message,
+	}
+	if errResp.Details != "" {
+		renamed[fieldName(c.names.Details, "details")] = errResp.Details
+	}
+	return c.Conn.WriteJSON(renamed)
+}
+
+// fieldName returns name, or fallback when name is empty.
+func fieldName(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
 // SetupDefaultHandlers automatically registers all standard lobby handlers.
 // This is the recommended way to set up the router - no manual wiring needed!
 func (r *MessageRouter) SetupDefaultHandlers(deps *HandlerDeps) {
 	r.Handle(ActionRegisterUser, RegisterUserHandler(deps))
 	r.Handle(ActionCreateLobby, CreateLobbyHandler(deps))
 	r.Handle(ActionJoinLobby, JoinLobbyHandler(deps))
+	r.Handle(ActionQuickJoin, QuickJoinHandler(deps))
+	r.Handle(ActionJoinLobbyByName, JoinLobbyByNameHandler(deps))
 	r.Handle(ActionLeaveLobby, LeaveLobbyHandler(deps))
 	r.Handle(ActionSetReady, SetReadyHandler(deps))
 	r.Handle(ActionListLobbies, ListLobbiesHandler(deps))
+	r.Handle(ActionListLobbiesDetailed, ListLobbiesDetailedHandler(deps))
 	r.Handle(ActionStartGame, StartGameHandler(deps, nil))
+	r.Handle(ActionReadyAndMaybeStart, ReadyAndMaybeStartHandler(deps, ConfigurableGameStartValidator(nil)))
 	r.Handle(ActionGetLobbyInfo, GetLobbyInfoHandler(deps, nil))
 	r.Handle(ActionLogout, LogoutHandler(deps))
+	r.Handle(ActionRequestJoin, RequestJoinHandler(deps))
+	r.Handle(ActionConfirmJoin, ConfirmJoinHandler(deps))
+	r.Handle(ActionSetPlayersMetadata, SetPlayersMetadataHandler(deps))
+	r.Handle(ActionKickPlayer, KickPlayerHandler(deps))
+	r.Handle(ActionChatMessage, ChatMessageHandler(deps))
+	r.Handle(ActionSetTeam, SetTeamHandler(deps))
+	r.Handle(ActionRematch, RematchHandler(deps))
+	r.Handle(ActionHeartbeat, HeartbeatHandler(deps))
+	r.Handle(ActionRenameUser, RenameUserHandler(deps))
+	r.Handle(ActionListBans, ListBansHandler(deps))
 }
 
 // SetupDefaultHandlersWithCustom validates and sets up handlers with custom functions.
@@ -77,9 +241,12 @@ func (r *MessageRouter) SetupDefaultHandlersWithCustom(deps *HandlerDeps, option
 	r.Handle(ActionRegisterUser, RegisterUserHandler(deps))
 	r.Handle(ActionCreateLobby, CreateLobbyHandler(deps))
 	r.Handle(ActionJoinLobby, JoinLobbyHandler(deps))
+	r.Handle(ActionQuickJoin, QuickJoinHandler(deps))
+	r.Handle(ActionJoinLobbyByName, JoinLobbyByNameHandler(deps))
 	r.Handle(ActionLeaveLobby, LeaveLobbyHandler(deps))
 	r.Handle(ActionSetReady, SetReadyHandler(deps))
 	r.Handle(ActionListLobbies, ListLobbiesHandler(deps))
+	r.Handle(ActionListLobbiesDetailed, ListLobbiesDetailedHandler(deps))
 
 	gameStartValidator := options.GameStartValidator
 	if gameStartValidator == nil {
@@ -88,8 +255,12 @@ func (r *MessageRouter) SetupDefaultHandlersWithCustom(deps *HandlerDeps, option
 			config = DefaultGameStartConfig
 		}
 		gameStartValidator = ConfigurableGameStartValidator(config)
+		if deps.LobbyManager.GameStartConfig == nil {
+			deps.LobbyManager.GameStartConfig = config
+		}
 	}
 	r.Handle(ActionStartGame, StartGameHandler(deps, gameStartValidator))
+	r.Handle(ActionReadyAndMaybeStart, ReadyAndMaybeStartHandler(deps, gameStartValidator))
 
 	responseBuilder := options.ResponseBuilder
 	if responseBuilder == nil {
@@ -100,6 +271,16 @@ func (r *MessageRouter) SetupDefaultHandlersWithCustom(deps *HandlerDeps, option
 	}))
 
 	r.Handle(ActionLogout, LogoutHandler(deps))
+	r.Handle(ActionRequestJoin, RequestJoinHandler(deps))
+	r.Handle(ActionConfirmJoin, ConfirmJoinHandler(deps))
+	r.Handle(ActionSetPlayersMetadata, SetPlayersMetadataHandler(deps))
+	r.Handle(ActionKickPlayer, KickPlayerHandler(deps))
+	r.Handle(ActionChatMessage, ChatMessageHandler(deps))
+	r.Handle(ActionSetTeam, SetTeamHandler(deps))
+	r.Handle(ActionRematch, RematchHandler(deps))
+	r.Handle(ActionHeartbeat, HeartbeatHandler(deps))
+	r.Handle(ActionRenameUser, RenameUserHandler(deps))
+	r.Handle(ActionListBans, ListBansHandler(deps))
 }
 
 // HandlerOptions allows customization of specific handlers
@@ -1,8 +1,11 @@
 package lobby
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
+	"io"
 	"sync"
 	"time"
 )
@@ -16,81 +19,248 @@ type UserSession struct {
 	Active   bool      `json:"active"`
 	LobbyID  string    `json:"lobby_id"`
 	LastSeen time.Time `json:"last_seen"`
+
+	// CanonicalUsername is the normalized form of Username used for uniqueness checks.
+	CanonicalUsername string `json:"canonical_username"`
+
+	// Compression is the payload compression negotiated at register_user, if any.
+	Compression Compression `json:"compression,omitempty"`
+
+	// Data holds server-side values attached with SetSessionData. It is never sent to clients
+	// and is not included in Export.
+	Data map[string]interface{} `json:"-"`
 }
 
 // SessionManager manages active user sessions in a thread-safe manner.
 type SessionManager struct {
 	mu                   sync.RWMutex
 	sessions             map[string]*UserSession
-	usernameToID         map[string]string
+	usernameToIDs        map[string][]string
 	OnSessionCreated     func(session *UserSession)
 	OnSessionReconnected func(session *UserSession)
 	OnSessionRemoved     func(session *UserSession)
+
+	// OnLobbyAssociationChanged fires when SetLobbyID or ClearLobbyID changes which lobby a
+	// session is in, for presence systems tracking who is where. An empty ID means no lobby.
+	// It runs under the session lock, so it must not call back into the SessionManager.
+	OnLobbyAssociationChanged func(session *UserSession, oldLobbyID, newLobbyID string)
+
+	// MaxSessions bounds how many sessions, active or awaiting reconnection, are kept
+	// (default: 0, unlimited). Creating a session at the cap evicts the least recently seen
+	// inactive session, firing OnSessionRemoved for it; if every session is active the new one
+	// is refused, see TryCreateSession. Finding the eviction victim scans all sessions.
+	MaxSessions int
+
+	// SingleSessionPerUser keeps one session per username: creating a session makes it the
+	// only one found by username, and earlier sessions are reachable by ID alone. By default a
+	// username may hold several sessions at once, e.g. one per device.
+	SingleSessionPerUser bool
+
+	// RotateIDOnReconnect makes ReconnectSession issue the session a fresh ID, for deployments
+	// that don't want user IDs to outlive a connection. OnSessionIDChanged runs after the
+	// session lock is released but before the new ID is returned, so wiring it to
+	// LobbyManager.ReassignPlayerID moves the player's lobby seat along with the session.
+	// OnSessionReconnected also runs unlocked.
+	RotateIDOnReconnect bool
+	OnSessionIDChanged  func(oldID string, session *UserSession)
+
+	// UsernameNormalizer maps a username to the canonical form used for uniqueness
+	// checks and lookups (default: identity). The display form is kept as typed.
+	UsernameNormalizer func(username string) string
+
+	// MaxReconnectAttempts is how many failed reconnections a username may make within
+	// ReconnectLockout before being locked out for ReconnectLockout (default: 0, no lockout).
+	MaxReconnectAttempts int
+	ReconnectLockout     time.Duration
+	failedReconnects     map[string]*reconnectAttempts
+
+	// Rand is the randomness source for user IDs and tokens (default: crypto/rand.Reader).
+	// Only replace it in tests; production sources must be cryptographically secure.
+	Rand io.Reader
+
+	// store receives every session change, see NewSessionManagerWithStore. Changes to
+	// LastSeen alone (lookups, Touch) are not written; it is saved with the next other change.
+	// OnStoreError reports failed writes, which otherwise leave the store behind silently.
+	store        SessionStore
+	OnStoreError func(userID string, err error)
 }
 
 // NewSessionManager creates a new session manager
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
-		sessions:     make(map[string]*UserSession),
-		usernameToID: make(map[string]string),
+		sessions:      make(map[string]*UserSession),
+		usernameToIDs: make(map[string][]string),
+		Rand:          rand.Reader,
+		store:         NewInMemorySessionStore(),
+
+		failedReconnects: make(map[string]*reconnectAttempts),
+	}
+}
+
+// reconnectAttempts tracks failed reconnections for one username.
+type reconnectAttempts struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// canonical returns the normalized form of a username.
+func (sm *SessionManager) canonical(username string) string {
+	if sm.UsernameNormalizer == nil {
+		return username
+	}
+	return sm.UsernameNormalizer(username)
+}
+
+// randomHex reads n bytes from the configured randomness source and hex-encodes them.
+func (sm *SessionManager) randomHex(n int) (string, error) {
+	source := sm.Rand
+	if source == nil {
+		source = rand.Reader
+	}
+	bytes := make([]byte, n)
+	if _, err := io.ReadFull(source, bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// GenerateUserID creates a unique user ID. It fails only if the randomness source does.
+func (sm *SessionManager) GenerateUserID() (string, error) {
+	return sm.randomHex(8)
+}
+
+// GenerateSecureToken creates a cryptographically secure session token. It fails only if the
+// randomness source does.
+func (sm *SessionManager) GenerateSecureToken() (string, error) {
+	return sm.randomHex(32)
+}
+
+// tokensEqual compares session tokens in constant time, so response timing does not reveal
+// how much of a guessed token matched.
+func tokensEqual(expected, given string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(given)) == 1
+}
+
+// indexSessionLocked files a session under its username, after any other sessions of that
+// username unless SingleSessionPerUser is set. Caller must hold sm.mu.
+func (sm *SessionManager) indexSessionLocked(session *UserSession) {
+	key := session.CanonicalUsername
+	sm.unindexSessionLocked(key, session.ID)
+	if sm.usernameToIDs == nil {
+		sm.usernameToIDs = make(map[string][]string)
 	}
+	if sm.SingleSessionPerUser {
+		sm.usernameToIDs[key] = []string{session.ID}
+		return
+	}
+	sm.usernameToIDs[key] = append(sm.usernameToIDs[key], session.ID)
 }
 
-// GenerateUserID creates a unique user ID
-func (sm *SessionManager) GenerateUserID() string {
-	bytes := make([]byte, 8)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+// unindexSessionLocked removes a session ID from a username's sessions. Caller must hold sm.mu.
+func (sm *SessionManager) unindexSessionLocked(key, userID string) {
+	ids := sm.usernameToIDs[key]
+	for i, id := range ids {
+		if id != userID {
+			continue
+		}
+		if len(ids) == 1 {
+			delete(sm.usernameToIDs, key)
+		} else {
+			sm.usernameToIDs[key] = append(ids[:i:i], ids[i+1:]...)
+		}
+		return
+	}
 }
 
-// GenerateSecureToken creates a cryptographically secure session token
-func (sm *SessionManager) GenerateSecureToken() string {
-	bytes := make([]byte, 32)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+// sessionByTokenLocked returns the username's session holding token, if any. Caller must hold
+// sm.mu.
+func (sm *SessionManager) sessionByTokenLocked(key, token string) (*UserSession, bool) {
+	for _, id := range sm.usernameToIDs[key] {
+		if session, exists := sm.sessions[id]; exists && tokensEqual(session.Token, token) {
+			return session, true
+		}
+	}
+	return nil, false
 }
 
-// CreateSession creates a new user session
+// CreateSession creates a new user session. It returns nil if MaxSessions is reached and no
+// session can be evicted, or if the randomness source fails; use TryCreateSession to get the
+// error instead.
 func (sm *SessionManager) CreateSession(username string) *UserSession {
+	session, _ := sm.TryCreateSession(username)
+	return session
+}
+
+// TryCreateSession creates a new user session like CreateSession, failing with
+// ErrorCodeServiceUnavailable if MaxSessions is reached and every session is active, or with
+// ErrorCodeInternalError if the randomness source fails.
+func (sm *SessionManager) TryCreateSession(username string) (*UserSession, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	if err := sm.makeRoomLocked(""); err != nil {
+		return nil, err
+	}
 
-	userID := sm.GenerateUserID()
-	token := sm.GenerateSecureToken()
+	userID, err := sm.GenerateUserID()
+	if err != nil {
+		return nil, ErrRandomness(err)
+	}
+	token, err := sm.GenerateSecureToken()
+	if err != nil {
+		return nil, ErrRandomness(err)
+	}
 	session := &UserSession{
 		ID:       userID,
 		Username: username,
 		Token:    token,
 		Active:   true,
 		LastSeen: time.Now(),
+
+		CanonicalUsername: sm.canonical(username),
 	}
 
 	sm.sessions[userID] = session
-	sm.usernameToID[username] = userID
+	sm.indexSessionLocked(session)
+	sm.saveLocked(session)
 
 	if sm.OnSessionCreated != nil {
 		sm.OnSessionCreated(session)
 	}
 
-	return session
+	return session, nil
 }
 
-// CreateSessionWithID creates a session with a specific user ID (for reconnection)
+// CreateSessionWithID creates a session with a specific user ID (for reconnection). Like
+// CreateSession it returns nil if MaxSessions is reached and no session can be evicted, or if
+// the randomness source fails.
 func (sm *SessionManager) CreateSessionWithID(userID string, username string) *UserSession {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	if sm.makeRoomLocked(userID) != nil {
+		return nil
+	}
 
-	token := sm.GenerateSecureToken()
+	token, err := sm.GenerateSecureToken()
+	if err != nil {
+		return nil
+	}
 	session := &UserSession{
 		ID:       userID,
 		Username: username,
 		Token:    token,
 		Active:   true,
 		LastSeen: time.Now(),
+
+		CanonicalUsername: sm.canonical(username),
 	}
 
+	if existing, exists := sm.sessions[userID]; exists {
+		sm.unindexSessionLocked(existing.CanonicalUsername, userID)
+	}
 	sm.sessions[userID] = session
-	sm.usernameToID[username] = userID
+	sm.indexSessionLocked(session)
+	sm.saveLocked(session)
 
 	if sm.OnSessionCreated != nil {
 		sm.OnSessionCreated(session)
@@ -99,22 +269,42 @@ func (sm *SessionManager) CreateSessionWithID(userID string, username string) *U
 	return session
 }
 
-// ValidateSessionToken validates a session token for a given username
-func (sm *SessionManager) ValidateSessionToken(username string, token string) (*UserSession, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	userID, exists := sm.usernameToID[username]
-	if !exists {
-		return nil, false
+// makeRoomLocked ensures a session can be added under MaxSessions, evicting the least recently
+// seen inactive session if needed. Replacing the session with ID replacing needs no room.
+// Caller must hold sm.mu.
+func (sm *SessionManager) makeRoomLocked(replacing string) error {
+	if sm.MaxSessions <= 0 || len(sm.sessions) < sm.MaxSessions {
+		return nil
 	}
-
-	session, exists := sm.sessions[userID]
-	if !exists || !session.Active {
-		return nil, false
+	if _, exists := sm.sessions[replacing]; exists {
+		return nil
+	}
+	var oldest *UserSession
+	for _, session := range sm.sessions {
+		if !session.Active && (oldest == nil || session.LastSeen.Before(oldest.LastSeen)) {
+			oldest = session
+		}
+	}
+	if oldest == nil {
+		return ErrTooManySessions(sm.MaxSessions)
+	}
+	delete(sm.sessions, oldest.ID)
+	sm.unindexSessionLocked(oldest.CanonicalUsername, oldest.ID)
+	sm.deleteLocked(oldest.ID)
+	if sm.OnSessionRemoved != nil {
+		sm.OnSessionRemoved(oldest)
 	}
+	return nil
+}
 
-	if session.Token != token {
+// ValidateSessionToken validates a session token for a given username. With several sessions
+// for the username, it returns the active one the token belongs to.
+func (sm *SessionManager) ValidateSessionToken(username string, token string) (*UserSession, bool) {
+	sm.mu.Lock() // Not RLock: the lookup updates LastSeen
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessionByTokenLocked(sm.canonical(username), token)
+	if !exists || !session.Active {
 		return nil, false
 	}
 
@@ -122,39 +312,149 @@ func (sm *SessionManager) ValidateSessionToken(username string, token string) (*
 	return session, true
 }
 
-// ReconnectSession allows a user to reconnect with a valid token, even if their session was inactive
+// ReconnectSession allows a user to reconnect with a valid token, even if their session was inactive.
+// The token picks which of the username's sessions is resumed; the others are untouched.
+// With RotateIDOnReconnect the returned session carries a new ID, and the reconnect fails if
+// the randomness source cannot provide one.
+// Failed attempts count toward the reconnect lockout; while a username is locked out every
+// attempt fails, even with the correct token.
 func (sm *SessionManager) ReconnectSession(username string, token string) (*UserSession, bool) {
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
 
-	userID, exists := sm.usernameToID[username]
-	if !exists {
+	key := sm.canonical(username)
+	if sm.isLockedOutLocked(key) {
+		sm.mu.Unlock()
 		return nil, false
 	}
 
-	session, exists := sm.sessions[userID]
+	session, exists := sm.sessionByTokenLocked(key, token)
 	if !exists {
+		sm.recordFailedReconnect(key)
+		sm.mu.Unlock()
 		return nil, false
 	}
 
-	if session.Token != token {
-		return nil, false
+	oldID := session.ID
+	rotatedID := oldID
+	if sm.RotateIDOnReconnect {
+		var err error
+		if rotatedID, err = sm.GenerateUserID(); err != nil {
+			sm.mu.Unlock()
+			return nil, false
+		}
 	}
 
+	delete(sm.failedReconnects, key)
 	session.Active = true
 	session.LastSeen = time.Now()
 
+	if sm.RotateIDOnReconnect {
+		delete(sm.sessions, oldID)
+		session.ID = rotatedID
+		sm.sessions[session.ID] = session
+		for i, id := range sm.usernameToIDs[key] {
+			if id == oldID {
+				sm.usernameToIDs[key][i] = session.ID
+			}
+		}
+		sm.deleteLocked(oldID)
+	}
+	sm.saveLocked(session)
+	newID := session.ID
+	sm.mu.Unlock()
+
+	// Hooks run unlocked: OnSessionIDChanged is typically wired to LobbyManager.ReassignPlayerID,
+	// and holding sm.mu across it would invert the lock order used by SweepIdleOwners.
+	if newID != oldID && sm.OnSessionIDChanged != nil {
+		sm.OnSessionIDChanged(oldID, session)
+	}
 	if sm.OnSessionReconnected != nil {
 		sm.OnSessionReconnected(session)
 	}
-
 	return session, true
 }
 
-// GetSessionByID retrieves a session by user ID
-func (sm *SessionManager) GetSessionByID(userID string) (*UserSession, bool) {
+// RenameUser changes a session's username, keeping its ID, token and lobby. The old name is
+// freed and the new one reserved in a single step. It fails with ErrorCodeUsernameTaken if any
+// other session, active or awaiting reconnection, holds the new name; a change of case or
+// anything else the UsernameNormalizer ignores is always allowed. Only this session is renamed,
+// not other sessions sharing its old username.
+func (sm *SessionManager) RenameUser(userID, newUsername string) error {
+	if newUsername == "" {
+		return NewLobbyError(ErrorCodeInvalidUsername, "Username is empty")
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return ErrUserNotFound(userID)
+	}
+	key := sm.canonical(newUsername)
+	for _, id := range sm.usernameToIDs[key] {
+		if id != userID {
+			return ErrUsernameTaken(newUsername)
+		}
+	}
+	sm.unindexSessionLocked(session.CanonicalUsername, userID)
+	session.Username = newUsername
+	session.CanonicalUsername = key
+	sm.indexSessionLocked(session)
+	sm.saveLocked(session)
+	return nil
+}
+
+// IsLockedOut reports whether reconnection for a username is temporarily blocked after
+// too many failed attempts.
+func (sm *SessionManager) IsLockedOut(username string) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
+	return sm.isLockedOutLocked(sm.canonical(username))
+}
+
+func (sm *SessionManager) isLockedOutLocked(key string) bool {
+	attempts, exists := sm.failedReconnects[key]
+	return exists && time.Now().Before(attempts.lockedUntil)
+}
+
+// recordFailedReconnect counts a failed reconnection and starts a lockout once
+// MaxReconnectAttempts failures happen within ReconnectLockout. Expired entries, for every
+// username, are forgotten first so the map only holds recent failures. Caller must hold sm.mu.
+func (sm *SessionManager) recordFailedReconnect(key string) {
+	if sm.MaxReconnectAttempts <= 0 {
+		return
+	}
+	now := time.Now()
+	sm.pruneFailedReconnectsLocked(now)
+	attempts, exists := sm.failedReconnects[key]
+	if !exists || now.Sub(attempts.windowStart) > sm.ReconnectLockout {
+		attempts = &reconnectAttempts{windowStart: now}
+		if sm.failedReconnects == nil {
+			sm.failedReconnects = make(map[string]*reconnectAttempts)
+		}
+		sm.failedReconnects[key] = attempts
+	}
+	attempts.count++
+	if attempts.count >= sm.MaxReconnectAttempts {
+		attempts.lockedUntil = now.Add(sm.ReconnectLockout)
+		attempts.count = 0
+		attempts.windowStart = attempts.lockedUntil
+	}
+}
+
+// pruneFailedReconnectsLocked forgets failed reconnections whose window and any lockout have
+// passed. Caller must hold sm.mu exclusively.
+func (sm *SessionManager) pruneFailedReconnectsLocked(now time.Time) {
+	for key, attempts := range sm.failedReconnects {
+		if now.Sub(attempts.windowStart) > sm.ReconnectLockout && !now.Before(attempts.lockedUntil) {
+			delete(sm.failedReconnects, key)
+		}
+	}
+}
+
+// GetSessionByID retrieves a session by user ID
+func (sm *SessionManager) GetSessionByID(userID string) (*UserSession, bool) {
+	sm.mu.Lock() // Not RLock: the lookup updates LastSeen
+	defer sm.mu.Unlock()
 	session, exists := sm.sessions[userID]
 	if exists && session.Active {
 		session.LastSeen = time.Now()
@@ -162,6 +462,29 @@ func (sm *SessionManager) GetSessionByID(userID string) (*UserSession, bool) {
 	return session, exists
 }
 
+// Touch marks a session as seen now, keeping it clear of CleanupStaleSessions and idle sweeps
+// that go by LastSeen. It reports whether the session exists.
+func (sm *SessionManager) Touch(userID string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session, exists := sm.sessions[userID]
+	if exists {
+		session.LastSeen = time.Now()
+	}
+	return exists
+}
+
+// LastSeen reports when a session was last active, without counting the lookup as activity.
+func (sm *SessionManager) LastSeen(userID string) (time.Time, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return time.Time{}, false
+	}
+	return session.LastSeen, true
+}
+
 // RemoveSession marks a session as inactive
 func (sm *SessionManager) RemoveSession(userID string) {
 	sm.mu.Lock()
@@ -170,6 +493,7 @@ func (sm *SessionManager) RemoveSession(userID string) {
 	if session, exists := sm.sessions[userID]; exists {
 		if session.Active {
 			session.Active = false
+			sm.saveLocked(session)
 			if sm.OnSessionRemoved != nil {
 				sm.OnSessionRemoved(session)
 			}
@@ -184,22 +508,45 @@ func (sm *SessionManager) ForceRemoveSession(userID string) {
 
 	if session, exists := sm.sessions[userID]; exists {
 		session.Active = false
+		sm.saveLocked(session)
 		if sm.OnSessionRemoved != nil {
 			sm.OnSessionRemoved(session)
 		}
 	}
 }
 
-// IsUsernameTaken checks if a username is already in use (active session)
+// IsUsernameTaken checks if a username is already in use (any of its sessions is active)
 func (sm *SessionManager) IsUsernameTaken(username string) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	userID, exists := sm.usernameToID[username]
-	if !exists {
-		return false
+	for _, id := range sm.usernameToIDs[sm.canonical(username)] {
+		if session, exists := sm.sessions[id]; exists && session.Active {
+			return true
+		}
 	}
-	session, exists := sm.sessions[userID]
-	return exists && session.Active
+	return false
+}
+
+// HasSession reports whether any session, active or awaiting reconnection, exists for a username.
+func (sm *SessionManager) HasSession(username string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.usernameToIDs[sm.canonical(username)]) > 0
+}
+
+// GetSessionsByUsername returns every session, active or awaiting reconnection, held by a
+// username, oldest first.
+func (sm *SessionManager) GetSessionsByUsername(username string) []*UserSession {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	ids := sm.usernameToIDs[sm.canonical(username)]
+	sessions := make([]*UserSession, 0, len(ids))
+	for _, id := range ids {
+		if session, exists := sm.sessions[id]; exists {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
 }
 
 // SetLobbyID sets the lobby ID for a user session
@@ -207,7 +554,21 @@ func (sm *SessionManager) SetLobbyID(userID string, lobbyID string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	if session, exists := sm.sessions[userID]; exists {
-		session.LobbyID = lobbyID
+		sm.setLobbyIDLocked(session, lobbyID)
+	}
+}
+
+// setLobbyIDLocked updates a session's lobby and fires OnLobbyAssociationChanged if it
+// changed. Caller must hold sm.mu.
+func (sm *SessionManager) setLobbyIDLocked(session *UserSession, lobbyID string) {
+	oldLobbyID := session.LobbyID
+	if oldLobbyID == lobbyID {
+		return
+	}
+	session.LobbyID = lobbyID
+	sm.saveLocked(session)
+	if sm.OnLobbyAssociationChanged != nil {
+		sm.OnLobbyAssociationChanged(session, oldLobbyID, lobbyID)
 	}
 }
 
@@ -226,20 +587,81 @@ func (sm *SessionManager) ClearLobbyID(userID string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	if session, exists := sm.sessions[userID]; exists {
-		session.LobbyID = ""
+		sm.setLobbyIDLocked(session, "")
+	}
+}
+
+// SetCompression records the payload compression negotiated for a user session
+func (sm *SessionManager) SetCompression(userID string, compression Compression) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if session, exists := sm.sessions[userID]; exists {
+		session.Compression = compression
+		sm.saveLocked(session)
 	}
 }
 
-// CleanupStaleSessions removes sessions that have been inactive for too long
+// SetSessionData attaches a server-side value to a session under key. It reports whether the
+// session exists.
+func (sm *SessionManager) SetSessionData(userID string, key string, value interface{}) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return false
+	}
+	if session.Data == nil {
+		session.Data = make(map[string]interface{})
+	}
+	session.Data[key] = value
+	return true
+}
+
+// GetSessionData returns the value stored under key for a session, and whether it was set.
+func (sm *SessionManager) GetSessionData(userID string, key string) (interface{}, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return nil, false
+	}
+	value, ok := session.Data[key]
+	return value, ok
+}
+
+// CleanupStaleSessions removes sessions that have been inactive for too long, along with
+// expired reconnection failures
 func (sm *SessionManager) CleanupStaleSessions(maxAge time.Duration) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	now := time.Now()
+	sm.pruneFailedReconnectsLocked(now)
 	for userID, session := range sm.sessions {
 		if !session.Active && now.Sub(session.LastSeen) > maxAge {
 			delete(sm.sessions, userID)
-			delete(sm.usernameToID, session.Username)
+			sm.unindexSessionLocked(session.CanonicalUsername, userID)
+			sm.deleteLocked(userID)
 		}
 	}
 }
+
+// StartCleanup runs CleanupStaleSessions(maxAge) every interval until ctx is cancelled. The
+// returned channel is closed once the goroutine has exited.
+func (sm *SessionManager) StartCleanup(ctx context.Context, maxAge, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sm.CleanupStaleSessions(maxAge)
+			}
+		}
+	}()
+	return done
+}
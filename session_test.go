@@ -0,0 +1,555 @@
+package lobby
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionManager_ExportImport(t *testing.T) {
+	sm := NewSessionManager()
+	alice := sm.CreateSession("alice")
+	bob := sm.CreateSession("bob")
+	sm.SetLobbyID(alice.ID, "lobby1")
+	sm.RemoveSession(bob.ID)
+
+	data, err := sm.Export()
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	restored := NewSessionManager()
+	if err := restored.Import(data, ImportReplace); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	for _, original := range []*UserSession{alice, bob} {
+		got, exists := restored.sessions[original.ID]
+		if !exists {
+			t.Fatalf("Session %s missing after import", original.ID)
+		}
+		if got.Username != original.Username || got.Token != original.Token ||
+			got.Active != original.Active || got.LobbyID != original.LobbyID ||
+			!got.LastSeen.Equal(original.LastSeen) {
+			t.Errorf("Session %s not preserved: got %+v, want %+v", original.ID, got, original)
+		}
+	}
+
+	if _, valid := restored.ValidateSessionToken("alice", alice.Token); !valid {
+		t.Error("Imported session should validate with its original token")
+	}
+	if _, ok := restored.ReconnectSession("bob", bob.Token); !ok {
+		t.Error("Inactive imported session should still allow reconnection")
+	}
+}
+
+func TestSessionManager_DeterministicRand(t *testing.T) {
+	sm := NewSessionManager()
+	sm.Rand = bytes.NewReader(bytes.Repeat([]byte{0xab}, 40))
+
+	session := sm.CreateSession("alice")
+	if session.ID != "abababababababab" {
+		t.Errorf("Expected deterministic user ID, got %s", session.ID)
+	}
+	if session.Token != strings.Repeat("ab", 32) {
+		t.Errorf("Expected deterministic token, got %s", session.Token)
+	}
+
+	// The reader is now drained, so no ID can be generated
+	_, err := sm.TryCreateSession("bob")
+	if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeInternalError {
+		t.Errorf("Expected %s when the randomness source fails, got %v", ErrorCodeInternalError, err)
+	}
+}
+
+func TestSessionManager_UsernameNormalizer(t *testing.T) {
+	sm := NewSessionManager()
+	sm.UsernameNormalizer = func(username string) string {
+		return strings.ToLower(strings.TrimSpace(username))
+	}
+
+	session := sm.CreateSession("Alice")
+	if session.Username != "Alice" || session.CanonicalUsername != "alice" {
+		t.Errorf("Expected display Alice and canonical alice, got %q and %q", session.Username, session.CanonicalUsername)
+	}
+
+	for _, variant := range []string{"alice", "ALICE", " Alice "} {
+		if !sm.IsUsernameTaken(variant) {
+			t.Errorf("Expected %q to collide with Alice", variant)
+		}
+	}
+	if sm.IsUsernameTaken("bob") {
+		t.Error("Unrelated username should not be taken")
+	}
+
+	if _, valid := sm.ValidateSessionToken("aLiCe", session.Token); !valid {
+		t.Error("Token validation should use the canonical username")
+	}
+}
+
+func TestSessionManager_ReconnectLockout(t *testing.T) {
+	sm := NewSessionManager()
+	sm.MaxReconnectAttempts = 3
+	sm.ReconnectLockout = time.Minute
+	session := sm.CreateSession("alice")
+	sm.RemoveSession(session.ID)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := sm.ReconnectSession("alice", "guess"); ok {
+			t.Fatal("Wrong token should not reconnect")
+		}
+	}
+	if !sm.IsLockedOut("alice") {
+		t.Fatal("Expected alice to be locked out after 3 failures")
+	}
+	if _, ok := sm.ReconnectSession("alice", session.Token); ok {
+		t.Fatal("Correct token should be rejected during lockout")
+	}
+
+	// Simulate the cooldown elapsing
+	sm.failedReconnects["alice"].lockedUntil = time.Now().Add(-time.Second)
+	if sm.IsLockedOut("alice") {
+		t.Fatal("Lockout should end after the cooldown")
+	}
+	if _, ok := sm.ReconnectSession("alice", session.Token); !ok {
+		t.Fatal("Correct token should reconnect after the cooldown")
+	}
+	if _, tracked := sm.failedReconnects["alice"]; tracked {
+		t.Error("Successful reconnect should reset the failure counter")
+	}
+}
+
+func TestSessionManager_FailedReconnectsPruned(t *testing.T) {
+	sm := NewSessionManager()
+	sm.MaxReconnectAttempts = 3
+	sm.ReconnectLockout = time.Minute
+	for _, name := range []string{"alice", "bob"} {
+		sm.ReconnectSession(name, "guess")
+	}
+	if len(sm.failedReconnects) != 2 {
+		t.Fatalf("Expected 2 tracked usernames, got %d", len(sm.failedReconnects))
+	}
+
+	// Simulate alice's window passing; the next failure forgets her
+	sm.failedReconnects["alice"].windowStart = time.Now().Add(-2 * time.Minute)
+	sm.ReconnectSession("carol", "guess")
+	if _, tracked := sm.failedReconnects["alice"]; tracked || len(sm.failedReconnects) != 2 {
+		t.Errorf("Expected alice's expired failures pruned, got %d tracked", len(sm.failedReconnects))
+	}
+
+	for _, attempts := range sm.failedReconnects {
+		attempts.windowStart = time.Now().Add(-2 * time.Minute)
+	}
+	sm.CleanupStaleSessions(time.Hour)
+	if len(sm.failedReconnects) != 0 {
+		t.Errorf("Expected cleanup to prune expired failures, got %d tracked", len(sm.failedReconnects))
+	}
+}
+
+func TestSessionManager_TokenMismatchSameLength(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.CreateSession("alice")
+
+	// Tokens are compared in constant time; a guess of the right length differing only in
+	// the last byte must still be rejected everywhere a token is checked
+	last := session.Token[len(session.Token)-1]
+	flipped := byte('0')
+	if last == '0' {
+		flipped = '1'
+	}
+	guess := session.Token[:len(session.Token)-1] + string(flipped)
+
+	if _, ok := sm.ValidateSessionToken("alice", guess); ok {
+		t.Error("ValidateSessionToken accepted a mismatched token")
+	}
+	if _, ok := sm.ValidateSessionToken("alice", session.Token); !ok {
+		t.Error("ValidateSessionToken rejected the correct token")
+	}
+	if _, err := validateSessionToken(&HandlerDeps{SessionManager: sm}, session.ID, guess); err == nil {
+		t.Error("validateSessionToken accepted a mismatched token")
+	}
+	sm.RemoveSession(session.ID)
+	if _, ok := sm.ReconnectSession("alice", guess); ok {
+		t.Error("ReconnectSession accepted a mismatched token")
+	}
+	if _, ok := sm.ReconnectSession("alice", session.Token); !ok {
+		t.Error("ReconnectSession rejected the correct token")
+	}
+}
+
+func TestSessionManager_MultipleSessionsPerUsername(t *testing.T) {
+	sm := NewSessionManager()
+	phone := sm.CreateSession("alice")
+	laptop := sm.CreateSession("alice")
+
+	sessions := sm.GetSessionsByUsername("alice")
+	if len(sessions) != 2 || sessions[0].ID != phone.ID || sessions[1].ID != laptop.ID {
+		t.Fatalf("Expected both devices' sessions oldest first, got %v", sessions)
+	}
+	for _, device := range []*UserSession{phone, laptop} {
+		session, ok := sm.ValidateSessionToken("alice", device.Token)
+		if !ok || session.ID != device.ID {
+			t.Errorf("Expected token of %s to validate its own session", device.ID)
+		}
+	}
+
+	// One device dropping leaves the other signed in, and it can come back with its own token
+	sm.RemoveSession(phone.ID)
+	if !sm.IsUsernameTaken("alice") {
+		t.Error("Username should stay taken while the laptop is active")
+	}
+	if _, ok := sm.ValidateSessionToken("alice", phone.Token); ok {
+		t.Error("Inactive phone session should not validate")
+	}
+	if session, ok := sm.ReconnectSession("alice", phone.Token); !ok || session.ID != phone.ID {
+		t.Fatal("Expected the phone to reconnect to its own session")
+	}
+
+	sm.RemoveSession(phone.ID)
+	sm.RemoveSession(laptop.ID)
+	if sm.IsUsernameTaken("alice") {
+		t.Error("Username should be free once every session is inactive")
+	}
+	sm.CleanupStaleSessions(-time.Second)
+	if sm.HasSession("alice") || len(sm.GetSessionsByUsername("alice")) != 0 {
+		t.Error("Expected cleanup to drop both sessions from the username")
+	}
+}
+
+func TestSessionManager_SingleSessionPerUser(t *testing.T) {
+	sm := NewSessionManager()
+	sm.SingleSessionPerUser = true
+	first := sm.CreateSession("alice")
+	second := sm.CreateSession("alice")
+
+	sessions := sm.GetSessionsByUsername("alice")
+	if len(sessions) != 1 || sessions[0].ID != second.ID {
+		t.Fatalf("Expected only the newest session, got %v", sessions)
+	}
+	if _, ok := sm.ValidateSessionToken("alice", first.Token); ok {
+		t.Error("Replaced session's token should no longer validate by username")
+	}
+	if _, ok := sm.GetSessionByID(first.ID); !ok {
+		t.Error("Replaced session should still be reachable by ID")
+	}
+}
+
+func TestSessionManager_RenameUser(t *testing.T) {
+	sm := NewSessionManager()
+	sm.UsernameNormalizer = strings.ToLower
+	alice := sm.CreateSession("alice")
+	sm.CreateSession("bob")
+
+	if err := sm.RenameUser(alice.ID, "Bob"); err == nil {
+		t.Fatal("Expected renaming onto a taken username to fail")
+	} else if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeUsernameTaken {
+		t.Fatalf("Expected %s, got %v", ErrorCodeUsernameTaken, err)
+	}
+
+	if err := sm.RenameUser(alice.ID, "Alicia"); err != nil {
+		t.Fatalf("RenameUser failed: %v", err)
+	}
+	if alice.Username != "Alicia" || alice.CanonicalUsername != "alicia" {
+		t.Errorf("Expected session renamed to Alicia, got %q (%q)", alice.Username, alice.CanonicalUsername)
+	}
+	if sm.IsUsernameTaken("alice") {
+		t.Error("Old username should be freed")
+	}
+	if !sm.IsUsernameTaken("ALICIA") {
+		t.Error("New username should be reserved")
+	}
+	if session, ok := sm.ValidateSessionToken("alicia", alice.Token); !ok || session.ID != alice.ID {
+		t.Error("Token should still validate under the new name")
+	}
+
+	// A change the normalizer ignores is not a conflict with oneself
+	if err := sm.RenameUser(alice.ID, "ALICIA"); err != nil {
+		t.Errorf("Expected a case-only rename to succeed, got %v", err)
+	}
+}
+
+// jsonSessionStore is a SessionStore that keeps sessions serialized, like a Redis or file
+// store would, so nothing is shared with the manager that saved them.
+type jsonSessionStore struct {
+	saved map[string][]byte
+}
+
+func (s *jsonSessionStore) Save(session *UserSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	s.saved[session.ID] = data
+	return nil
+}
+
+func (s *jsonSessionStore) Load(userID string) (*UserSession, bool) {
+	data, exists := s.saved[userID]
+	if !exists {
+		return nil, false
+	}
+	var session UserSession
+	if json.Unmarshal(data, &session) != nil {
+		return nil, false
+	}
+	return &session, true
+}
+
+func (s *jsonSessionStore) Delete(userID string) error {
+	delete(s.saved, userID)
+	return nil
+}
+
+func (s *jsonSessionStore) All() ([]*UserSession, error) {
+	sessions := make([]*UserSession, 0, len(s.saved))
+	for userID := range s.saved {
+		session, _ := s.Load(userID)
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func TestSessionManager_StoreSurvivesRestart(t *testing.T) {
+	store := &jsonSessionStore{saved: make(map[string][]byte)}
+	sm, err := NewSessionManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("NewSessionManagerWithStore failed: %v", err)
+	}
+	alice := sm.CreateSession("alice")
+	sm.SetLobbyID(alice.ID, "lobby1")
+	carol := sm.CreateSession("carol")
+	sm.RemoveSession(carol.ID)
+	sm.CleanupStaleSessions(-time.Second)
+	bob := sm.CreateSession("bob")
+	sm.RemoveSession(bob.ID)
+
+	if saved, ok := store.Load(alice.ID); !ok || saved.LobbyID != "lobby1" {
+		t.Fatalf("Expected alice's lobby to be written through, got %+v", saved)
+	}
+	if _, ok := store.Load(carol.ID); ok {
+		t.Error("Expected cleaned up sessions to be deleted from the store")
+	}
+
+	// A new manager over the same store picks up where the old one left off
+	restarted, err := NewSessionManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("NewSessionManagerWithStore failed: %v", err)
+	}
+	session, ok := restarted.ValidateSessionToken("alice", alice.Token)
+	if !ok || session.ID != alice.ID {
+		t.Fatal("Expected alice's token to validate after the restart")
+	}
+	if lobbyID, _ := restarted.GetLobbyID(alice.ID); lobbyID != "lobby1" {
+		t.Errorf("Expected alice's lobby to survive the restart, got %q", lobbyID)
+	}
+	if !restarted.IsUsernameTaken("alice") {
+		t.Error("Expected alice's username to stay reserved")
+	}
+	if restarted.HasSession("carol") {
+		t.Error("Expected cleaned up sessions to stay gone")
+	}
+	if session, ok := restarted.ReconnectSession("bob", bob.Token); !ok || session.ID != bob.ID {
+		t.Fatal("Expected bob to reconnect after the restart")
+	}
+	if saved, _ := store.Load(bob.ID); !saved.Active {
+		t.Error("Expected the reconnect to be written through")
+	}
+}
+
+func TestNewSessionManager_DefaultsToInMemoryStore(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.CreateSession("alice")
+	if _, ok := sm.store.(*InMemorySessionStore); !ok {
+		t.Fatalf("Expected an in-memory store by default, got %T", sm.store)
+	}
+	saved, ok := sm.store.Load(session.ID)
+	if !ok || saved == session || saved.Token != session.Token {
+		t.Errorf("Expected the store to hold a copy of the session, got %+v", saved)
+	}
+}
+
+func TestSessionManager_MaxSessions(t *testing.T) {
+	sm := NewSessionManager()
+	sm.MaxSessions = 3
+	var removed []string
+	sm.OnSessionRemoved = func(session *UserSession) {
+		removed = append(removed, session.Username)
+	}
+	alice := sm.CreateSession("alice")
+	bob := sm.CreateSession("bob")
+	carol := sm.CreateSession("carol")
+
+	// Every session is active, so there is nothing to evict
+	if _, err := sm.TryCreateSession("dave"); err == nil {
+		t.Fatal("Expected a new session to be refused while every session is active")
+	} else if lobbyErr, ok := err.(*LobbyError); !ok || lobbyErr.Code != ErrorCodeServiceUnavailable {
+		t.Fatalf("Expected %s, got %v", ErrorCodeServiceUnavailable, err)
+	}
+	if sm.CreateSession("dave") != nil {
+		t.Error("Expected CreateSession to return nil at the cap")
+	}
+
+	sm.RemoveSession(alice.ID)
+	sm.RemoveSession(bob.ID)
+	sm.mu.Lock()
+	alice.LastSeen = time.Now().Add(-time.Minute)
+	bob.LastSeen = time.Now().Add(-time.Hour)
+	sm.mu.Unlock()
+	removed = nil
+
+	dave, err := sm.TryCreateSession("dave")
+	if err != nil {
+		t.Fatalf("Expected an inactive session to be evicted, got %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "bob" {
+		t.Errorf("Expected the least recently seen inactive session (bob) to be evicted, got %v", removed)
+	}
+	if sm.HasSession("bob") || !sm.HasSession("alice") {
+		t.Error("Expected only bob's session to be gone")
+	}
+	if _, ok := sm.ReconnectSession("bob", bob.Token); ok {
+		t.Error("Evicted session should not reconnect")
+	}
+	for _, session := range []*UserSession{carol, dave} {
+		if _, ok := sm.GetSessionByID(session.ID); !ok {
+			t.Errorf("Expected %s's session to be kept", session.Username)
+		}
+	}
+}
+
+func TestSessionManager_SessionData(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.CreateSession("alice")
+
+	if _, ok := sm.GetSessionData(session.ID, "elo"); ok {
+		t.Fatal("Expected no value before SetSessionData")
+	}
+	if !sm.SetSessionData(session.ID, "elo", 1500) {
+		t.Fatal("SetSessionData should succeed for an existing session")
+	}
+	if value, ok := sm.GetSessionData(session.ID, "elo"); !ok || value != 1500 {
+		t.Errorf("Expected elo 1500, got %v (ok=%v)", value, ok)
+	}
+	if sm.SetSessionData("missing", "elo", 1500) {
+		t.Error("SetSessionData should fail for an unknown session")
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "elo") {
+		t.Errorf("Session data leaked into JSON: %s", data)
+	}
+}
+
+func TestSessionManager_RotateIDOnReconnect(t *testing.T) {
+	sm := NewSessionManager()
+	sm.RotateIDOnReconnect = true
+	var oldIDs []string
+	sm.OnSessionIDChanged = func(oldID string, session *UserSession) { oldIDs = append(oldIDs, oldID) }
+	session := sm.CreateSession("alice")
+	oldID := session.ID
+	sm.RemoveSession(oldID)
+
+	reconnected, ok := sm.ReconnectSession("alice", session.Token)
+	if !ok {
+		t.Fatal("Expected reconnect to succeed")
+	}
+	if reconnected.ID == oldID {
+		t.Fatal("Expected a new user ID after reconnect")
+	}
+	if len(oldIDs) != 1 || oldIDs[0] != oldID {
+		t.Errorf("Expected OnSessionIDChanged with %s, got %v", oldID, oldIDs)
+	}
+	if _, exists := sm.GetSessionByID(oldID); exists {
+		t.Error("Old user ID should no longer resolve")
+	}
+	if got, exists := sm.GetSessionByID(reconnected.ID); !exists || got != reconnected {
+		t.Error("New user ID should resolve to the session")
+	}
+	if _, ok := sm.ValidateSessionToken("alice", session.Token); !ok {
+		t.Error("Token should stay valid under the new ID")
+	}
+}
+
+func TestSessionManager_StartCleanup(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.CreateSession("alice")
+	sm.RemoveSession(session.ID)
+
+	// An already cancelled context stops the goroutine straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	select {
+	case <-sm.StartCleanup(ctx, 0, time.Millisecond):
+	case <-time.After(time.Second):
+		t.Fatal("Expected StartCleanup to stop on a cancelled context")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	done := sm.StartCleanup(ctx, 0, 5*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, exists := sm.GetSessionByID(session.ID); !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the inactive session to be cleaned up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected StartCleanup to stop once cancelled")
+	}
+}
+
+func TestSessionManager_TouchSurvivesCleanup(t *testing.T) {
+	sm := NewSessionManager()
+	touched := sm.CreateSession("alice")
+	untouched := sm.CreateSession("bob")
+	sm.RemoveSession(touched.ID)
+	sm.RemoveSession(untouched.ID)
+	sm.mu.Lock()
+	touched.LastSeen = time.Now().Add(-time.Hour)
+	untouched.LastSeen = time.Now().Add(-time.Hour)
+	sm.mu.Unlock()
+
+	if !sm.Touch(touched.ID) || sm.Touch("nobody") {
+		t.Fatal("Expected Touch to report whether the session exists")
+	}
+	sm.CleanupStaleSessions(time.Minute)
+	if _, exists := sm.GetSessionByID(touched.ID); !exists {
+		t.Error("Expected the touched session to survive cleanup")
+	}
+	if _, exists := sm.GetSessionByID(untouched.ID); exists {
+		t.Error("Expected the untouched session to be cleaned up")
+	}
+}
+
+func TestSessionManager_OnLobbyAssociationChanged(t *testing.T) {
+	sm := NewSessionManager()
+	var changes []string
+	sm.OnLobbyAssociationChanged = func(session *UserSession, oldLobbyID, newLobbyID string) {
+		changes = append(changes, session.Username+": "+oldLobbyID+" -> "+newLobbyID)
+	}
+	session := sm.CreateSession("alice")
+
+	sm.SetLobbyID(session.ID, "lobby1")
+	sm.SetLobbyID(session.ID, "lobby1") // No change, no event
+	sm.SetLobbyID(session.ID, "lobby2")
+	sm.ClearLobbyID(session.ID)
+	sm.ClearLobbyID(session.ID)
+
+	want := []string{"alice:  -> lobby1", "alice: lobby1 -> lobby2", "alice: lobby2 -> "}
+	if strings.Join(changes, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, changes)
+	}
+}
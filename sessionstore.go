@@ -0,0 +1,117 @@
+package lobby
+
+import (
+	"sort"
+	"sync"
+)
+
+// SessionStore persists sessions so they survive a server restart, e.g. in Redis or a file.
+// SessionManager keeps its working set in memory and writes every change through to the
+// store; it reads the store back with All only when built by NewSessionManagerWithStore.
+//
+// Session.Data is server-side scratch space and is not expected to be persisted.
+type SessionStore interface {
+	Save(session *UserSession) error
+	Load(userID string) (*UserSession, bool)
+	Delete(userID string) error
+	All() ([]*UserSession, error)
+}
+
+// InMemorySessionStore is a thread-safe in-memory implementation of SessionStore. It is the
+// default for NewSessionManager and does not survive a restart.
+type InMemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]UserSession
+}
+
+// NewInMemorySessionStore creates a new in-memory session store.
+func NewInMemorySessionStore() *InMemorySessionStore {
+	return &InMemorySessionStore{
+		sessions: make(map[string]UserSession),
+	}
+}
+
+// Save stores a copy of the session, replacing any earlier one with the same ID.
+func (s *InMemorySessionStore) Save(session *UserSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *session
+	saved.Data = nil
+	s.sessions[session.ID] = saved
+	return nil
+}
+
+// Load returns a copy of the session with the given ID.
+func (s *InMemorySessionStore) Load(userID string) (*UserSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved, exists := s.sessions[userID]
+	if !exists {
+		return nil, false
+	}
+	return &saved, true
+}
+
+// Delete removes a session by ID. Deleting an unknown session is not an error.
+func (s *InMemorySessionStore) Delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, userID)
+	return nil
+}
+
+// All returns copies of every stored session.
+func (s *InMemorySessionStore) All() ([]*UserSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*UserSession, 0, len(s.sessions))
+	for _, saved := range s.sessions {
+		session := saved
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+// NewSessionManagerWithStore creates a session manager backed by store, starting from the
+// sessions already in it so users can reconnect after a restart. Session callbacks are not
+// fired for loaded sessions.
+func NewSessionManagerWithStore(store SessionStore) (*SessionManager, error) {
+	sessions, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+	sm := NewSessionManager()
+	sm.store = store
+	// Stores keep no order, so list each username's sessions by last activity
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.Before(sessions[j].LastSeen)
+	})
+	for _, session := range sessions {
+		if session.CanonicalUsername == "" {
+			session.CanonicalUsername = sm.canonical(session.Username)
+		}
+		sm.sessions[session.ID] = session
+		sm.indexSessionLocked(session)
+	}
+	return sm, nil
+}
+
+// saveLocked writes a changed session through to the store. Caller must hold sm.mu.
+func (sm *SessionManager) saveLocked(session *UserSession) {
+	if sm.store == nil {
+		return
+	}
+	if err := sm.store.Save(session); err != nil && sm.OnStoreError != nil {
+		sm.OnStoreError(session.ID, err)
+	}
+}
+
+// deleteLocked removes a session from the store. Caller must hold sm.mu.
+func (sm *SessionManager) deleteLocked(userID string) {
+	if sm.store == nil {
+		return
+	}
+	if err := sm.store.Delete(userID); err != nil && sm.OnStoreError != nil {
+		sm.OnStoreError(userID, err)
+	}
+}
@@ -0,0 +1,80 @@
+package lobby
+
+// JoinAsSpectator adds a player as an observer who receives lobby updates without taking a
+// seat. Spectators do not count toward capacity or MaxLobbiesPerPlayer, and leave with
+// LeaveLobby like players do. A spectator must leave before joining the lobby as a player.
+func (m *LobbyManager) JoinAsSpectator(lobbyID LobbyID, player *Player) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	return m.spectateLocked(lobby, player)
+}
+
+// JoinOrSpectate joins the player to the lobby, or adds them as a spectator if the lobby is
+// full. It reports whether the player ended up spectating. When spectator places are also
+// exhausted it fails with ErrorCodeSpectatorsFull.
+func (m *LobbyManager) JoinOrSpectate(lobbyID LobbyID, player *Player) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return false, ErrLobbyNotFound(string(lobbyID))
+	}
+	err := m.checkCanJoin(lobby, player)
+	if lobbyErr, ok := err.(*LobbyError); ok && lobbyErr.Code == ErrorCodeLobbyFull {
+		if err := m.spectateLocked(lobby, player); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := m.joinLobbyLocked(lobby, player); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// spectateLocked adds a spectator and broadcasts. Caller must hold the lobby's lock.
+func (m *LobbyManager) spectateLocked(lobby *Lobby, player *Player) error {
+	if findPlayer(lobby, player.ID) != nil || findSpectator(lobby, player.ID) != nil {
+		return ErrPlayerAlreadyInLobby(string(player.ID))
+	}
+	if _, banned := lobby.bans[player.ID]; banned {
+		return ErrPlayerBanned(string(lobby.ID))
+	}
+	if len(lobby.Spectators) >= lobby.MaxSpectators {
+		return ErrSpectatorsFull(string(lobby.ID))
+	}
+	if lobby.SpectatorRatio > 0 && float64(len(lobby.Spectators)+1) > lobby.SpectatorRatio*float64(len(lobby.Players)) {
+		return ErrSpectatorsFull(string(lobby.ID))
+	}
+	lobby.Spectators = append(lobby.Spectators, player)
+	m.broadcastLobbyState(lobby, ReasonSpectatorJoined)
+	return nil
+}
+
+// findSpectator returns the spectator with the given ID in the lobby, or nil.
+func findSpectator(lobby *Lobby, playerID PlayerID) *Player {
+	for _, s := range lobby.Spectators {
+		if s.ID == playerID {
+			return s
+		}
+	}
+	return nil
+}
+
+// removeSpectator removes a spectator from the lobby, reporting whether they were one.
+func removeSpectator(lobby *Lobby, playerID PlayerID) bool {
+	for i, s := range lobby.Spectators {
+		if s.ID == playerID {
+			lobby.Spectators = append(lobby.Spectators[:i:i], lobby.Spectators[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package lobby
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// teamCapacity returns how many players the lobby's teams hold in total, and false if the
+// lobby has no teams or no per-team limit.
+func teamCapacity(lobby *Lobby) (int, bool) {
+	if lobby.TeamCount <= 0 || lobby.MaxPerTeam <= 0 {
+		return 0, false
+	}
+	return lobby.TeamCount * lobby.MaxPerTeam, true
+}
+
+// assignSeat gives a joining player a slot and, in lobbies with teams, a team. Assignment is
+// deterministic so that concurrent joins, which are serialized by the manager lock, always
+// produce the same fair layout:
+//
+//   - Slot is the lowest slot index not held by a current player.
+//   - Team is the team with the fewest players; ties go to the lowest team number.
+//
+// Caller must hold the lobby's lock and must not have added player to Players yet.
+func assignSeat(lobby *Lobby, player *Player) {
+	taken := make(map[int]bool, len(lobby.Players))
+	for _, p := range lobby.Players {
+		taken[p.Slot] = true
+	}
+	slot := 0
+	for taken[slot] {
+		slot++
+	}
+	player.Slot = slot
+
+	player.Team = 0
+	if lobby.TeamCount <= 0 {
+		return
+	}
+	sizes := make([]int, lobby.TeamCount+1)
+	for _, p := range lobby.Players {
+		if p.Team >= 1 && p.Team <= lobby.TeamCount {
+			sizes[p.Team]++
+		}
+	}
+	best := 1
+	for team := 2; team <= lobby.TeamCount; team++ {
+		if sizes[team] < sizes[best] {
+			best = team
+		}
+	}
+	player.Team = best
+}
+
+// ShuffleTeams redistributes the lobby's players across its teams at random. Players are
+// shuffled and then dealt to teams in turn, so team sizes differ by at most one and stay within
+// MaxPerTeam. The randomness comes from LobbyManager.Rand. Only the owner may shuffle, and only
+// while the lobby is waiting; the result is broadcast with ReasonTeamsShuffled.
+func (m *LobbyManager) ShuffleTeams(lobbyID LobbyID, ownerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[lobbyID]
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	if lobby.OwnerID != ownerID {
+		return ErrUnauthorized("shuffle_teams")
+	}
+	if lobby.TeamCount <= 0 {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Lobby has no teams")
+	}
+	if lobby.State != LobbyWaiting {
+		return ErrLobbyNotWaiting(string(lobbyID))
+	}
+
+	order := make([]*Player, len(lobby.Players))
+	copy(order, lobby.Players)
+	source := m.randSource()
+	for i := len(order) - 1; i > 0; i-- {
+		j, err := randomIntn(source, i+1)
+		if err != nil {
+			return ErrRandomness(err)
+		}
+		order[i], order[j] = order[j], order[i]
+	}
+	for i, p := range order {
+		p.Team = i%lobby.TeamCount + 1
+	}
+	lobby.LastActivity = time.Now()
+
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonTeamsShuffled)
+	return nil
+}
+
+// SetPlayerTeam moves a player to another team of a waiting lobby. team must be between 1 and
+// the lobby's TeamCount, and the team must have room under MaxPerTeam or ErrTeamFull is
+// returned. Moving to the player's current team is a no-op.
+func (m *LobbyManager) SetPlayerTeam(lobbyID LobbyID, playerID PlayerID, team int) error {
+	lobby, unlock, exists := m.lockLobby(lobbyID)
+	if !exists {
+		return ErrLobbyNotFound(string(lobbyID))
+	}
+	defer unlock()
+	player := findPlayer(lobby, playerID)
+	if player == nil {
+		return ErrPlayerNotInLobby(string(playerID), string(lobbyID))
+	}
+	if lobby.TeamCount <= 0 {
+		return NewLobbyError(ErrorCodeInvalidRequest, "Lobby has no teams")
+	}
+	if team < 1 || team > lobby.TeamCount {
+		return NewLobbyErrorWithDetails(ErrorCodeInvalidRequest, "Invalid team", fmt.Sprintf("Team must be between 1 and %d", lobby.TeamCount))
+	}
+	if lobby.State != LobbyWaiting {
+		return ErrLobbyNotWaiting(string(lobbyID))
+	}
+	if player.Team == team {
+		return nil
+	}
+	if lobby.MaxPerTeam > 0 && lobby.TeamBalance()[team] >= lobby.MaxPerTeam {
+		return ErrTeamFull(team)
+	}
+
+	player.Team = team
+	lobby.LastActivity = time.Now()
+	if m.Events != nil && m.Events.OnLobbyStateChange != nil {
+		m.emit(lobby, m.Events.OnLobbyStateChange)
+	}
+	m.broadcastLobbyState(lobby, ReasonTeamChanged)
+	return nil
+}
+
+// TeamBalance counts the players on each team, keyed by team number. Every team from 1 to
+// TeamCount is present, so empty teams show up as 0; lobbies without teams return an empty map.
+// Callers outside the manager should use it on a GetLobbySnapshot copy.
+func (l *Lobby) TeamBalance() map[int]int {
+	balance := make(map[int]int, l.TeamCount)
+	for team := 1; team <= l.TeamCount; team++ {
+		balance[team] = 0
+	}
+	for _, p := range l.Players {
+		if p.Team >= 1 && p.Team <= l.TeamCount {
+			balance[p.Team]++
+		}
+	}
+	return balance
+}
+
+// randomIntn returns a number in [0, n) read from source.
+func randomIntn(source io.Reader, n int) (int, error) {
+	var bytes [8]byte
+	if _, err := io.ReadFull(source, bytes[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint64(bytes[:]) % uint64(n)), nil
+}
@@ -0,0 +1,130 @@
+package lobby
+
+import (
+	"sync"
+	"time"
+)
+
+// GetLobbySnapshot returns a copy of a lobby taken under the lock, and whether it exists.
+// Players, Moderators and Metadata are copied one level deep, so the snapshot can be read
+// freely while the manager keeps changing the live lobby.
+func (m *LobbyManager) GetLobbySnapshot(id LobbyID) (*Lobby, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lobby, exists := m.lobbies[id]
+	if !exists {
+		return nil, false
+	}
+	return snapshotLobby(lobby), true
+}
+
+// snapshotLobby copies the exported state of a lobby; new exported Lobby fields must be added
+// here too. Caller must hold the lobby's lock.
+func snapshotLobby(lobby *Lobby) *Lobby {
+	snapshot := &Lobby{
+		ID:         lobby.ID,
+		Name:       lobby.Name,
+		MaxPlayers: lobby.MaxPlayers,
+		CreatedAt:  lobby.CreatedAt,
+		Public:     lobby.Public,
+		State:      lobby.State,
+		OwnerID:    lobby.OwnerID,
+		AutoStart:  lobby.AutoStart,
+
+		PersistWhenEmpty: lobby.PersistWhenEmpty,
+		StartedAt:        lobby.StartedAt,
+		LastActivity:     lobby.LastActivity,
+		ReadyLocked:      lobby.ReadyLocked,
+		TeamCount:        lobby.TeamCount,
+		MaxPerTeam:       lobby.MaxPerTeam,
+		MinPlayers:       lobby.MinPlayers,
+		AutoReadyOnJoin:  lobby.AutoReadyOnJoin,
+		MaxSpectators:    lobby.MaxSpectators,
+		SpectatorRatio:   lobby.SpectatorRatio,
+		Region:           lobby.Region,
+	}
+	snapshot.Players = make([]*Player, len(lobby.Players))
+	for i, p := range lobby.Players {
+		player := *p
+		player.Metadata = copyMetadata(p.Metadata)
+		snapshot.Players[i] = &player
+	}
+	snapshot.Spectators = make([]*Player, len(lobby.Spectators))
+	for i, s := range lobby.Spectators {
+		spectator := *s
+		snapshot.Spectators[i] = &spectator
+	}
+	snapshot.Metadata = copyMetadata(lobby.Metadata)
+	if lobby.AllowedActions != nil {
+		snapshot.AllowedActions = make(map[string]bool, len(lobby.AllowedActions))
+		for action, allowed := range lobby.AllowedActions {
+			snapshot.AllowedActions[action] = allowed
+		}
+	}
+	if lobby.Moderators != nil {
+		snapshot.Moderators = make(map[PlayerID]bool, len(lobby.Moderators))
+		for id, moderator := range lobby.Moderators {
+			snapshot.Moderators[id] = moderator
+		}
+	}
+	return snapshot
+}
+
+// copyMetadata returns a shallow copy of a metadata map, or nil for nil.
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
+
+// StartLobbyTicker calls fn with a snapshot of an in-game lobby every interval, e.g. to advance
+// a match timer. The ticker belongs to the game running when it starts: it stops by itself once
+// the lobby leaves the in-game state, starts another game or is deleted, so start it after the
+// game has started. fn runs outside the manager lock and may
+// call back into the manager. The returned stop func ends the ticker early and may be called
+// any number of times.
+func (m *LobbyManager) StartLobbyTicker(lobbyID LobbyID, interval time.Duration, fn func(*Lobby)) (func(), error) {
+	m.mu.Lock()
+	lobby, exists := m.lobbies[lobbyID]
+	var startedAt time.Time
+	if exists {
+		startedAt = lobby.StartedAt
+	}
+	m.mu.Unlock()
+	if !exists {
+		return nil, ErrLobbyNotFound(string(lobbyID))
+	}
+
+	stopCh := make(chan struct{})
+	var once sync.Once
+	stop := func() { once.Do(func() { close(stopCh) }) }
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			m.mu.Lock()
+			var snapshot *Lobby
+			if m.lobbies[lobbyID] == lobby && lobby.State == LobbyInGame && lobby.StartedAt.Equal(startedAt) {
+				snapshot = snapshotLobby(lobby)
+			}
+			m.mu.Unlock()
+			if snapshot == nil {
+				stop()
+				return
+			}
+			fn(snapshot)
+		}
+	}()
+	return stop, nil
+}
@@ -0,0 +1,66 @@
+package lobby
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWriteTimeout is returned by TimeoutConn when a write misses its deadline, or when an
+// earlier write that timed out is still stuck.
+var ErrWriteTimeout = errors.New("write timed out")
+
+// TimeoutConn wraps a Conn so WriteJSON gives up after a deadline instead of blocking on a
+// stalled client. The returned ErrWriteTimeout lets the caller treat the client as gone, e.g.
+// by disconnecting it through LeaveLobbyWithReason.
+//
+// Conn is synchronous, so every write runs in its own goroutine while WriteJSON waits on it
+// with a timer; that is one goroutine and one timer per message. A write that times out keeps
+// its goroutine until the underlying WriteJSON returns, which may be never for a dead peer.
+// Until it does, further writes fail at once with ErrWriteTimeout rather than stacking more
+// goroutines on the same stuck connection or writing to it concurrently.
+type TimeoutConn struct {
+	conn    Conn
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending chan error // Result of a write that timed out, until it is received
+}
+
+// NewTimeoutConn wraps conn with a write deadline of timeout. A timeout of zero or less
+// disables the deadline and writes go straight through.
+func NewTimeoutConn(conn Conn, timeout time.Duration) *TimeoutConn {
+	return &TimeoutConn{conn: conn, timeout: timeout}
+}
+
+// WriteJSON writes v to the wrapped connection, returning ErrWriteTimeout if it takes longer
+// than the timeout. Concurrent calls are serialized.
+func (c *TimeoutConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		select {
+		case <-c.pending:
+			c.pending = nil // The stuck write finished; the connection is usable again
+		default:
+			return ErrWriteTimeout
+		}
+	}
+	if c.timeout <= 0 {
+		return c.conn.WriteJSON(v)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.conn.WriteJSON(v)
+	}()
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		c.pending = done
+		return ErrWriteTimeout
+	}
+}
@@ -1,9 +1,16 @@
 package lobby
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // RegisterUserRequest represents a request to register a new user or reconnect.
 type RegisterUserRequest struct {
 	Username string `json:"username"`
 	Token    string `json:"token,omitempty"`
+
+	Compression []string `json:"compression,omitempty"` // Schemes the client can decompress, e.g. "gzip"
 }
 
 // RegisterUserResponse represents the response after user registration.
@@ -12,6 +19,8 @@ type RegisterUserResponse struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	Token    string `json:"token"`
+
+	Compression string `json:"compression,omitempty"` // Scheme the server will use for large payloads
 }
 
 // CreateLobbyRequest represents a request to create a new lobby.
@@ -22,6 +31,20 @@ type CreateLobbyRequest struct {
 	UserID     string                 `json:"user_id"`
 	Token      string                 `json:"token"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	AutoStart  bool                   `json:"auto_start,omitempty"`
+	TeamCount  int                    `json:"team_count,omitempty"`
+	MaxPerTeam int                    `json:"max_per_team,omitempty"`
+
+	AutoReadyOnJoin  bool   `json:"auto_ready_on_join,omitempty"`
+	MaxSpectators    int    `json:"max_spectators,omitempty"`
+	PersistWhenEmpty bool   `json:"persist_when_empty,omitempty"` // Keep the lobby after its last player leaves
+	Region           string `json:"region,omitempty"`             // Where the game is hosted, see FindNearestLobbies
+
+	// DeleteOnEmpty set to false keeps the lobby after its last player leaves, like
+	// PersistWhenEmpty. Unset means true, deleting the lobby as before.
+	DeleteOnEmpty *bool `json:"delete_on_empty,omitempty"`
+
+	AllowedActions map[string]bool `json:"allowed_actions,omitempty"` // e.g. {"chat_message": false}
 }
 
 // JoinLobbyRequest represents a request to join an existing lobby.
@@ -31,6 +54,77 @@ type JoinLobbyRequest struct {
 	Token   string `json:"token"`
 }
 
+// JoinLobbyByNameRequest represents a request to join a lobby by name, see
+// LobbyManager.GetLobbyByNameInsensitive.
+type JoinLobbyByNameRequest struct {
+	Name   string `json:"name"`
+	UserID string `json:"user_id"`
+	Token  string `json:"token"`
+}
+
+// RequestJoinRequest represents a request to reserve a seat in a lobby before joining it.
+type RequestJoinRequest struct {
+	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id"`
+	Token   string `json:"token"`
+}
+
+// ConfirmJoinRequest represents a request to take a seat reserved with request_join.
+type ConfirmJoinRequest struct {
+	PendingToken string `json:"pending_token"`
+	UserID       string `json:"user_id"`
+	Token        string `json:"token"`
+}
+
+// JoinPendingResponse is sent when a seat has been reserved and awaits confirmation.
+type JoinPendingResponse struct {
+	Action       string            `json:"action"`
+	PendingToken string            `json:"pending_token"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+	Lobby        LobbyInfoResponse `json:"lobby"`
+}
+
+// KickPlayerRequest represents an owner's or moderator's request to remove a player from the lobby.
+type KickPlayerRequest struct {
+	LobbyID  string `json:"lobby_id"`
+	UserID   string `json:"user_id"`
+	Token    string `json:"token"`
+	TargetID string `json:"target_id"`
+}
+
+// ListBansRequest represents an owner's or moderator's request for their lobby's ban list.
+type ListBansRequest struct {
+	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id"`
+	Token   string `json:"token"`
+}
+
+// QuickJoinRequest represents a request to join any open lobby, see LobbyManager.QuickJoin.
+type QuickJoinRequest struct {
+	UserID       string                 `json:"user_id"`
+	Token        string                 `json:"token"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	CreateIfNone bool                   `json:"create_if_none,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	MaxPlayers   int                    `json:"max_players,omitempty"`
+}
+
+// ChatMessageRequest represents a player's chat message to their lobby.
+type ChatMessageRequest struct {
+	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id"`
+	Token   string `json:"token"`
+	Text    string `json:"text"`
+}
+
+// SetPlayersMetadataRequest represents an owner's request to set metadata for several players at once.
+type SetPlayersMetadataRequest struct {
+	LobbyID string                            `json:"lobby_id"`
+	UserID  string                            `json:"user_id"`
+	Token   string                            `json:"token"`
+	Players map[string]map[string]interface{} `json:"players"` // Metadata to merge, keyed by player ID
+}
+
 // LeaveLobbyRequest represents a request to leave a lobby.
 type LeaveLobbyRequest struct {
 	LobbyID string `json:"lobby_id"`
@@ -46,9 +140,68 @@ type SetReadyRequest struct {
 	Ready   bool   `json:"ready"`
 }
 
+// HeartbeatRequest represents a client's keepalive, sent while otherwise idle.
+type HeartbeatRequest struct {
+	UserID string `json:"user_id"`
+	Token  string `json:"token"`
+}
+
+// PongResponse answers a heartbeat.
+type PongResponse struct {
+	Action     string    `json:"action"`
+	ServerTime time.Time `json:"server_time"`
+}
+
+// RenameUserRequest represents a request to change the caller's username mid-session.
+type RenameUserRequest struct {
+	UserID   string `json:"user_id"`
+	Token    string `json:"token"`
+	Username string `json:"username"`
+}
+
+// UserRenamedResponse confirms a rename_user request.
+type UserRenamedResponse struct {
+	Action   string `json:"action"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// RematchRequest represents an owner's request to restart their lobby with the same group.
+type RematchRequest struct {
+	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id"`
+	Token   string `json:"token"`
+}
+
+// SetTeamRequest represents a player's request to move to another team.
+type SetTeamRequest struct {
+	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id"`
+	Token   string `json:"token"`
+	Team    int    `json:"team"`
+}
+
 // ListLobbiesRequest represents a request to list all lobbies.
 type ListLobbiesRequest struct {
-	Token string `json:"token"`
+	UserID string `json:"user_id,omitempty"`
+	Token  string `json:"token"`
+	Watch  bool   `json:"watch,omitempty"` // Also send lobby_removed when any lobby is deleted
+
+	Filter *ListLobbiesFilter `json:"filter,omitempty"` // Only list matching lobbies, see FindLobbies
+
+	// Offset and Limit request one page of lobbies, see ListLobbiesPaged. Without either the
+	// whole list is returned.
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// ListLobbiesFilter is the wire form of LobbyFilter.
+type ListLobbiesFilter struct {
+	PublicOnly   bool                   `json:"public_only,omitempty"`
+	State        string                 `json:"state,omitempty"` // "waiting", "in_game" or "finished"
+	NotFull      bool                   `json:"not_full,omitempty"`
+	NameContains string                 `json:"name_contains,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // StartGameRequest represents a request to start a game in a lobby.
@@ -61,6 +214,7 @@ type StartGameRequest struct {
 // GetLobbyInfoRequest represents a request to get information about a lobby.
 type GetLobbyInfoRequest struct {
 	LobbyID string `json:"lobby_id"`
+	UserID  string `json:"user_id,omitempty"`
 	Token   string `json:"token"`
 }
 
@@ -72,6 +226,7 @@ type LobbyInfoResponse struct {
 	Players    []PlayerState `json:"players"`
 	State      string        `json:"state"`
 	MaxPlayers int           `json:"max_players"`
+	MinPlayers int           `json:"min_players"` // Players needed before the game can start
 	Public     bool          `json:"public"`
 }
 
@@ -90,6 +245,117 @@ type LobbyStateResponse struct {
 	Players  []PlayerState          `json:"players"`
 	State    string                 `json:"state"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Reason   string                 `json:"reason,omitempty"` // What triggered a broadcast, e.g. ReasonPlayerJoined
+
+	MinPlayers  int  `json:"min_players"`            // Players needed before the game can start
+	ReadyLocked bool `json:"ready_locked,omitempty"` // Players cannot change their ready status
+	TeamCount   int  `json:"team_count,omitempty"`   // Teams players are split into; see PlayerState.Team
+	MaxPerTeam  int  `json:"max_per_team,omitempty"` // Players allowed on each team
+
+	Spectators []PlayerState `json:"spectators,omitempty"`
+	Spectating bool          `json:"spectating,omitempty"` // Set on the reply to a join that fell back to spectating
+
+	Private interface{} `json:"private,omitempty"` // The recipient's own state, see PlayerPrivateStateBuilder
+}
+
+// Reasons attached to lobby_state broadcasts so clients know what changed.
+const (
+	ReasonLobbyCreated       = "lobby_created"
+	ReasonPlayerJoined       = "player_joined"
+	ReasonPlayerLeft         = "player_left"
+	ReasonPlayerDisconnected = "player_disconnected"
+	ReasonPlayerReady        = "player_ready"
+	ReasonStateChanged       = "state_changed"
+	ReasonGameStarted        = "game_started"
+	ReasonModeratorsChanged  = "moderators_changed"
+	ReasonMetadataChanged    = "metadata_changed"
+	ReasonOwnerIdle          = "owner_idle"
+	ReasonPlayerRemoved      = "player_removed"
+	ReasonConnectionInfo     = "connection_info"
+	ReasonSpectatorJoined    = "spectator_joined"
+	ReasonSpectatorLeft      = "spectator_left"
+	ReasonPlayerKicked       = "player_kicked"
+	ReasonPlayerBanned       = "player_banned"
+	ReasonTeamsShuffled      = "teams_shuffled"
+	ReasonReadyLockChanged   = "ready_lock_changed"
+	ReasonTeamChanged        = "team_changed"
+	ReasonRematch            = "rematch"
+	ReasonPlayerRenamed      = "player_renamed"
+)
+
+// GameStartedResponse is broadcast to every player when a game starts.
+type GameStartedResponse struct {
+	Action    string    `json:"action"`
+	LobbyID   string    `json:"lobby_id"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// GameStartAckResponse answers a successful start_game request. It goes to the initiator only,
+// on top of the game_started broadcast everyone receives.
+type GameStartAckResponse struct {
+	Action    string    `json:"action"`
+	LobbyID   string    `json:"lobby_id"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// InGameJoinResponse is sent instead of a lobby state to a player who joins a game in progress.
+type InGameJoinResponse struct {
+	Action    string                 `json:"action"`
+	LobbyID   string                 `json:"lobby_id"`
+	PlayerID  string                 `json:"player_id"` // The player who joined
+	Players   []PlayerState          `json:"players"`
+	State     string                 `json:"state"`
+	StartedAt time.Time              `json:"started_at"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ChatMessageResponse is broadcast to everyone in a lobby when a player sends a chat message.
+type ChatMessageResponse struct {
+	Action    string    `json:"action"`
+	LobbyID   string    `json:"lobby_id"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BansResponse answers a list_bans request with the lobby's bans, oldest first.
+type BansResponse struct {
+	Action  string     `json:"action"`
+	LobbyID string     `json:"lobby_id"`
+	Bans    []BanEntry `json:"bans"`
+}
+
+// LobbyRemovedResponse tells members and list watchers that a lobby no longer exists.
+type LobbyRemovedResponse struct {
+	Action  string `json:"action"`
+	LobbyID string `json:"lobby_id"`
+}
+
+// RemovedFromLobbyResponse is sent to a player just before the server removes them from a lobby.
+type RemovedFromLobbyResponse struct {
+	Action  string `json:"action"`
+	LobbyID string `json:"lobby_id"`
+	Reason  string `json:"reason"` // One of the Removal* constants
+}
+
+// Reasons a player can be removed from a lobby without leaving on their own.
+const (
+	RemovalKicked   = "kicked"   // Removed by the owner or a moderator
+	RemovalBanned   = "banned"   // Banned by the owner or a moderator
+	RemovalShutdown = "shutdown" // The lobby was deleted by the server
+	RemovalIdle     = "idle"     // Removed by the idle-owner sweep
+	RemovalExpired  = "expired"  // The lobby was reaped after sitting idle
+
+	RemovalOverCapacity = "over_capacity" // Trimmed by TrimToCapacity
+)
+
+// OwnerChangedResponse is broadcast to the lobby after ownership passes to another player.
+type OwnerChangedResponse struct {
+	Action          string `json:"action"`
+	LobbyID         string `json:"lobby_id"`
+	NewOwnerID      string `json:"new_owner_id"`
+	PreviousOwnerID string `json:"previous_owner_id"`
 }
 
 // PlayerState represents the state of a player in a lobby.
@@ -98,10 +364,94 @@ type PlayerState struct {
 	Username     string `json:"username"`
 	Ready        bool   `json:"ready"`
 	CanStartGame bool   `json:"can_start_game"`
+	Role         string `json:"role"` // RoleOwner, RoleModerator, or RolePlayer
+	Slot         int    `json:"slot"`
+	Team         int    `json:"team,omitempty"`
+
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Connection *ConnectionInfo        `json:"connection,omitempty"`
 }
 
+// Roles a player can hold within a lobby.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RolePlayer    = "player"
+	RoleSpectator = "spectator"
+)
+
 // LobbyListResponse represents a list of available lobbies.
 type LobbyListResponse struct {
 	Action  string   `json:"action"`
 	Lobbies []string `json:"lobbies"`
+	Total   int      `json:"total"`    // Lobbies across all pages
+	HasMore bool     `json:"has_more"` // Further pages follow this one
+}
+
+// LobbySummary is the lightweight view of a lobby used to render a lobby browser.
+type LobbySummary struct {
+	LobbyID     string `json:"lobby_id"`
+	Name        string `json:"name"`
+	PlayerCount int    `json:"player_count"`
+	MaxPlayers  int    `json:"max_players"`
+	State       string `json:"state"`
+	Public      bool   `json:"public"`
+	Region      string `json:"region,omitempty"`
+}
+
+// LobbyListDetailedResponse lists lobbies with enough detail to render them without follow-up requests.
+type LobbyListDetailedResponse struct {
+	Action  string         `json:"action"`
+	Lobbies []LobbySummary `json:"lobbies"`
+	Total   int            `json:"total"`    // Lobbies across all pages
+	HasMore bool           `json:"has_more"` // Further pages follow this one
+}
+
+// List fields in responses always encode as [] rather than null, so clients never need to
+// special-case a missing list. The MarshalJSON methods below enforce this even for responses
+// built by hand or by a custom builder.
+
+// MarshalJSON encodes the response with a nil Players list as [].
+func (r LobbyInfoResponse) MarshalJSON() ([]byte, error) {
+	type plain LobbyInfoResponse
+	if r.Players == nil {
+		r.Players = []PlayerState{}
+	}
+	return json.Marshal(plain(r))
+}
+
+// MarshalJSON encodes the response with a nil Players list as [].
+func (r LobbyStateResponse) MarshalJSON() ([]byte, error) {
+	type plain LobbyStateResponse
+	if r.Players == nil {
+		r.Players = []PlayerState{}
+	}
+	return json.Marshal(plain(r))
+}
+
+// MarshalJSON encodes the response with a nil Players list as [].
+func (r InGameJoinResponse) MarshalJSON() ([]byte, error) {
+	type plain InGameJoinResponse
+	if r.Players == nil {
+		r.Players = []PlayerState{}
+	}
+	return json.Marshal(plain(r))
+}
+
+// MarshalJSON encodes the response with a nil Lobbies list as [].
+func (r LobbyListResponse) MarshalJSON() ([]byte, error) {
+	type plain LobbyListResponse
+	if r.Lobbies == nil {
+		r.Lobbies = []string{}
+	}
+	return json.Marshal(plain(r))
+}
+
+// MarshalJSON encodes the response with a nil Lobbies list as [].
+func (r LobbyListDetailedResponse) MarshalJSON() ([]byte, error) {
+	type plain LobbyListDetailedResponse
+	if r.Lobbies == nil {
+		r.Lobbies = []LobbySummary{}
+	}
+	return json.Marshal(plain(r))
 }